@@ -0,0 +1,132 @@
+// Command apikeys manages API keys from the shell, e.g. to issue the first
+// admin key:
+//
+//	go run ./apikeys create -name ops -role admin
+//	go run ./apikeys list
+//	go run ./apikeys revoke -id 3
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+)
+
+func init() {
+	initializers.LoadEnvVariables()
+	initializers.ConnectToDB()
+}
+
+const usage = `usage:
+  apikeys create -name NAME -role reader|editor|admin [-user ID] [-ttl DURATION]
+  apikeys list
+  apikeys revoke -id ID`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	switch os.Args[1] {
+	case "create":
+		create(os.Args[2:])
+	case "list":
+		list()
+	case "revoke":
+		revoke(os.Args[2:])
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func create(args []string) {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	name := fs.String("name", "", "what the key is for")
+	role := fs.String("role", "", "reader, editor or admin")
+	user := fs.Uint("user", 0, "user the key may edit (editor keys)")
+	ttl := fs.Duration("ttl", 0, "lifetime, e.g. 720h; 0 never expires")
+	_ = fs.Parse(args)
+
+	if strings.TrimSpace(*name) == "" {
+		log.Fatal("-name is required")
+	}
+	if !auth.ValidRole(*role) {
+		log.Fatalf("-role must be one of %s", strings.Join(auth.Roles, ", "))
+	}
+	var userID *uint
+	if *user != 0 {
+		var count int64
+		if err := initializers.DB.Model(&models.User{}).Where("id = ?", *user).Count(&count).Error; err != nil {
+			log.Fatal(err)
+		}
+		if count == 0 {
+			log.Fatalf("user %d does not exist", *user)
+		}
+		id := *user
+		userID = &id
+	}
+	var expiresAt *time.Time
+	if *ttl > 0 {
+		t := time.Now().Add(*ttl)
+		expiresAt = &t
+	}
+
+	key, secret, err := services.CreateAPIKey(initializers.DB, strings.TrimSpace(*name), *role, userID, expiresAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("created key %d (%s, %s)\n", key.ID, key.Name, key.Role)
+	fmt.Println("store it now, it cannot be shown again:")
+	fmt.Println(secret)
+}
+
+func list() {
+	var keys []models.APIKey
+	if err := initializers.DB.Order("id").Find(&keys).Error; err != nil {
+		log.Fatal(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tUSER\tLAST USED\tSTATUS")
+	now := time.Now()
+	for _, k := range keys {
+		user, lastUsed, status := "-", "never", "active"
+		if k.UserID != nil {
+			user = fmt.Sprint(*k.UserID)
+		}
+		if k.LastUsedAt != nil {
+			lastUsed = k.LastUsedAt.Format(time.RFC3339)
+		}
+		switch {
+		case k.RevokedAt != nil:
+			status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+		case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+			status = "expired " + k.ExpiresAt.Format(time.RFC3339)
+		case k.ExpiresAt != nil:
+			status = "expires " + k.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Role, user, lastUsed, status)
+	}
+	_ = w.Flush()
+}
+
+func revoke(args []string) {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	id := fs.Uint("id", 0, "key to revoke")
+	_ = fs.Parse(args)
+	if *id == 0 {
+		log.Fatal("-id is required")
+	}
+	key, err := services.RevokeAPIKey(initializers.DB, *id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("revoked key %d (%s) at %s\n", key.ID, key.Name, key.RevokedAt.Format(time.RFC3339))
+}
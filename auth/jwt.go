@@ -0,0 +1,417 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Errors returned by JWTVerifier.Verify. The messages are safe to show to the
+// client.
+var (
+	ErrJWTDisabled  = errors.New("JWT authentication is not configured")
+	ErrJWTMalformed = errors.New("malformed token")
+	ErrJWTSignature = errors.New("invalid token signature")
+	ErrJWTExpired   = errors.New("token has expired")
+	ErrJWTNoExpiry  = errors.New("token has no expiry")
+	ErrJWTNotYet    = errors.New("token is not valid yet")
+	ErrJWTIssuer    = errors.New("token issuer is not accepted")
+	ErrJWTAudience  = errors.New("token audience is not accepted")
+	ErrJWTRole      = errors.New("token role is unknown")
+)
+
+// Claims are the JWT claims the service reads. Role defaults to reader; a
+// numeric user_id links the caller to the user it may edit, and session_id
+// ties tokens issued at login to the session they belong to.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt *float64 `json:"exp,omitempty"`
+	NotBefore *float64 `json:"nbf,omitempty"`
+	IssuedAt  *float64 `json:"iat,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	UserID    *uint    `json:"user_id,omitempty"`
+	SessionID *uint    `json:"session_id,omitempty"`
+}
+
+// Principal is the caller the claims describe.
+func (c Claims) Principal() Principal {
+	role := c.Role
+	if role == "" {
+		role = RoleReader
+	}
+	return Principal{Method: MethodJWT, Subject: c.Subject, Role: role, UserID: c.UserID, SessionID: c.SessionID}
+}
+
+// audience accepts both forms of the aud claim: a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// verificationKey is a key tokens may be signed with. Kid is empty for keys
+// that were not loaded from a JWKS.
+type verificationKey struct {
+	Kid string
+	Key crypto.PublicKey
+}
+
+// JWTVerifier checks bearer JWTs signed with HMAC (HS256/384/512, a shared
+// secret), RSA or ECDSA (RS* and ES*, public keys from a PEM file or a JWKS
+// file). A token naming a kid skips JWKS keys with a different kid.
+type JWTVerifier struct {
+	Secret   []byte
+	Keys     []verificationKey
+	Issuer   string
+	Audience string
+	// AllowNoExpiry accepts RS* and ES* tokens without an exp claim, for
+	// identity providers that do not set one. HS* tokens always need exp.
+	AllowNoExpiry bool
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	Now    func() time.Time
+}
+
+// NewJWTVerifierFromEnv configures a verifier from JWT_SECRET,
+// JWT_PUBLIC_KEY_FILE, JWT_JWKS_FILE, JWT_ISSUER, JWT_AUDIENCE and
+// JWT_ALLOW_NO_EXP. Without any key JWT authentication is disabled.
+func NewJWTVerifierFromEnv() (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		Secret:   []byte(os.Getenv("JWT_SECRET")),
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   30 * time.Second,
+		Now:      time.Now,
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("JWT_ALLOW_NO_EXP"))) {
+	case "1", "true", "yes":
+		v.AllowNoExpiry = true
+	}
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+		keys, err := loadPEMKeys(path)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PUBLIC_KEY_FILE: %w", err)
+		}
+		v.Keys = append(v.Keys, keys...)
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		keys, err := loadJWKS(path)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_JWKS_FILE: %w", err)
+		}
+		v.Keys = append(v.Keys, keys...)
+	}
+	return v, nil
+}
+
+// Enabled reports whether any key is configured.
+func (v *JWTVerifier) Enabled() bool {
+	return v != nil && (len(v.Secret) > 0 || len(v.Keys) > 0)
+}
+
+// Verify checks the token's signature and registered claims and returns its
+// claims.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	var claims Claims
+	if !v.Enabled() {
+		return claims, ErrJWTDisabled
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrJWTMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrJWTMalformed
+	}
+	if !v.verifySignature(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), sig) {
+		return claims, ErrJWTSignature
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrJWTMalformed
+	}
+
+	if claims.ExpiresAt == nil && (!v.AllowNoExpiry || strings.HasPrefix(header.Alg, "HS")) {
+		return claims, ErrJWTNoExpiry
+	}
+	now := v.Now()
+	if claims.ExpiresAt != nil && now.After(unixTime(*claims.ExpiresAt).Add(v.Leeway)) {
+		return claims, ErrJWTExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.Leeway).Before(unixTime(*claims.NotBefore)) {
+		return claims, ErrJWTNotYet
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return claims, ErrJWTIssuer
+	}
+	if v.Audience != "" && !containsString(claims.Audience, v.Audience) {
+		return claims, ErrJWTAudience
+	}
+	if claims.Role != "" && claims.Role != RoleSelf && !ValidRole(claims.Role) {
+		return claims, ErrJWTRole
+	}
+	return claims, nil
+}
+
+// Sign issues an HS256 token for claims with the verifier's secret, stamping
+// its issuer and audience, so the service's own tokens verify like any other.
+func (v *JWTVerifier) Sign(claims Claims) (string, error) {
+	if v == nil || len(v.Secret) == 0 {
+		return "", ErrJWTDisabled
+	}
+	claims.Issuer = v.Issuer
+	if v.Audience != "" {
+		claims.Audience = audience{v.Audience}
+	}
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// NumericDate is t as a JWT numeric date claim.
+func NumericDate(t time.Time) *float64 {
+	sec := float64(t.Unix())
+	return &sec
+}
+
+// verifySignature checks sig with every configured key that fits alg (and kid,
+// when given). The algorithm decides the key type, so an HMAC token can never
+// be checked against a public key.
+func (v *JWTVerifier) verifySignature(alg, kid string, signed, sig []byte) bool {
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		if len(v.Secret) == 0 {
+			return false
+		}
+		mac := hmac.New(hashFor(alg), v.Secret)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case "RS256", "RS384", "RS512", "ES256", "ES384", "ES512":
+	default:
+		return false
+	}
+
+	h := hashFor(alg)()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	for _, k := range v.Keys {
+		if kid != "" && k.Kid != "" && k.Kid != kid {
+			continue
+		}
+		switch pub := k.Key.(type) {
+		case *rsa.PublicKey:
+			if alg[0] == 'R' && rsa.VerifyPKCS1v15(pub, cryptoHash(alg), digest, sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if alg[0] == 'E' && verifyECDSA(pub, digest, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyECDSA checks a JWS ECDSA signature, which is r and s as fixed size
+// big-endian integers rather than ASN.1.
+func verifyECDSA(pub *ecdsa.PublicKey, digest, sig []byte) bool {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	return ecdsa.Verify(pub, digest, r, s)
+}
+
+func hashFor(alg string) func() hash.Hash {
+	switch alg[2:] {
+	case "384":
+		return sha512.New384
+	case "512":
+		return sha512.New
+	default:
+		return sha256.New
+	}
+}
+
+func cryptoHash(alg string) crypto.Hash {
+	switch alg[2:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPEMKeys reads every RSA or EC public key in a PEM file.
+func loadPEMKeys(path string) ([]verificationKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []verificationKey
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, verificationKey{Key: key})
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+// loadJWKS reads the RSA and EC signing keys of a JWKS file; other keys are
+// skipped.
+func loadJWKS(path string) ([]verificationKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	var keys []verificationKey
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				return nil, fmt.Errorf("key %q: invalid RSA parameters", jwk.Kid)
+			}
+			keys = append(keys, verificationKey{Kid: jwk.Kid, Key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}})
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("key %q: unsupported curve %q", jwk.Kid, jwk.Crv)
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("key %q: invalid EC parameters", jwk.Kid)
+			}
+			keys = append(keys, verificationKey{Kid: jwk.Kid, Key: &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// signToken builds a JWS with the given header and claims. key is the HMAC
+// secret ([]byte), an *rsa.PrivateKey or an *ecdsa.PrivateKey; nil leaves the
+// signature empty.
+func signToken(t *testing.T, header map[string]string, claims interface{}, key interface{}) string {
+	t.Helper()
+	rawHeader, _ := json.Marshal(header)
+	rawClaims, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(rawHeader) + "." + base64.RawURLEncoding.EncodeToString(rawClaims)
+	alg := header["alg"]
+	var sig []byte
+	switch k := key.(type) {
+	case nil:
+	case []byte:
+		mac := hmac.New(hashFor(alg), k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := hashFor(alg)()
+		h.Write([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, cryptoHash(alg), h.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		h := hashFor(alg)()
+		h.Write([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func at(d time.Duration) *float64 {
+	return NumericDate(testNow.Add(d))
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	hsOnly := &JWTVerifier{Secret: secret, Leeway: 30 * time.Second, Now: func() time.Time { return testNow }}
+	publicOnly := &JWTVerifier{
+		Keys:   []verificationKey{{Key: &rsaKey.PublicKey}, {Key: &ecKey.PublicKey}, {Key: &p521Key.PublicKey}},
+		Leeway: 30 * time.Second,
+		Now:    func() time.Time { return testNow },
+	}
+	withKids := &JWTVerifier{
+		Keys:   []verificationKey{{Kid: "a", Key: &rsaKey.PublicKey}, {Kid: "b", Key: &otherRSA.PublicKey}},
+		Leeway: 30 * time.Second,
+		Now:    func() time.Time { return testNow },
+	}
+	noExpiry := &JWTVerifier{
+		Secret:        secret,
+		Keys:          []verificationKey{{Key: &rsaKey.PublicKey}},
+		AllowNoExpiry: true,
+		Leeway:        30 * time.Second,
+		Now:           func() time.Time { return testNow },
+	}
+	strict := &JWTVerifier{
+		Secret:   secret,
+		Issuer:   "https://idp.example.com",
+		Audience: "arcaptcha-service",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return testNow },
+	}
+
+	hs := map[string]string{"alg": "HS256", "typ": "JWT"}
+	valid := Claims{Subject: "alice", ExpiresAt: at(time.Hour)}
+
+	cases := []struct {
+		name  string
+		v     *JWTVerifier
+		token string
+		want  error
+	}{
+		{"HS256", hsOnly, signToken(t, hs, valid, secret), nil},
+		{"HS512", hsOnly, signToken(t, map[string]string{"alg": "HS512"}, valid, secret), nil},
+		{"HS256 wrong secret", hsOnly, signToken(t, hs, valid, []byte("other")), ErrJWTSignature},
+		{"disabled", &JWTVerifier{}, signToken(t, hs, valid, secret), ErrJWTDisabled},
+		{"malformed", hsOnly, "a.b", ErrJWTMalformed},
+		{"bad signature encoding", hsOnly, signToken(t, hs, valid, nil) + "!", ErrJWTMalformed},
+
+		// alg confusion: an HMAC token keyed with the public key's PEM must
+		// never verify against a verifier that only holds public keys.
+		{"HS256 with public key as secret", publicOnly, signToken(t, hs, valid, rsaPEM), ErrJWTSignature},
+		{"HS256 with DER public key as secret", publicOnly, signToken(t, hs, valid, der), ErrJWTSignature},
+		{"RS256 against secret only", hsOnly, signToken(t, map[string]string{"alg": "RS256"}, valid, rsaKey), ErrJWTSignature},
+		{"none", hsOnly, signToken(t, map[string]string{"alg": "none"}, valid, nil), ErrJWTSignature},
+		{"None", publicOnly, signToken(t, map[string]string{"alg": "None"}, valid, nil), ErrJWTSignature},
+		{"empty alg", hsOnly, signToken(t, map[string]string{}, valid, nil), ErrJWTSignature},
+
+		{"RS256", publicOnly, signToken(t, map[string]string{"alg": "RS256"}, valid, rsaKey), nil},
+		{"RS384", publicOnly, signToken(t, map[string]string{"alg": "RS384"}, valid, rsaKey), nil},
+		{"RS256 other key", publicOnly, signToken(t, map[string]string{"alg": "RS256"}, valid, otherRSA), ErrJWTSignature},
+		{"RS256 key claimed as ES256", publicOnly, relabel(t, signToken(t, map[string]string{"alg": "RS256"}, valid, rsaKey), "ES256"), ErrJWTSignature},
+		{"ES256", publicOnly, signToken(t, map[string]string{"alg": "ES256"}, valid, ecKey), nil},
+		{"ES512 on P-521", publicOnly, signToken(t, map[string]string{"alg": "ES512"}, valid, p521Key), nil},
+		{"ES256 ASN.1 signature", publicOnly, asn1Signed(t, map[string]string{"alg": "ES256"}, valid, ecKey), ErrJWTSignature},
+		{"ES256 short signature", publicOnly, resign(t, signToken(t, map[string]string{"alg": "ES256"}, valid, ecKey), func(sig []byte) []byte { return sig[1:] }), ErrJWTSignature},
+		{"ES256 padded signature", publicOnly, resign(t, signToken(t, map[string]string{"alg": "ES256"}, valid, ecKey), func(sig []byte) []byte { return append([]byte{0}, sig...) }), ErrJWTSignature},
+
+		{"kid selects key", withKids, signToken(t, map[string]string{"alg": "RS256", "kid": "a"}, valid, rsaKey), nil},
+		{"kid of another key", withKids, signToken(t, map[string]string{"alg": "RS256", "kid": "b"}, valid, rsaKey), ErrJWTSignature},
+		{"unknown kid", withKids, signToken(t, map[string]string{"alg": "RS256", "kid": "c"}, valid, rsaKey), ErrJWTSignature},
+		{"no kid tries every key", withKids, signToken(t, map[string]string{"alg": "RS256"}, valid, otherRSA), nil},
+
+		{"expired", hsOnly, signToken(t, hs, Claims{ExpiresAt: at(-time.Minute)}, secret), ErrJWTExpired},
+		{"expired within leeway", hsOnly, signToken(t, hs, Claims{ExpiresAt: at(-10 * time.Second)}, secret), nil},
+		{"not valid yet", hsOnly, signToken(t, hs, Claims{NotBefore: at(time.Minute), ExpiresAt: at(time.Hour)}, secret), ErrJWTNotYet},
+		{"not valid yet within leeway", hsOnly, signToken(t, hs, Claims{NotBefore: at(10 * time.Second), ExpiresAt: at(time.Hour)}, secret), nil},
+		{"no exp", hsOnly, signToken(t, hs, Claims{Subject: "alice"}, secret), ErrJWTNoExpiry},
+		{"RS256 no exp", publicOnly, signToken(t, map[string]string{"alg": "RS256"}, Claims{Subject: "alice"}, rsaKey), ErrJWTNoExpiry},
+		{"RS256 no exp allowed", noExpiry, signToken(t, map[string]string{"alg": "RS256"}, Claims{Subject: "alice"}, rsaKey), nil},
+		{"HS256 no exp allowed", noExpiry, signToken(t, hs, Claims{Subject: "alice"}, secret), ErrJWTNoExpiry},
+
+		{"issuer and audience", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "iss": "https://idp.example.com", "aud": "arcaptcha-service"}, secret), nil},
+		{"audience list", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "iss": "https://idp.example.com", "aud": []string{"other", "arcaptcha-service"}}, secret), nil},
+		{"wrong issuer", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "iss": "https://evil.example.com", "aud": "arcaptcha-service"}, secret), ErrJWTIssuer},
+		{"missing issuer", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "aud": "arcaptcha-service"}, secret), ErrJWTIssuer},
+		{"wrong audience", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "iss": "https://idp.example.com", "aud": []string{"other"}}, secret), ErrJWTAudience},
+		{"missing audience", strict, signToken(t, hs, map[string]interface{}{"exp": *at(time.Hour), "iss": "https://idp.example.com"}, secret), ErrJWTAudience},
+
+		{"self role", hsOnly, signToken(t, hs, Claims{Role: RoleSelf, ExpiresAt: at(time.Hour)}, secret), nil},
+		{"unknown role", hsOnly, signToken(t, hs, Claims{Role: "root", ExpiresAt: at(time.Hour)}, secret), ErrJWTRole},
+	}
+	for _, tc := range cases {
+		if _, err := tc.v.Verify(tc.token); err != tc.want {
+			t.Errorf("%s: Verify() error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestJWTSignRoundTrip(t *testing.T) {
+	v := &JWTVerifier{Secret: []byte("secret"), Issuer: "svc", Audience: "svc-api", Now: func() time.Time { return testNow }}
+	userID := uint(7)
+	token, err := v.Sign(Claims{Subject: "user:7", Role: RoleEditor, UserID: &userID, ExpiresAt: at(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify(Sign()) failed: %v", err)
+	}
+	p := claims.Principal()
+	if p.Subject != "user:7" || p.Role != RoleEditor || p.UserID == nil || *p.UserID != 7 {
+		t.Errorf("Principal() = %+v", p)
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "e1", "crv": "P-384", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N), "e": "AQAB"},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Kid != "r1" || keys[1].Kid != "e1" {
+		t.Fatalf("loadJWKS() = %+v, want keys r1 and e1", keys)
+	}
+
+	v := &JWTVerifier{Keys: keys, Now: func() time.Time { return testNow }}
+	for alg, key := range map[string]interface{}{"RS256": rsaKey, "ES384": ecKey} {
+		if _, err := v.Verify(signToken(t, map[string]string{"alg": alg}, Claims{ExpiresAt: at(time.Hour)}, key)); err != nil {
+			t.Errorf("%s with JWKS key: Verify() error = %v", alg, err)
+		}
+	}
+}
+
+// relabel swaps the alg of a signed token, keeping its signature.
+func relabel(t *testing.T, token, alg string) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg})
+	_, rest, _ := strings.Cut(token, ".")
+	return base64.RawURLEncoding.EncodeToString(header) + "." + rest
+}
+
+// resign rewrites the signature of a token.
+func resign(t *testing.T, token string, fn func([]byte) []byte) string {
+	t.Helper()
+	i := strings.LastIndex(token, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token[:i+1] + base64.RawURLEncoding.EncodeToString(fn(sig))
+}
+
+// asn1Signed signs with ECDSA in ASN.1 form, which JWS does not use.
+func asn1Signed(t *testing.T, header map[string]string, claims interface{}, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	token := signToken(t, header, claims, nil)
+	signed := token[:len(token)-1]
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for new hashes (OWASP's 19 MiB, 2 passes, 1 lane).
+// Hashes made with other parameters still verify and report that they should
+// be rehashed.
+const (
+	argonMemory  = 19 * 1024
+	argonTime    = 2
+	argonThreads = 1
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// HashPassword hashes password with argon2id into the PHC string format,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches hash, and whether hash uses
+// outdated parameters and should be replaced with a fresh HashPassword.
+func VerifyPassword(hash, password string) (ok, rehash bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false
+	}
+	var version int
+	var memory uint32
+	var time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+	salt, errSalt := base64.RawStdEncoding.DecodeString(parts[4])
+	want, errKey := base64.RawStdEncoding.DecodeString(parts[5])
+	if errSalt != nil || errKey != nil || len(want) == 0 {
+		return false, false
+	}
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false
+	}
+	rehash = memory != argonMemory || time != argonTime || threads != argonThreads || len(want) != argonKeyLen
+	return true, rehash
+}
+
+// dummyHash is verified against when there is no user to check, so a login
+// for an unknown account takes as long as one with a wrong password.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("dummy password")
+	return hash
+})
+
+// BurnPasswordCheck spends the time of one VerifyPassword.
+func BurnPasswordCheck(password string) {
+	VerifyPassword(dummyHash(), password)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// phc encodes a hash of password made with the given argon2id parameters.
+func phc(password string, version int, memory, time uint32, threads uint8, keyLen uint32) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix := "$argon2id$v=19$m=19456,t=2,p=1$"; !strings.HasPrefix(hash, prefix) {
+		t.Errorf("hash = %q, want prefix %q", hash, prefix)
+	}
+	if ok, rehash := VerifyPassword(hash, "correct horse"); !ok || rehash {
+		t.Errorf("VerifyPassword(right) = %v, %v, want true, false", ok, rehash)
+	}
+	if ok, _ := VerifyPassword(hash, "correct horse "); ok {
+		t.Error("VerifyPassword(wrong) = true")
+	}
+	if again, _ := HashPassword("correct horse"); again == hash {
+		t.Error("two hashes of one password are equal, want fresh salts")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	current := phc("secret", argon2.Version, argonMemory, argonTime, argonThreads, argonKeyLen)
+	parts := strings.Split(current, "$")
+	replace := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"current parameters", current, "secret", true, false},
+		{"wrong password", current, "Secret", false, false},
+		{"empty password", current, "", false, false},
+		{"lower memory", phc("secret", argon2.Version, 8*1024, argonTime, argonThreads, argonKeyLen), "secret", true, true},
+		{"fewer passes", phc("secret", argon2.Version, argonMemory, 1, argonThreads, argonKeyLen), "secret", true, true},
+		{"more lanes", phc("secret", argon2.Version, argonMemory, argonTime, 2, argonKeyLen), "secret", true, true},
+		{"shorter key", phc("secret", argon2.Version, argonMemory, argonTime, argonThreads, 16), "secret", true, true},
+		{"wrong password, old parameters", phc("secret", argon2.Version, 8*1024, 1, 1, 32), "other", false, false},
+		{"empty hash", "", "secret", false, false},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", "secret", false, false},
+		{"argon2i", replace(1, "argon2i"), "secret", false, false},
+		{"other version", replace(2, "v=16"), "secret", false, false},
+		{"no version", replace(2, "19"), "secret", false, false},
+		{"bad parameters", replace(3, "m=19456,t=2"), "secret", false, false},
+		{"bad salt", replace(4, "not base64!"), "secret", false, false},
+		{"bad key", replace(5, "not base64!"), "secret", false, false},
+		{"empty key", replace(5, ""), "secret", false, false},
+		{"extra part", current + "$x", "secret", false, false},
+		{"missing part", strings.Join(parts[:5], "$"), "secret", false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, rehash := VerifyPassword(tc.hash, tc.password)
+			if ok != tc.wantOK || rehash != tc.wantRehash {
+				t.Errorf("VerifyPassword = %v, %v, want %v, %v", ok, rehash, tc.wantOK, tc.wantRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Package auth holds the identities and roles requests are authorized with,
+// and verification of the bearer tokens that carry them.
+package auth
+
+import "strconv"
+
+// Roles, from least to most privileged. Each role can do everything the ones
+// before it can.
+const (
+	// RoleReader may read users, their history and the change feeds.
+	RoleReader = "reader"
+	// RoleEditor may also change the user it is linked to.
+	RoleEditor = "editor"
+	// RoleAdmin may change any user and use the admin endpoints.
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role, least privileged first.
+var Roles = []string{RoleReader, RoleEditor, RoleAdmin}
+
+// RoleSelf is the role of the tokens issued at login. It stands outside Roles:
+// it includes none of them, and only lets the caller read and change the user
+// it is linked to. API keys cannot have it.
+const RoleSelf = "self"
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	return roleRank(role) >= 0
+}
+
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Authentication methods a Principal can come from.
+const (
+	MethodAPIKey     = "api_key"
+	MethodJWT        = "jwt"
+	MethodAdminToken = "admin_token"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Method is how the caller authenticated, one of the Method* constants.
+	Method string
+	// Subject identifies the caller within Method: the API key id or the JWT
+	// subject.
+	Subject string
+	Role    string
+	// UserID is the user the caller acts as, if any; editors may only change
+	// that user.
+	UserID *uint
+	// SessionID is the login session a token was issued for, if any; the
+	// token stops working when the session is revoked.
+	SessionID *uint
+}
+
+// Has reports whether the principal's role includes role.
+func (p Principal) Has(role string) bool {
+	have := roleRank(p.Role)
+	return have >= 0 && have >= roleRank(role)
+}
+
+// CanEdit reports whether the principal may change user id: admins may change
+// anyone, editors and self tokens only the user they are linked to.
+func (p Principal) CanEdit(id uint) bool {
+	if p.Has(RoleAdmin) {
+		return true
+	}
+	return (p.Has(RoleEditor) || p.Role == RoleSelf) && p.IsUser(id)
+}
+
+// IsUser reports whether the principal is linked to user id.
+func (p Principal) IsUser(id uint) bool {
+	return p.UserID != nil && *p.UserID == id
+}
+
+// Actor names the principal in audit records, e.g. "api_key:3" or
+// "jwt:auth0|42".
+func (p Principal) Actor() string {
+	return p.Method + ":" + p.Subject
+}
+
+// KeySubject is the Subject of a principal authenticated with API key id.
+func KeySubject(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
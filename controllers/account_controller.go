@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/mailer"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Login exchanges a username or email and password for a new session: an
+// access token (a JWT with the self role, which may only read and change the
+// user it was issued for) and a refresh token for the next one. Once the account or the client address has failed
+// LOGIN_CAPTCHA_AFTER times, the login also needs a challenge_id; without one
+// it answers 428 captcha_required.
+// @Summary Log in
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body v1.LoginRequest true "Credentials"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.TokenResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse "invalid_credentials"
+// @Failure 428 {object} controllers.ErrorResponse "captcha_required"
+// @Failure 503 {object} controllers.ErrorResponse "login_unavailable without JWT_SECRET"
+// @Router /api/v1/auth/login [post]
+func Login(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	if !services.Tokens.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, "login_unavailable")
+		return
+	}
+	var req v1.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+
+	db := initializers.DB
+	name := strings.TrimSpace(req.Login)
+	var user models.User
+	err := db.Where("username_canonical = ? OR email_canonical = ?", identity.Username(name), identity.Email(name)).
+		First(&user).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, "login_failed")
+		return
+	}
+	accountKey := services.LoginNameKey(identity.Username(name))
+	if found {
+		accountKey = services.AccountKey(user.ID)
+	}
+	keys := []string{accountKey, services.ClientKey(c.ClientIP())}
+
+	needCaptcha, err := services.Logins.NeedsCaptcha(db, keys...)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "login_failed")
+		return
+	}
+	if needCaptcha {
+		if req.ChallengeID == "" {
+			respondError(c, http.StatusPreconditionRequired, "captcha_required")
+			return
+		}
+		if err := services.Arcaptcha.ValidateChallenge(req.ChallengeID); err != nil {
+			respondCaptchaError(c, err)
+			return
+		}
+	}
+
+	var valid, rehash bool
+	if found && user.PasswordHash != "" {
+		valid, rehash = auth.VerifyPassword(user.PasswordHash, req.Password)
+	} else {
+		auth.BurnPasswordCheck(req.Password)
+	}
+	if !valid {
+		if err := services.Logins.RecordFailure(db, keys...); err != nil {
+			log.Printf("login: recording failure: %v", err)
+		}
+		respondError(c, http.StatusUnauthorized, "invalid_credentials")
+		return
+	}
+
+	if err := services.Logins.Clear(db, accountKey); err != nil {
+		log.Printf("login: clearing failures: %v", err)
+	}
+	if rehash {
+		if err := services.SetPassword(db, user.ID, req.Password); err != nil {
+			log.Printf("login: rehashing password of user %d: %v", user.ID, err)
+		}
+	}
+	grant, err := services.Sessions.Start(db, user.ID, sessionMeta(c, req.Device))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "login_failed")
+		return
+	}
+	respondTokens(c, user, grant, cal)
+}
+
+// ChangePassword sets a user's password. The current password is required,
+// except for admins changing someone else's password and for users that have
+// none yet. Every other session of the user is logged out.
+// @Summary Change password
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param payload body v1.ChangePasswordRequest true "Passwords"
+// @Success 204
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse "invalid_credentials: wrong current password"
+// @Failure 403 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/password [post]
+func ChangePassword(c *gin.Context) {
+	var req v1.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	var user models.User
+	if err := initializers.DB.First(&user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "password_change_failed")
+		return
+	}
+	if errs := validation.ValidatePassword("new_password", req.NewPassword, user.Username, user.Email); len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+
+	principal, _ := currentPrincipal(c)
+	self := principal.UserID != nil && *principal.UserID == user.ID
+	if user.PasswordHash != "" && (self || !principal.Has(auth.RoleAdmin)) {
+		if ok, _ := auth.VerifyPassword(user.PasswordHash, req.CurrentPassword); !ok {
+			respondError(c, http.StatusUnauthorized, "invalid_credentials", "current_password is wrong")
+			return
+		}
+	}
+
+	if err := services.SetPassword(initializers.DB, user.ID, req.NewPassword); err != nil {
+		respondError(c, http.StatusInternalServerError, "password_change_failed")
+		return
+	}
+	if err := services.Logins.Clear(initializers.DB, services.AccountKey(user.ID)); err != nil {
+		log.Printf("password change: clearing login failures: %v", err)
+	}
+	var keep uint
+	if self && principal.SessionID != nil {
+		keep = *principal.SessionID
+	}
+	if _, err := services.Sessions.RevokeAll(initializers.DB, user.ID, keep, models.SessionPasswordChanged); err != nil {
+		log.Printf("password change: revoking sessions of user %d: %v", user.ID, err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RequestPasswordReset mails a single-use reset token to the user with the
+// given email. The answer is 202 whether or not such a user exists, so it can
+// not be used to find out which emails are registered.
+// @Summary Request password reset
+// @Tags auth
+// @Accept json
+// @Param payload body v1.PasswordResetRequest true "Email and captcha"
+// @Success 202
+// @Failure 400 {object} controllers.ErrorResponse
+// @Router /api/v1/auth/password-reset [post]
+func RequestPasswordReset(c *gin.Context) {
+	var req v1.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	if err := services.Arcaptcha.ValidateChallenge(req.ChallengeID); err != nil {
+		respondCaptchaError(c, err)
+		return
+	}
+
+	var user models.User
+	err := initializers.DB.Where("email_canonical = ?", identity.Email(strings.TrimSpace(req.Email))).First(&user).Error
+	if err == nil {
+		token, err := services.IssuePasswordReset(initializers.DB, user.ID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "password_reset_failed")
+			return
+		}
+		msg := passwordResetMail(requestLanguage(c), user, token)
+		// Sent in the background so the response time does not reveal
+		// whether the email is registered.
+		go func() {
+			if err := services.Mailer.Send(context.Background(), msg); err != nil {
+				log.Printf("password reset: mailing user %d: %v", user.ID, err)
+			}
+		}()
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, "password_reset_failed")
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ConfirmPasswordReset sets a new password with a token from the reset mail
+// and logs the user out everywhere.
+// @Summary Reset password
+// @Tags auth
+// @Accept json
+// @Param payload body v1.PasswordResetConfirmRequest true "Token and new password"
+// @Success 204
+// @Failure 400 {object} controllers.ErrorResponse "invalid_reset_token or validation errors"
+// @Router /api/v1/auth/password-reset/confirm [post]
+func ConfirmPasswordReset(c *gin.Context) {
+	var req v1.PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	if errs := validation.ValidatePassword("new_password", req.NewPassword, "", ""); len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+	userID, err := services.ResetPassword(initializers.DB, req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			respondError(c, http.StatusBadRequest, "invalid_reset_token")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "password_reset_failed")
+		return
+	}
+	if err := services.Logins.Clear(initializers.DB, services.AccountKey(userID)); err != nil {
+		log.Printf("password reset: clearing login failures: %v", err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// passwordResetMail renders the reset mail in lang. PASSWORD_RESET_URL, e.g.
+// https://app.example.com/reset?token={token}, turns the token into a link.
+func passwordResetMail(lang string, user models.User, token string) mailer.Message {
+	link := token
+	if tmpl := os.Getenv("PASSWORD_RESET_URL"); tmpl != "" {
+		link = strings.ReplaceAll(tmpl, "{token}", token)
+	}
+	params := i18n.Params{"username": user.Username, "link": link}
+	return mailer.Message{
+		To:      user.Email,
+		Subject: i18n.Translate(lang, "mail.password_reset.subject", params),
+		Body:    i18n.Translate(lang, "mail.password_reset.body", params),
+	}
+}
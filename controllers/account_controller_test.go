@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/argon2"
+)
+
+func TestLogin(t *testing.T) {
+	savedDB, savedTokens, savedLogins := initializers.DB, services.Tokens, services.Logins
+	t.Cleanup(func() { initializers.DB, services.Tokens, services.Logins = savedDB, savedTokens, savedLogins })
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.LoginFailure{}, &models.UserSession{}, &models.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+	initializers.DB = db
+	verifier := &auth.JWTVerifier{Secret: []byte("test secret"), Now: time.Now}
+	services.Tokens = &services.TokenIssuer{Verifier: verifier, TTL: time.Hour}
+	services.Logins = &services.LoginGuard{Threshold: 2, Window: time.Hour}
+
+	// Alice's hash uses weaker parameters than HashPassword's, so her first
+	// login replaces it.
+	salt := []byte("0123456789abcdef")
+	oldHash := fmt.Sprintf("$argon2id$v=19$m=8192,t=1,p=1$%s$%s", base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("alice password"), salt, 1, 8192, 1, 32)))
+	alice := models.User{Username: "Alice", Email: "alice@example.com", PasswordHash: oldHash}
+	bob := models.User{Username: "bob", Email: "bob@example.com"}
+	for _, u := range []*models.User{&alice, &bob} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	bobHash, _ := auth.HashPassword("bob password")
+	if err := db.Model(&bob).UpdateColumn("password_hash", bobHash).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/login", Login)
+	login := func(ip string, body interface{}) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(string(raw)))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	code := func(w *httptest.ResponseRecorder) string {
+		var p struct{ Code string }
+		_ = json.Unmarshal(w.Body.Bytes(), &p)
+		return p.Code
+	}
+
+	// A successful login by email starts a session for the user and upgrades
+	// the old hash.
+	w := login("192.0.2.1", v1.LoginRequest{Login: "ALICE@example.com", Password: "alice password", Device: "laptop"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp v1.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(resp.Data.AccessToken)
+	if err != nil || claims.Role != auth.RoleSelf || claims.UserID == nil || *claims.UserID != alice.ID ||
+		claims.SessionID == nil || *claims.SessionID != resp.Data.SessionID {
+		t.Errorf("token claims = %+v, %v, want self for user %d in session %d", claims, err, alice.ID, resp.Data.SessionID)
+	}
+	if resp.Data.TokenType != "Bearer" || resp.Data.User.ID != alice.ID || resp.Data.RefreshToken == "" {
+		t.Errorf("token = %+v", resp.Data)
+	}
+	var session models.UserSession
+	if err := db.First(&session, resp.Data.SessionID).Error; err != nil || session.UserID != alice.ID ||
+		session.Device != "laptop" || session.IP != "192.0.2.1" {
+		t.Errorf("session = %+v, %v", session, err)
+	}
+	var stored models.User
+	db.First(&stored, alice.ID)
+	if stored.PasswordHash == oldHash {
+		t.Error("the outdated hash was not replaced")
+	}
+	if ok, rehash := auth.VerifyPassword(stored.PasswordHash, "alice password"); !ok || rehash {
+		t.Errorf("rehashed password: VerifyPassword = %v, %v, want true, false", ok, rehash)
+	}
+
+	// Wrong passwords and unknown names both get invalid_credentials, until
+	// the account or the client needs a captcha.
+	for _, step := range []struct {
+		ip       string
+		req      v1.LoginRequest
+		want     int
+		wantCode string
+	}{
+		{"192.0.2.2", v1.LoginRequest{Login: "bob", Password: "wrong"}, http.StatusUnauthorized, "invalid_credentials"},
+		{"192.0.2.3", v1.LoginRequest{Login: "nobody", Password: "bob password"}, http.StatusUnauthorized, "invalid_credentials"},
+		{"192.0.2.3", v1.LoginRequest{Login: "bob"}, http.StatusBadRequest, "invalid_payload"},
+		{"192.0.2.2", v1.LoginRequest{Login: "BOB", Password: "wrong"}, http.StatusUnauthorized, "invalid_credentials"},
+		// Bob's account has failed twice, from any address.
+		{"192.0.2.4", v1.LoginRequest{Login: "bob", Password: "bob password"}, http.StatusPreconditionRequired, "captcha_required"},
+		{"192.0.2.4", v1.LoginRequest{Login: "bob", Password: "bob password", ChallengeID: "unknown"}, http.StatusBadRequest, ""},
+		{"192.0.2.4", v1.LoginRequest{Login: "bob", Password: "bob password", ChallengeID: services.Arcaptcha.GenerateChallenge()}, http.StatusOK, ""},
+		// The success cleared the account but not the address that failed.
+		{"192.0.2.4", v1.LoginRequest{Login: "bob", Password: "bob password"}, http.StatusOK, ""},
+		{"192.0.2.2", v1.LoginRequest{Login: "alice", Password: "alice password"}, http.StatusPreconditionRequired, "captcha_required"},
+	} {
+		w := login(step.ip, step.req)
+		if w.Code != step.want || (step.wantCode != "" && code(w) != step.wantCode) {
+			t.Errorf("login %s as %q from %s: %d %s, want %d %s", step.req.Password, step.req.Login, step.ip,
+				w.Code, code(w), step.want, step.wantCode)
+		}
+	}
+
+	services.Tokens = &services.TokenIssuer{}
+	if w := login("192.0.2.5", v1.LoginRequest{Login: "bob", Password: "bob password"}); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("login without JWT_SECRET: status = %d, want 503", w.Code)
+	}
+}
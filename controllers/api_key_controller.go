@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateAPIKey issues an API key. The response is the only one that includes
+// the key.
+// @Summary Create API key
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param payload body v1.APIKeyRequest true "Key"
+// @Success 201 {object} v1.APIKeyResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req v1.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if errs := validateAPIKey(initializers.DB, req); len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+
+	key, secret, err := services.CreateAPIKey(initializers.DB, req.Name, req.Role, req.UserID, req.ExpiresAt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "api_key_failed")
+		return
+	}
+	out := v1.NewAPIKey(key)
+	out.Key = secret
+	c.JSON(http.StatusCreated, v1.APIKeyResponse{Data: out})
+}
+
+// ListAPIKeys lists every API key, revoked ones included.
+// @Summary List API keys
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} v1.APIKeyListResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/api-keys [get]
+func ListAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := initializers.DB.Order("id").Find(&keys).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "api_key_failed")
+		return
+	}
+	items := make([]v1.APIKey, len(keys))
+	for i, key := range keys {
+		items[i] = v1.NewAPIKey(key)
+	}
+	c.JSON(http.StatusOK, v1.APIKeyListResponse{Data: items})
+}
+
+// RevokeAPIKey stops a key from authenticating. The key stays listed with its
+// revoked_at time.
+// @Summary Revoke API key
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} v1.APIKeyResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "api_key_not_found")
+		return
+	}
+	key, err := services.RevokeAPIKey(initializers.DB, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "api_key_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "api_key_failed")
+		return
+	}
+	c.JSON(http.StatusOK, v1.APIKeyResponse{Data: v1.NewAPIKey(key)})
+}
+
+// validateAPIKey checks a new key: a name, a known role, an existing user and
+// an expiry in the future.
+func validateAPIKey(db *gorm.DB, req v1.APIKeyRequest) validation.Errors {
+	var errs validation.Errors
+	switch {
+	case req.Name == "":
+		errs = append(errs, validation.NewFieldError("name", validation.CodeRequired, nil))
+	case len([]rune(req.Name)) > 100:
+		errs = append(errs, validation.NewFieldError("name", validation.CodeTooLong, i18n.Params{"max": 100}))
+	}
+	switch {
+	case req.Role == "":
+		errs = append(errs, validation.NewFieldError("role", validation.CodeRequired, nil))
+	case !auth.ValidRole(req.Role):
+		errs = append(errs, validation.NewFieldError("role", validation.CodeNotAllowed, i18n.Params{"allowed": strings.Join(auth.Roles, ", ")}))
+	}
+	if req.UserID != nil {
+		var count int64
+		if err := db.Model(&models.User{}).Where("id = ?", *req.UserID).Count(&count).Error; err != nil || count == 0 {
+			errs = append(errs, validation.NewFieldError("user_id", validation.CodeInvalidFormat, nil))
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errs = append(errs, validation.NewFieldError("expires_at", validation.CodeInvalidFormat, nil))
+	}
+	return errs
+}
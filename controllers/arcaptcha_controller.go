@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
 	"github.com/amirkhgraphic/go-arcaptcha-service/services"
 	"github.com/gin-gonic/gin"
 )
@@ -16,28 +17,30 @@ func GenerateFakeChallenge(c *gin.Context) {
 	token := services.Arcaptcha.GenerateChallenge()
 	c.JSON(http.StatusOK, gin.H{
 		"challenge_id": token,
-		"note":         "Use this challenge_id in protected requests. Suffix -neterr to simulate network errors.",
+		"note":         i18n.Translate(requestLanguage(c), "challenge_note", nil),
 	})
 }
 
-// VerifyFakeChallenge lets you check a token without consuming it.
+// VerifyFakeChallenge lets you check a token without consuming it. An unknown or
+// used token is a 400 problem, a simulated network error a 503.
 // @Summary Verify a fake arcaptcha challenge
 // @Accept json
 // @Produce json
 // @Param payload body controllers.ChallengeVerifyRequest true "challenge_id"
 // @Success 200 {object} controllers.ChallengeVerifyResponse
 // @Failure 400 {object} controllers.ErrorResponse
+// @Failure 503 {object} controllers.ErrorResponse
 // @Router /__fake/arcaptcha/verify [post]
 func VerifyFakeChallenge(c *gin.Context) {
 	var body ChallengeVerifyRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		respondError(c, http.StatusBadRequest, "invalid_payload")
 		return
 	}
 
 	err := services.Arcaptcha.PeekChallenge(body.ChallengeID)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"valid": false, "error": err.Error()})
+		respondCaptchaError(c, err)
 		return
 	}
 
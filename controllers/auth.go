@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// apiKeyHeader is an alternative to sending an API key as a bearer token.
+	apiKeyHeader = "X-API-Key"
+	// principalKey is the gin context key the authenticated caller is stored under.
+	principalKey = "principal"
+)
+
+// Authenticate identifies the caller from an API key (X-API-Key, or a bearer
+// token starting with ak_), a bearer JWT checked by verifier, or the bearer
+// ADMIN_TOKEN. JWTs issued at login only work while their session is active.
+// Requests without credentials continue anonymously and are turned away by
+// RequireRole where a role is needed; invalid credentials are rejected straight
+// away rather than treated as anonymous.
+func Authenticate(verifier *auth.JWTVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := c.GetHeader(apiKeyHeader)
+		isKey := credential != ""
+		if !isKey {
+			header := c.GetHeader("Authorization")
+			if header == "" {
+				c.Next()
+				return
+			}
+			scheme, token, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				respondUnauthorized(c, "use Authorization: Bearer <token> or X-API-Key")
+				return
+			}
+			credential, isKey = token, services.IsAPIKey(token)
+		}
+
+		var principal auth.Principal
+		switch {
+		case isKey:
+			key, err := services.AuthenticateAPIKey(initializers.DB, credential)
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				respondUnauthorized(c, "API key is unknown, revoked or expired")
+				return
+			}
+			if err != nil {
+				log.Printf("auth: checking API key: %v", err)
+				respondError(c, http.StatusInternalServerError, "internal_error")
+				return
+			}
+			principal = auth.Principal{Method: auth.MethodAPIKey, Subject: auth.KeySubject(key.ID), Role: key.Role, UserID: key.UserID}
+		case isAdminToken(credential):
+			principal = auth.Principal{Method: auth.MethodAdminToken, Subject: "env", Role: auth.RoleAdmin}
+		default:
+			claims, err := verifier.Verify(credential)
+			if err != nil {
+				respondUnauthorized(c, err.Error())
+				return
+			}
+			principal = claims.Principal()
+			if principal.SessionID != nil {
+				active, err := services.Sessions.Active(initializers.DB, *principal.SessionID)
+				if err != nil {
+					log.Printf("auth: checking session: %v", err)
+					respondError(c, http.StatusInternalServerError, "internal_error")
+					return
+				}
+				if !active {
+					respondUnauthorized(c, "the session of this token has ended")
+					return
+				}
+			}
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// isAdminToken reports whether token is ADMIN_TOKEN. It is a permanent admin
+// credential for as long as the variable is set; issuing API keys does not turn
+// it off, so operators unset it once the first admin key exists.
+func isAdminToken(token string) bool {
+	admin := os.Getenv("ADMIN_TOKEN")
+	return admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+}
+
+// RequireRole lets the request through only for a caller holding role (or a
+// higher one).
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := currentPrincipal(c)
+		if !ok {
+			respondUnauthorized(c, "")
+			return
+		}
+		if !principal.Has(role) {
+			respondError(c, http.StatusForbidden, "forbidden", "requires the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireReaderOrSelf guards reads of /users/:id: readers may read any user,
+// self tokens only their own.
+func RequireReaderOrSelf() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := currentPrincipal(c)
+		if !ok {
+			respondUnauthorized(c, "")
+			return
+		}
+		if principal.Has(auth.RoleReader) {
+			c.Next()
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || principal.Role != auth.RoleSelf || !principal.IsUser(uint(id)) {
+			respondError(c, http.StatusForbidden, "forbidden", "requires the "+auth.RoleReader+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelfOrAdmin guards writes to /users/:id: admins may change any user,
+// everyone else only the user their credential is linked to.
+func RequireSelfOrAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := currentPrincipal(c)
+		if !ok {
+			respondUnauthorized(c, "")
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || !principal.CanEdit(uint(id)) {
+			respondError(c, http.StatusForbidden, "forbidden", "you may only change your own user")
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentPrincipal is the caller Authenticate identified, if any.
+func currentPrincipal(c *gin.Context) (auth.Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return auth.Principal{}, false
+	}
+	principal, ok := v.(auth.Principal)
+	return principal, ok
+}
+
+func respondUnauthorized(c *gin.Context, detail string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	if detail == "" {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	respondError(c, http.StatusUnauthorized, "unauthorized", detail)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/jalali"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	calendarGregorian = "gregorian"
+	calendarJalali    = "jalali"
+)
+
+// errUnsupportedCalendar is returned by requestCalendar for an unknown calendar.
+var errUnsupportedCalendar = errors.New("unsupported calendar")
+
+// requestCalendar picks the calendar for dates in the response and for date-only
+// filter values: the calendar query param, else the Accept-Calendar header, else
+// gregorian. Responses vary on the header, so it is always listed in Vary.
+func requestCalendar(c *gin.Context) (string, error) {
+	c.Writer.Header().Add("Vary", "Accept-Calendar")
+	switch cal := strings.ToLower(strings.TrimSpace(rawCalendar(c))); cal {
+	case "", calendarGregorian:
+		return calendarGregorian, nil
+	case calendarJalali, "persian", "solar-hijri":
+		return calendarJalali, nil
+	default:
+		return "", errUnsupportedCalendar
+	}
+}
+
+func rawCalendar(c *gin.Context) string {
+	if raw := c.Query("calendar"); raw != "" {
+		return raw
+	}
+	return c.GetHeader("Accept-Calendar")
+}
+
+// resolveCalendar is requestCalendar for handlers: it answers 400 itself and
+// reports whether the handler may continue.
+func resolveCalendar(c *gin.Context) (string, bool) {
+	cal, err := requestCalendar(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "unsupported_calendar", fmt.Sprintf("calendar %q is not supported", rawCalendar(c)))
+		return "", false
+	}
+	return cal, true
+}
+
+// userDTO maps user to the v1 contract, with Jalali timestamps in the jalali
+// calendar.
+func userDTO(user models.User, cal string) v1.User {
+	return v1.NewUser(user, cal == calendarJalali)
+}
+
+// parseCalendarDate reads a date-only filter value in the request calendar and
+// returns the start of that day and of the next one. Jalali days start at
+// midnight in jalali.Location(); Gregorian days at midnight UTC.
+func parseCalendarDate(raw, cal string) (time.Time, time.Time, error) {
+	if cal == calendarJalali {
+		d, err := jalali.Parse(raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start, _ := d.Time(jalali.Location())
+		return start, start.AddDate(0, 0, 1), nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return t, t.AddDate(0, 0, 1), nil
+}
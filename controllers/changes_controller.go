@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/gin-gonic/gin"
+)
+
+// changesToken is the decoded form of a sync token: the change sequence number
+// the client is up to date with.
+type changesToken struct {
+	Seq uint64 `json:"seq"`
+}
+
+func encodeChangesToken(seq uint64) string {
+	raw, _ := json.Marshal(changesToken{Seq: seq})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeChangesToken only accepts what encodeChangesToken produces, so other
+// tokens (such as list cursors) are not read as since=0.
+func decodeChangesToken(token string) (uint64, error) {
+	var tok struct {
+		Seq *uint64 `json:"seq"`
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tok); err != nil || tok.Seq == nil || dec.More() {
+		return 0, errInvalidCursor
+	}
+	return *tok.Seq, nil
+}
+
+// UserChanges is the incremental sync feed. It returns the users whose change
+// sequence number is past the since token, in sequence order, each once with
+// its current state, and deleted users as tombstones. Without since it starts
+// from the beginning and leaves out deleted users. Clients call it again with
+// meta.next_token while meta.has_more is set, then keep the last token for the
+// next sync.
+// @Summary Sync feed of changed users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param since query string false "token from a previous call's meta.next_token"
+// @Param page_size query int false "changes per page (default 100, max 500)"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.UserChangesResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/changes [get]
+func UserChanges(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "100"), 100)
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	var since uint64
+	initial := true
+	if raw := strings.TrimSpace(c.Query("since")); raw != "" {
+		seq, err := decodeChangesToken(raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_cursor", "since is not a token issued by this endpoint")
+			return
+		}
+		since, initial = seq, false
+	}
+
+	tx := initializers.DB.Unscoped().Where("change_seq > ?", since)
+	if initial {
+		tx = tx.Where("deleted_at IS NULL")
+	}
+	var users []models.User
+	if err := tx.Order("change_seq").Limit(pageSize + 1).Find(&users).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "users_fetch_failed")
+		return
+	}
+	hasMore := len(users) > pageSize
+	if hasMore {
+		users = users[:pageSize]
+	}
+
+	items := make([]v1.UserChange, len(users))
+	next := since
+	for i, u := range users {
+		next = u.ChangeSeq
+		if u.DeletedAt.Valid {
+			deletedAt := u.DeletedAt.Time
+			items[i] = v1.UserChange{ID: u.ID, Deleted: true, DeletedAt: &deletedAt}
+			continue
+		}
+		hideUnapprovedBio(c, &u)
+		dto := userDTO(u, cal)
+		items[i] = v1.UserChange{ID: u.ID, User: &dto}
+	}
+
+	c.JSON(http.StatusOK, v1.UserChangesResponse{
+		Data: items,
+		Meta: v1.ChangesMeta{NextToken: encodeChangesToken(next), HasMore: hasMore, PageSize: pageSize},
+	})
+}
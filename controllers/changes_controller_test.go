@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeChangesToken(t *testing.T) {
+	for _, seq := range []uint64{0, 1, 42, 1 << 53} {
+		got, err := decodeChangesToken(encodeChangesToken(seq))
+		if err != nil || got != seq {
+			t.Errorf("decodeChangesToken(encodeChangesToken(%d)) = %d, %v", seq, got, err)
+		}
+	}
+
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	cases := map[string]string{
+		"not base64":    "!!!",
+		"not json":      b64("seq=1"),
+		"no seq":        b64(`{}`),
+		"null seq":      b64(`{"seq":null}`),
+		"negative seq":  b64(`{"seq":-1}`),
+		"string seq":    b64(`{"seq":"1"}`),
+		"list cursor":   b64(`{"s":"created_at desc","v":"2024-03-20T10:00:00Z","id":7}`),
+		"trailing data": b64(`{"seq":1}{"seq":2}`),
+	}
+	for name, token := range cases {
+		if _, err := decodeChangesToken(token); err != errInvalidCursor {
+			t.Errorf("%s: decodeChangesToken() error = %v, want errInvalidCursor", name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// dryRunHeader marks the responses of dry runs, including their errors.
+const dryRunHeader = "Dry-Run"
+
+// errDryRun rolls back the transaction of a dry run after the write succeeded.
+var errDryRun = errors.New("dry run")
+
+// requestDryRun reads the dry_run query param. A dry run goes through binding,
+// validation, the captcha check (without consuming the challenge) and the write
+// itself, which is then rolled back, so the response is the one the real request
+// would get.
+func requestDryRun(c *gin.Context) (bool, error) {
+	raw, ok := c.GetQuery("dry_run")
+	if !ok {
+		return false, nil
+	}
+	dry, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, err
+	}
+	if dry {
+		c.Header(dryRunHeader, "true")
+	}
+	return dry, nil
+}
+
+// checkChallenge validates the captcha challenge, consuming it unless dry.
+func checkChallenge(challengeID string, dry bool) error {
+	if dry {
+		return services.Arcaptcha.PeekChallenge(challengeID)
+	}
+	return services.Arcaptcha.ValidateChallenge(challengeID)
+}
+
+// writeUser runs fn in a transaction that is committed, or rolled back when dry.
+// Either way fn's own error is returned and a successful dry run returns nil.
+func writeUser(dry bool, fn func(tx *gorm.DB) error) error {
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if dry {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
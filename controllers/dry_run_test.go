@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+func TestWriteUser(t *testing.T) {
+	saved := initializers.DB
+	t.Cleanup(func() { initializers.DB = saved })
+	initializers.DB = testDB(t)
+
+	errWrite := errors.New("write failed")
+	cases := []struct {
+		name    string
+		dry     bool
+		fail    bool
+		wantErr error
+		wantRow bool
+	}{
+		{"write", false, false, nil, true},
+		{"dry run", true, false, nil, false},
+		{"failed write", false, true, errWrite, false},
+		{"failed dry run", true, true, errWrite, false},
+	}
+	for _, tc := range cases {
+		username := "user_" + tc.name
+		err := writeUser(tc.dry, func(tx *gorm.DB) error {
+			if err := tx.Create(&models.User{Username: username, Email: username + "@example.com"}).Error; err != nil {
+				return err
+			}
+			if tc.fail {
+				return errWrite
+			}
+			return nil
+		})
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: writeUser() error = %v, want %v", tc.name, err, tc.wantErr)
+		}
+		var n int64
+		if err := initializers.DB.Model(&models.User{}).Where("username = ?", username).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if (n == 1) != tc.wantRow {
+			t.Errorf("%s: %d rows written, want row = %v", tc.name, n, tc.wantRow)
+		}
+	}
+}
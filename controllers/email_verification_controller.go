@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/mailer"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// VerifyEmail marks a user's email as verified with the token from the
+// verification mail. Tokens for an email the user has since changed are
+// rejected; verifying twice is harmless.
+// @Summary Verify email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body v1.VerifyEmailRequest true "Token from the mail"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.UserResponse
+// @Failure 400 {object} controllers.ErrorResponse "invalid_verification_token"
+// @Router /api/v1/users/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	var req v1.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	userID, email, err := services.EmailVerification.Parse(strings.TrimSpace(req.Token))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_verification_token")
+		return
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusBadRequest, "invalid_verification_token")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "email_verification_failed")
+		return
+	}
+	if user.EmailCanonical != email {
+		respondError(c, http.StatusBadRequest, "invalid_verification_token", "the email of the user has changed since the token was sent")
+		return
+	}
+
+	if !user.EmailVerified {
+		before := user
+		err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.User{}).
+				Where("id = ? AND version = ?", user.ID, user.Version).
+				Updates(map[string]interface{}{
+					"email_verified":    true,
+					"email_verified_at": time.Now(),
+					"version":           gorm.Expr("version + 1"),
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errStaleVersion
+			}
+			if err := tx.First(&user, user.ID).Error; err != nil {
+				return err
+			}
+			return services.RecordUserRevision(tx, models.RevisionVerify, before, user, revisionContext(c, nil))
+		})
+		if errors.Is(err, errStaleVersion) {
+			respondError(c, http.StatusConflict, "concurrent_update")
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "email_verification_failed")
+			return
+		}
+	}
+	c.Header("ETag", user.ETag())
+	c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
+}
+
+// ResendVerificationEmail mails a new verification link to the user with the
+// given email, unless it is verified already or got one within
+// EMAIL_VERIFICATION_RESEND_COOLDOWN. The answer is 202 either way, so it can
+// not be used to find out which emails are registered. Each client address may
+// ask EMAIL_VERIFICATION_RESEND_LIMIT times per window before getting 429.
+// @Summary Resend verification email
+// @Tags auth
+// @Accept json
+// @Param payload body v1.ResendVerificationRequest true "Email and captcha"
+// @Success 202
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 429 {object} controllers.ErrorResponse "too_many_requests"
+// @Header 429 {integer} Retry-After "seconds until the limit resets"
+// @Router /api/v1/users/verify-email/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	var req v1.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	db := initializers.DB
+	verifier := services.EmailVerification
+	allowed, retry, err := verifier.PerClient.Hit(db, services.VerificationClientKey(c.ClientIP()))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "email_verification_failed")
+		return
+	}
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		respondError(c, http.StatusTooManyRequests, "too_many_requests")
+		return
+	}
+	if err := services.Arcaptcha.ValidateChallenge(req.ChallengeID); err != nil {
+		respondCaptchaError(c, err)
+		return
+	}
+
+	var user models.User
+	err = db.Where("email_canonical = ?", identity.Email(strings.TrimSpace(req.Email))).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "email_verification_failed")
+		return
+	case !user.EmailVerified:
+		allowed, _, err := verifier.PerUser.Hit(db, services.VerificationUserKey(user.ID))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "email_verification_failed")
+			return
+		}
+		if allowed {
+			sendVerificationMail(c, user)
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// sendVerificationMail mails user a link to verify its current email, in the
+// background so the response does not wait for the mailer.
+func sendVerificationMail(c *gin.Context, user models.User) {
+	token := services.EmailVerification.Token(user)
+	msg := verificationMail(requestLanguage(c), user, token)
+	go func() {
+		if err := services.Mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("email verification: mailing user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+// verificationMail renders the verification mail in lang.
+// EMAIL_VERIFICATION_URL, e.g. https://app.example.com/verify?token={token},
+// turns the token into a link.
+func verificationMail(lang string, user models.User, token string) mailer.Message {
+	link := token
+	if tmpl := os.Getenv("EMAIL_VERIFICATION_URL"); tmpl != "" {
+		link = strings.ReplaceAll(tmpl, "{token}", token)
+	}
+	params := i18n.Params{"username": user.Username, "link": link}
+	return mailer.Message{
+		To:      user.Email,
+		Subject: i18n.Translate(lang, "mail.verify_email.subject", params),
+		Body:    i18n.Translate(lang, "mail.verify_email.body", params),
+	}
+}
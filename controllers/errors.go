@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/middlewares"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mimeProblem = "application/problem+json"
+	// problemTypeBase prefixes the code to form a problem's type URI.
+	problemTypeBase = "/problems/"
+)
+
+// problem is the RFC 7807 body of every error response. Code is the stable
+// identifier from the i18n catalog (and the last segment of Type), Title its
+// message in the request language. Detail, when set, is untranslated technical
+// context such as a parser error.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Fields    validation.Errors `json:"fields,omitempty"`
+}
+
+// requestLanguage negotiates the response language from Accept-Language and
+// marks the response as varying on it.
+func requestLanguage(c *gin.Context) string {
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	c.Header("Content-Language", lang)
+	return lang
+}
+
+func newProblem(c *gin.Context, status int, code string) problem {
+	return problem{
+		Type:      problemTypeBase + code,
+		Title:     i18n.Translate(requestLanguage(c), code, nil),
+		Status:    status,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: c.GetString(middlewares.RequestIDKey),
+	}
+}
+
+// send writes p as application/problem+json and stops the handler chain.
+func (p problem) send(c *gin.Context) {
+	c.Header("Content-Type", mimeProblem)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// respondError answers with the problem for code. details, when given, becomes
+// the problem's detail.
+func respondError(c *gin.Context, status int, code string, details ...string) {
+	p := newProblem(c, status, code)
+	if len(details) > 0 {
+		p.Detail = details[0]
+	}
+	p.send(c)
+}
+
+// RouteNotFound is the problem response for unknown routes.
+func RouteNotFound(c *gin.Context) {
+	respondError(c, http.StatusNotFound, "route_not_found")
+}
+
+// MethodNotAllowed is the problem response for a known route hit with the wrong
+// method.
+func MethodNotAllowed(c *gin.Context) {
+	respondError(c, http.StatusMethodNotAllowed, "method_not_allowed")
+}
+
+// RecoverPanic turns a panic (already logged by gin) into a 500 problem.
+func RecoverPanic(c *gin.Context, _ interface{}) {
+	respondError(c, http.StatusInternalServerError, "internal_error")
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etagMatches reports whether etag is listed in an If-Match / If-None-Match header
+// value. "*" matches any current representation. If-None-Match uses the weak
+// comparison from RFC 9110, so a W/ prefix is ignored there; If-Match is strong.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and, when the request's If-None-Match already
+// names it, answers 304 and returns true.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// bodyETag is a weak validator for responses without a single version, such as
+// list pages: it hashes the serialized body.
+func bodyETag(body interface{}) string {
+	raw, _ := json.Marshal(body)
+	sum := sha1.Sum(raw)
+	return `W/"` + hex.EncodeToString(sum[:]) + `"`
+}
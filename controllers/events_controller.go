@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sseHeartbeat keeps idle connections (and proxies) from timing out.
+	sseHeartbeat = 15 * time.Second
+	// sseRetry is the reconnect delay suggested to clients, in milliseconds.
+	sseRetry = 3000
+)
+
+// UserEvents streams user lifecycle events as Server-Sent Events. Each event's
+// id is its position in the event log, so a client reconnecting with
+// Last-Event-ID (or last_event_id, for the first connect of an EventSource)
+// first gets everything it missed and then the live stream. Without it the
+// stream starts at the current end of the log. Clients that cannot keep up, or
+// whose backlog cannot be read, are disconnected and resume the same way.
+// @Summary Stream user events
+// @Description Server-Sent Events: id is the event log position, event the type, data the webhook payload.
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param types query string false "comma separated event types, e.g. user.created,user.deleted"
+// @Param Last-Event-ID header string false "resume after this event id"
+// @Param last_event_id query string false "same as Last-Event-ID"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 503 {object} controllers.ErrorResponse "too many subscribers"
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/events [get]
+func UserEvents(c *gin.Context) {
+	types := splitList(c.Query("types"))
+	for _, t := range types {
+		if !contains(services.EventTypes, t) {
+			respondError(c, http.StatusBadRequest, "invalid_filter",
+				fmt.Sprintf("unknown event type %q, use %s", t, strings.Join(services.EventTypes, ", ")))
+			return
+		}
+	}
+	wanted := func(event models.OutboxEvent) bool {
+		return len(types) == 0 || contains(types, event.Type)
+	}
+
+	resume := false
+	var lastID uint
+	rawLast := c.GetHeader("Last-Event-ID")
+	if rawLast == "" {
+		rawLast = c.Query("last_event_id")
+	}
+	if rawLast != "" {
+		n, err := strconv.ParseUint(rawLast, 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_cursor", "Last-Event-ID must be an event id")
+			return
+		}
+		resume, lastID = true, uint(n)
+	}
+
+	// Subscribe before reading the backlog so nothing falls between the two.
+	sub, err := services.UserEvents.Subscribe()
+	if err != nil {
+		c.Header("Retry-After", "30")
+		respondError(c, http.StatusServiceUnavailable, "too_many_subscribers")
+		return
+	}
+	defer services.UserEvents.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetry); err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	send := func(event models.OutboxEvent) bool {
+		if event.ID <= lastID {
+			return true
+		}
+		lastID = event.ID
+		if !wanted(event) {
+			return true
+		}
+		payload, ok := hideEventBio(c, event)
+		if !ok {
+			return true
+		}
+		_, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+		c.Writer.Flush()
+		return err == nil
+	}
+
+	if resume {
+		for {
+			backlog, err := services.UserEventsSince(initializers.DB, lastID, types, 500)
+			if err != nil {
+				// Close rather than go live with a gap: the client reconnects
+				// with the last id it got and the backlog is read again. The
+				// error event has no id, so it does not move Last-Event-ID.
+				log.Printf("events: reading backlog after #%d: %v", lastID, err)
+				_, _ = fmt.Fprint(c.Writer, "event: error\ndata: {\"code\":\"events_fetch_failed\"}\n\n")
+				c.Writer.Flush()
+				return
+			}
+			if len(backlog) == 0 {
+				break
+			}
+			for _, event := range backlog {
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind (or shutting down): the client
+				// reconnects with Last-Event-ID.
+				return
+			}
+			if !send(event) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
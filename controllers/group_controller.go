@@ -1,49 +1,177 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/jalali"
 	"github.com/amirkhgraphic/go-arcaptcha-service/models"
 	"github.com/gin-gonic/gin"
 )
 
+// timeBuckets are the group_by values that bucket users by creation date rather
+// than by a column.
+var timeBuckets = map[string]bool{
+	"created_year":  true,
+	"created_month": true,
+}
+
 // GroupUsers aggregates users by the specified fields (gender, nationality) directly from the DB.
+// The created_year/created_month buckets follow the request calendar: Gregorian
+// buckets are UTC, Jalali ones start at midnight in jalali.Location().
 // @Summary Group users
-// @Description Aggregate users by gender/nationality
-// @Param group_by query string false "Comma separated fields (gender,nationality)"
+// @Description Aggregate users by gender/nationality and creation year/month
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param group_by query string false "Comma separated fields (gender,nationality,created_year,created_month)"
+// @Param calendar query string false "gregorian (default) or jalali, also read from Accept-Calendar"
 // @Success 200 {object} controllers.GroupUsersResponseDoc
-// @Router /api/users/group [get]
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/group [get]
 func GroupUsers(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+
 	groupBy := parseGroupBy(c.DefaultQuery("group_by", "gender,nationality"))
 	if len(groupBy) == 0 {
 		groupBy = []string{"gender", "nationality"}
 	}
 
-	selectParts := append([]string{}, groupBy...)
-	selectParts = append(selectParts, "count(*) as count")
-	groupClause := strings.Join(groupBy, ", ")
+	var columns []string
+	bucketed := false
+	for _, field := range groupBy {
+		if timeBuckets[field] {
+			bucketed = true
+		} else {
+			columns = append(columns, field)
+		}
+	}
 
 	var rows []map[string]interface{}
-	if err := initializers.DB.Model(&models.User{}).
-		Select(strings.Join(selectParts, ", ")).
-		Group(groupClause).
-		Find(&rows).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not group users"})
+	var err error
+	if bucketed {
+		rows, err = groupUsersByTime(groupBy, columns, cal)
+	} else {
+		selectParts := append([]string{}, groupBy...)
+		selectParts = append(selectParts, "count(*) as count")
+		err = initializers.DB.Model(&models.User{}).
+			Select(strings.Join(selectParts, ", ")).
+			Group(strings.Join(groupBy, ", ")).
+			Find(&rows).Error
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "group_failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"group_by": groupBy,
 		"data":     rows,
-	})
+	}
+	if bucketed {
+		resp["calendar"] = cal
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// groupUsersByTime counts users per combination of the plain columns and the
+// requested date buckets. Calendar months cannot be expressed portably in SQL
+// (Jalali months in particular), so the database groups by column and creation
+// timestamp and the buckets are folded here.
+func groupUsersByTime(groupBy, columns []string, cal string) ([]map[string]interface{}, error) {
+	selectParts := append(append([]string{}, columns...), "created_at", "count(*) as count")
+	sqlRows, err := initializers.DB.Model(&models.User{}).
+		Select(strings.Join(selectParts, ", ")).
+		Group(strings.Join(append(append([]string{}, columns...), "created_at"), ", ")).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlRows.Close()
+
+	counts := map[string]map[string]interface{}{}
+	for sqlRows.Next() {
+		values := make([]interface{}, len(columns))
+		var createdAt time.Time
+		var count int64
+		dest := make([]interface{}, 0, len(columns)+2)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &createdAt, &count)
+		if err := sqlRows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := map[string]interface{}{}
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		year, month := calendarMonth(createdAt, cal)
+		for _, field := range groupBy {
+			switch field {
+			case "created_year":
+				row[field] = fmt.Sprintf("%04d", year)
+			case "created_month":
+				row[field] = fmt.Sprintf("%04d-%02d", year, month)
+			}
+		}
+
+		key := make([]string, len(groupBy))
+		for i, field := range groupBy {
+			key[i] = fmt.Sprint(row[field])
+		}
+		k := strings.Join(key, "\x00")
+		if existing, ok := counts[k]; ok {
+			existing["count"] = existing["count"].(int64) + count
+			continue
+		}
+		row["count"] = count
+		counts[k] = row
+	}
+	if err := sqlRows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]map[string]interface{}, len(keys))
+	for i, k := range keys {
+		out[i] = counts[k]
+	}
+	return out, nil
+}
+
+// calendarMonth returns the year and month t falls in for cal.
+func calendarMonth(t time.Time, cal string) (int, int) {
+	if cal == calendarJalali {
+		d := jalali.FromTime(t.In(jalali.Location()))
+		return d.Year, d.Month
+	}
+	t = t.UTC()
+	return t.Year(), int(t.Month())
 }
 
 func parseGroupBy(raw string) []string {
 	allowed := map[string]bool{
-		"gender":      true,
-		"nationality": true,
+		"gender":        true,
+		"nationality":   true,
+		"created_year":  true,
+		"created_month": true,
 	}
 	var out []string
 	for _, part := range strings.Split(raw, ",") {
@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/middlewares"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// historyFields are the fields history can be filtered by.
+var historyFields = map[string]bool{
+	"username":          true,
+	"email":             true,
+	"bio":               true,
+	"gender":            true,
+	"nationality":       true,
+	"email_verified":    true,
+	"moderation_status": true,
+}
+
+// requestActor names who is making the request for the audit trail: the
+// authenticated caller, or the client address for anonymous requests such as
+// sign-ups.
+func requestActor(c *gin.Context) string {
+	if principal, ok := currentPrincipal(c); ok {
+		return principal.Actor()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// revisionContext is the audit context of the current request.
+func revisionContext(c *gin.Context, revertedTo *uint) services.RevisionContext {
+	return services.RevisionContext{
+		Actor:      requestActor(c),
+		RequestID:  c.GetString(middlewares.RequestIDKey),
+		RevertedTo: revertedTo,
+	}
+}
+
+// UserHistory lists the revisions of a user, newest first. Deleted users keep
+// their history.
+// @Summary User change history
+// @Description Who changed what and when, with per-field before/after values.
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param field query string false "only revisions that changed this field, e.g. email"
+// @Param page query int false "page"
+// @Param page_size query int false "page size (max 100)"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.UserHistoryResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/history [get]
+func UserHistory(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	page := parsePositiveInt(c.DefaultQuery("page", "1"), 1)
+	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "20"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	var user models.User
+	if err := initializers.DB.Unscoped().Select("id").First(&user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
+		return
+	}
+
+	tx := initializers.DB.Model(&models.UserRevision{}).Where("user_id = ?", user.ID)
+	filters := gin.H{}
+	if field := c.Query("field"); field != "" {
+		if !historyFields[field] {
+			respondError(c, http.StatusBadRequest, "invalid_filter", fmt.Sprintf("history cannot be filtered by %q", field))
+			return
+		}
+		tx = tx.Where("changed_fields LIKE ?", "%,"+field+",%")
+		filters["field"] = field
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "history_fetch_failed")
+		return
+	}
+	var revisions []models.UserRevision
+	if err := tx.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&revisions).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "history_fetch_failed")
+		return
+	}
+
+	items := make([]v1.UserRevision, len(revisions))
+	for i, rev := range revisions {
+		items[i] = v1.NewUserRevision(rev, cal == calendarJalali)
+	}
+	hideHistoryBios(c, user.ID, items)
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	meta := v1.Pagination{
+		Mode:       paginationOffset,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: &total,
+		TotalPages: &totalPages,
+		Sort:       "created_at desc",
+	}
+	if len(filters) > 0 {
+		meta.Filters = filters
+	}
+	c.JSON(http.StatusOK, v1.UserHistoryResponse{Data: items, Meta: meta})
+}
+
+// RevertUser restores the editable fields a user had at an earlier version. It
+// is an update to that state: it is validated, needs a captcha (X-Challenge-ID),
+// honours If-Match and dry_run, and bumps the version.
+// @Summary Revert user to an earlier version
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param version query int true "version to restore, as listed in the history"
+// @Param X-Challenge-ID header string true "captcha challenge"
+// @Param If-Match header string false "ETag the revert is based on"
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "validate without saving or consuming the challenge"
+// @Success 200 {object} v1.UserResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/revert [post]
+func RevertUser(c *gin.Context) {
+	version, err := strconv.ParseUint(c.Query("version"), 10, 32)
+	if err != nil || version == 0 {
+		respondError(c, http.StatusBadRequest, "invalid_version", "version must be a positive integer")
+		return
+	}
+	user, ok := loadUserForWrite(c)
+	if !ok {
+		return
+	}
+
+	var rev models.UserRevision
+	err = initializers.DB.Where("user_id = ? AND version = ?", user.ID, version).Order("id desc").First(&rev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "revision_not_found", fmt.Sprintf("user has no revision with version %d", version))
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "history_fetch_failed")
+		return
+	}
+	snapshot, err := services.RevisionSnapshot(rev)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "history_fetch_failed")
+		return
+	}
+
+	target := userFields{
+		Username:    snapshot["username"],
+		Email:       snapshot["email"],
+		Bio:         snapshot["bio"],
+		Gender:      snapshot["gender"],
+		Nationality: snapshot["nationality"],
+	}
+	revertedTo := uint(version)
+	saveUserFields(c, user, target, c.GetHeader(challengeHeader), nil, models.RevisionRevert, &revertedTo)
+}
+
+// DeleteUser soft-deletes a user and logs it out everywhere. The row, its
+// history and its username and email stay reserved until it is restored.
+// @Summary Delete user
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param X-Challenge-ID header string true "captcha challenge"
+// @Param If-Match header string false "ETag the delete is based on"
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "check without deleting or consuming the challenge"
+// @Success 204
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id} [delete]
+func DeleteUser(c *gin.Context) {
+	user, ok := loadUserForWrite(c)
+	if !ok {
+		return
+	}
+	dry, _ := requestDryRun(c)
+	if err := checkChallenge(c.GetHeader(challengeHeader), dry); err != nil {
+		respondCaptchaError(c, err)
+		return
+	}
+
+	err := writeUser(dry, func(tx *gorm.DB) error {
+		// A soft delete by hand, so the version is bumped like any other write.
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND version = ?", user.ID, user.Version).
+			Updates(map[string]interface{}{"deleted_at": time.Now(), "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errStaleVersion
+		}
+		if _, err := services.Sessions.RevokeAll(tx, user.ID, 0, models.SessionUserDeleted); err != nil {
+			return err
+		}
+		var after models.User
+		if err := tx.Unscoped().First(&after, user.ID).Error; err != nil {
+			return err
+		}
+		return services.RecordUserRevision(tx, models.RevisionDelete, user, after, revisionContext(c, nil))
+	})
+	if !respondLifecycleError(c, err, "user_delete_failed") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RestoreUser undoes a delete.
+// @Summary Restore a deleted user
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param X-Challenge-ID header string true "captcha challenge"
+// @Param If-Match header string false "ETag the restore is based on"
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "check without restoring or consuming the challenge"
+// @Success 200 {object} v1.UserResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse "user is not deleted"
+// @Failure 412 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/restore [post]
+func RestoreUser(c *gin.Context) {
+	user, ok := loadWriteTarget(c, initializers.DB.Unscoped())
+	if !ok {
+		return
+	}
+	if !user.DeletedAt.Valid {
+		respondError(c, http.StatusConflict, "user_not_deleted")
+		return
+	}
+	cal, _ := requestCalendar(c)
+	dry, _ := requestDryRun(c)
+	if err := checkChallenge(c.GetHeader(challengeHeader), dry); err != nil {
+		respondCaptchaError(c, err)
+		return
+	}
+
+	before := user
+	err := writeUser(dry, func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&models.User{}).
+			Where("id = ? AND version = ? AND deleted_at IS NOT NULL", user.ID, user.Version).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errStaleVersion
+		}
+		if err := tx.First(&user, user.ID).Error; err != nil {
+			return err
+		}
+		return services.RecordUserRevision(tx, models.RevisionRestore, before, user, revisionContext(c, nil))
+	})
+	if !respondLifecycleError(c, err, "user_restore_failed") {
+		return
+	}
+	c.Header("ETag", user.ETag())
+	c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
+}
+
+// respondLifecycleError answers for a failed delete or restore and reports
+// whether the handler may continue (err is nil).
+func respondLifecycleError(c *gin.Context, err error, failedCode string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errStaleVersion):
+		if c.GetHeader("If-Match") != "" {
+			respondError(c, http.StatusPreconditionFailed, "precondition_failed")
+		} else {
+			respondError(c, http.StatusConflict, "concurrent_update")
+		}
+	default:
+		respondError(c, http.StatusInternalServerError, failedCode)
+	}
+	return false
+}
+
+// historyExpansionSize is how many revisions expand=history embeds per user.
+const historyExpansionSize = 5
+
+// expandHistory returns the latest revisions of every user, newest first. The
+// limit per user is applied in SQL, so long histories are never read in full.
+func expandHistory(db *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+	ranked := db.Model(&models.UserRevision{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id DESC) AS history_rank").
+		Where("user_id IN ?", ids)
+	var revisions []models.UserRevision
+	err := db.Table("(?) AS ranked", ranked).Where("history_rank <= ?", historyExpansionSize).
+		Order("user_id, id desc").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	perUser := make(map[uint][]v1.UserRevision, len(ids))
+	for _, rev := range revisions {
+		perUser[rev.UserID] = append(perUser[rev.UserID], v1.NewUserRevision(rev, false))
+	}
+	out := make(map[uint]interface{}, len(perUser))
+	for id, items := range perUser {
+		out[id] = items
+	}
+	return out, nil
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// historyRouter serves the history handlers on a fresh database holding one
+// user with a create and an update revision.
+func historyRouter(t *testing.T) (*gin.Engine, *gorm.DB, models.User) {
+	t.Helper()
+	saved := initializers.DB
+	t.Cleanup(func() { initializers.DB = saved })
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.UserRevision{}, &models.OutboxEvent{}, &models.ChangeSequence{},
+		&models.UserSession{}, &models.RefreshToken{}, &models.SignupRule{}, &models.SignupRejection{}); err != nil {
+		t.Fatal(err)
+	}
+	initializers.DB = db
+
+	created := models.User{Username: "alice", Email: "alice@example.com", Bio: "one", Version: 1}
+	if err := db.Create(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	updated := created
+	updated.Email, updated.Bio, updated.Version = "alice@example.org", "two", 2
+	if err := db.Model(&updated).Updates(map[string]interface{}{"email": updated.Email, "bio": updated.Bio, "version": updated.Version}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range [][2]models.User{{{}, created}, {created, updated}} {
+		action := models.RevisionCreate
+		if rev[0].ID != 0 {
+			action = models.RevisionUpdate
+		}
+		if err := services.RecordUserRevision(db, action, rev[0], rev[1], services.RevisionContext{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/users/:id", DeleteUser)
+	r.POST("/users/:id/restore", RestoreUser)
+	r.POST("/users/:id/revert", RevertUser)
+	return r, db, updated
+}
+
+// serveWithChallenge sends a request carrying a fresh captcha challenge.
+func serveWithChallenge(r *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	challenge := services.Arcaptcha.GenerateChallenge()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set(challengeHeader, challenge)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// lastRevision is the newest revision of the user.
+func lastRevision(t *testing.T, db *gorm.DB, userID uint) models.UserRevision {
+	t.Helper()
+	var rev models.UserRevision
+	if err := db.Where("user_id = ?", userID).Order("id desc").First(&rev).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rev
+}
+
+func TestRevertUser(t *testing.T) {
+	r, db, user := historyRouter(t)
+	path := fmt.Sprintf("/users/%d/revert", user.ID)
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?version=abc", http.StatusBadRequest},
+		{"?version=0", http.StatusBadRequest},
+		{"?version=9", http.StatusNotFound},
+	} {
+		if w := serveWithChallenge(r, http.MethodPost, path+tc.query); w.Code != tc.want {
+			t.Errorf("revert%s: status = %d, want %d: %s", tc.query, w.Code, tc.want, w.Body)
+		}
+	}
+
+	w := serveWithChallenge(r, http.MethodPost, path+"?version=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("revert to version 1: status = %d: %s", w.Code, w.Body)
+	}
+	var got models.User
+	if err := db.First(&got, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "alice@example.com" || got.Bio != "one" || got.Version != 3 {
+		t.Errorf("reverted user = %s, %q, version %d", got.Email, got.Bio, got.Version)
+	}
+	if etag := w.Header().Get("ETag"); etag != got.ETag() {
+		t.Errorf("ETag = %s, want %s", etag, got.ETag())
+	}
+
+	// Reverting is a new change on top of the history, not a rewind of it.
+	rev := lastRevision(t, db, user.ID)
+	if rev.Action != models.RevisionRevert || rev.Version != 3 || rev.RevertedTo == nil || *rev.RevertedTo != 1 {
+		t.Errorf("revert revision = %+v", rev)
+	}
+	if rev.ChangedFields != ",email,bio," {
+		t.Errorf("revert changed %q, want email and bio", rev.ChangedFields)
+	}
+	if change := services.RevisionChanges(rev)["bio"]; change.From != "two" || change.To != "one" {
+		t.Errorf("bio change = %+v", change)
+	}
+	var n int64
+	db.Model(&models.UserRevision{}).Where("user_id = ?", user.ID).Count(&n)
+	if n != 3 {
+		t.Errorf("%d revisions, want 3", n)
+	}
+
+	// The revert is published like any other update.
+	var event models.OutboxEvent
+	if err := db.Order("id desc").First(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != services.EventUserUpdated || event.UserID != user.ID || !strings.Contains(event.Payload, `"bio":{"from":"two","to":"one"}`) {
+		t.Errorf("revert event = %+v", event)
+	}
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	r, db, user := historyRouter(t)
+	path := fmt.Sprintf("/users/%d", user.ID)
+	session, err := services.Sessions.Start(db, user.ID, services.SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		method, path string
+		want         int
+		action       string
+	}{
+		{http.MethodPost, path + "/restore", http.StatusConflict, ""},
+		{http.MethodDelete, path, http.StatusNoContent, models.RevisionDelete},
+		{http.MethodDelete, path, http.StatusNotFound, ""},
+		{http.MethodPost, path + "/revert?version=1", http.StatusNotFound, ""},
+		{http.MethodPost, path + "/restore", http.StatusOK, models.RevisionRestore},
+		{http.MethodPost, path + "/restore", http.StatusConflict, ""},
+	}
+	for _, step := range steps {
+		before := lastRevision(t, db, user.ID)
+		w := serveWithChallenge(r, step.method, step.path)
+		if w.Code != step.want {
+			t.Fatalf("%s %s: status = %d, want %d: %s", step.method, step.path, w.Code, step.want, w.Body)
+		}
+		rev := lastRevision(t, db, user.ID)
+		switch {
+		case step.action == "" && rev.ID != before.ID:
+			t.Errorf("%s %s: recorded a %s revision", step.method, step.path, rev.Action)
+		case step.action != "" && (rev.ID == before.ID || rev.Action != step.action):
+			t.Errorf("%s %s: last revision = %s, want %s", step.method, step.path, rev.Action, step.action)
+		case step.action != "" && rev.ChangedFields != "":
+			t.Errorf("%s %s: changed fields = %q, want none", step.method, step.path, rev.ChangedFields)
+		case step.action != "" && rev.Version != before.Version+1:
+			t.Errorf("%s %s: revision version = %d, want %d", step.method, step.path, rev.Version, before.Version+1)
+		}
+		// Deleting and restoring bump the version like any other write.
+		var current models.User
+		if err := db.Unscoped().First(&current, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if current.Version != rev.Version {
+			t.Errorf("%s %s: user version = %d, want %d", step.method, step.path, current.Version, rev.Version)
+		}
+	}
+
+	// The delete logged the user out; the restore does not log it back in.
+	if active, _ := services.Sessions.Active(db, session.Session.ID); active {
+		t.Error("the session survived the delete")
+	}
+	var got models.User
+	if err := db.First(&got, user.ID).Error; err != nil {
+		t.Fatalf("restored user: %v", err)
+	}
+	if got.Email != user.Email || got.Bio != user.Bio {
+		t.Errorf("restored user = %s, %q", got.Email, got.Bio)
+	}
+}
+
+func TestExpandHistory(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.UserRevision{}); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[uint]int{1: historyExpansionSize + 2, 2: 2}
+	for id := uint(1); id <= 2; id++ {
+		for v := 1; v <= counts[id]; v++ {
+			if err := db.Create(&models.UserRevision{UserID: id, Version: uint(v), Action: models.RevisionUpdate}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got, err := expandHistory(db, []uint{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint]string{1: "[7 6 5 4 3]", 2: "[2 1]"}
+	if len(got) != len(want) {
+		t.Errorf("expandHistory() has %d users, want %d", len(got), len(want))
+	}
+	for id, versions := range want {
+		revs, _ := got[id].([]v1.UserRevision)
+		seen := make([]uint, len(revs))
+		for i, rev := range revs {
+			seen[i] = rev.Version
+		}
+		if fmt.Sprint(seen) != versions {
+			t.Errorf("user %d: versions = %v, want %s", id, seen, versions)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks a response served from the idempotency store.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// replayedHeaders are the response headers stored with an idempotent response.
+var replayedHeaders = []string{"Content-Type", "Content-Language", "ETag", "Location"}
+
+// Idempotent makes a write safe to retry with an Idempotency-Key header. The
+// first response below 500 is stored for services.Idempotency.TTL and replayed
+// for retries with the same key, method, URL and body, without running the
+// handler (so no captcha challenge is consumed). Keys are scoped to the caller
+// (the client IP for anonymous requests). Reusing a key for a different
+// request answers 422; retrying while the first request runs answers 409. Server
+// errors free the key so the request can be retried. Requests without the header
+// pass through unchanged.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !idempotencyKeyPattern.MatchString(key) {
+			respondError(c, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be 1-255 visible ASCII characters")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		db := initializers.DB
+		scope := requestActor(c)
+		stored, err := services.Idempotency.Begin(db, scope, key, requestFingerprint(c, body))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyMismatch):
+			respondError(c, http.StatusUnprocessableEntity, "idempotency_key_reused")
+			return
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			respondError(c, http.StatusConflict, "idempotency_in_progress")
+			return
+		case err != nil:
+			respondError(c, http.StatusInternalServerError, "internal_error")
+			return
+		case stored != nil:
+			var header map[string]string
+			_ = json.Unmarshal([]byte(stored.Header), &header)
+			for name, value := range header {
+				c.Header(name, value)
+			}
+			c.Header(idempotentReplayedHeader, "true")
+			c.Status(stored.Status)
+			_, _ = c.Writer.Write(stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// Also runs when the handler panics, so the key is not left pending.
+			if !completed {
+				if err := services.Idempotency.Release(db, scope, key); err != nil {
+					log.Printf("idempotency: could not release key: %v", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		header := map[string]string{}
+		for _, name := range replayedHeaders {
+			if v := c.Writer.Header().Get(name); v != "" {
+				header[name] = v
+			}
+		}
+		rawHeader, _ := json.Marshal(header)
+		if err := services.Idempotency.Complete(db, scope, key, status, string(rawHeader), recorder.body.Bytes()); err != nil {
+			log.Printf("idempotency: could not store response: %v", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// requestFingerprint identifies a request for Idempotency-Key reuse checks: a
+// hash of the authenticated caller, method, URL, content type, If-Match,
+// X-Challenge-ID and body.
+func requestFingerprint(c *gin.Context, body []byte) string {
+	var caller string
+	if principal, ok := currentPrincipal(c); ok {
+		caller = principal.Actor()
+	}
+	h := sha256.New()
+	for _, part := range []string{
+		caller,
+		c.Request.Method,
+		c.Request.URL.RequestURI(),
+		c.ContentType(),
+		c.GetHeader("If-Match"),
+		c.GetHeader(challengeHeader),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
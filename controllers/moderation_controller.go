@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/moderation"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bioModeration returns the moderation status and flags of a bio the caller is
+// writing: pending when a check flags it, approved otherwise. Bios written by
+// admins are approved as they are.
+func bioModeration(c *gin.Context, bio string) (string, string) {
+	if principal, ok := currentPrincipal(c); ok && principal.Has(auth.RoleAdmin) {
+		return models.ModerationApproved, ""
+	}
+	if flags := moderation.Check(bio); len(flags) > 0 {
+		return models.ModerationPending, strings.Join(flags, ",")
+	}
+	return models.ModerationApproved, ""
+}
+
+// bioHiddenFrom reports whether unapproved bios of user id are hidden from the
+// caller: MODERATION_HIDE_UNAPPROVED is set and the caller is neither an admin
+// nor that user.
+func bioHiddenFrom(c *gin.Context, id uint) bool {
+	hidden, self := biosHidden(c)
+	return hidden && !(self != nil && *self == id)
+}
+
+// biosHidden reports whether unapproved bios are hidden from the caller and,
+// if so, the user whose bio the caller may still see (nil when none).
+func biosHidden(c *gin.Context) (bool, *uint) {
+	if !moderation.Current().HideUnapproved {
+		return false, nil
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return true, nil
+	}
+	if principal.Has(auth.RoleAdmin) {
+		return false, nil
+	}
+	return true, principal.UserID
+}
+
+// filterUserSearch restricts tx to the users matching terms. A bio hidden from
+// the caller does not count towards the match, so a search cannot tell what
+// it contains.
+func filterUserSearch(c *gin.Context, userSearch services.UserSearch, tx *gorm.DB, terms []string) *gorm.DB {
+	tx = userSearch.Filter(tx, terms)
+	if hidden, self := biosHidden(c); hidden {
+		tx = userSearch.ExcludeHiddenBios(tx, terms, self)
+	}
+	return tx
+}
+
+// hideUnapprovedBio blanks the bio of u when it is not approved and hidden from
+// the caller (see bioHiddenFrom). It reports whether the bio was hidden.
+func hideUnapprovedBio(c *gin.Context, u *models.User) bool {
+	if u.Bio == "" || u.ModerationStatus == models.ModerationApproved || !bioHiddenFrom(c, u.ID) {
+		return false
+	}
+	u.Bio = ""
+	return true
+}
+
+// hideHistoryBios blanks the bio values in the revisions of user id when bios
+// are hidden from the caller. Past bios are blanked whatever their status, as
+// a revision does not say whether its bio was ever approved.
+func hideHistoryBios(c *gin.Context, id uint, revisions []v1.UserRevision) {
+	if !bioHiddenFrom(c, id) {
+		return
+	}
+	for _, rev := range revisions {
+		if _, ok := rev.Changes["bio"]; ok {
+			rev.Changes["bio"] = services.FieldChange{}
+		}
+	}
+}
+
+// hideExpandedHistoryBios applies hideHistoryBios to expand=history results.
+func hideExpandedHistoryBios(c *gin.Context, expanded map[uint]map[string]interface{}) {
+	for id, values := range expanded {
+		if revisions, ok := values["history"].([]v1.UserRevision); ok {
+			hideHistoryBios(c, id, revisions)
+		}
+	}
+}
+
+// hideEventBio returns the payload of an outbox event for the caller, with the
+// bio blanked when bios are hidden from it (see hideHistoryBios). Payloads it
+// cannot read are dropped.
+func hideEventBio(c *gin.Context, event models.OutboxEvent) (string, bool) {
+	if !bioHiddenFrom(c, event.UserID) {
+		return event.Payload, true
+	}
+	payload, err := services.WithoutBio(event.Payload)
+	return payload, err == nil
+}
+
+// ListBioReviews is the moderation queue: the users whose bio has the given
+// status, pending by default, oldest change first.
+// @Summary List bios for review
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param status query string false "pending (default), rejected or approved"
+// @Param page query int false "page"
+// @Param page_size query int false "page size (max 100)"
+// @Success 200 {object} v1.BioReviewListResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/moderation/bios [get]
+func ListBioReviews(c *gin.Context) {
+	page := parsePositiveInt(c.DefaultQuery("page", "1"), 1)
+	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "20"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	status := c.DefaultQuery("status", models.ModerationPending)
+	switch status {
+	case models.ModerationPending, models.ModerationRejected, models.ModerationApproved:
+	default:
+		respondError(c, http.StatusBadRequest, "invalid_filter", "status must be pending, rejected or approved")
+		return
+	}
+
+	tx := initializers.DB.Model(&models.User{}).Where("moderation_status = ?", status)
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "moderation_failed")
+		return
+	}
+	var users []models.User
+	if err := tx.Order("updated_at, id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "moderation_failed")
+		return
+	}
+
+	items := make([]v1.BioReview, len(users))
+	for i, u := range users {
+		items[i] = v1.NewBioReview(u)
+	}
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	c.JSON(http.StatusOK, v1.BioReviewListResponse{Data: items, Meta: v1.Pagination{
+		Mode:       paginationOffset,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: &total,
+		TotalPages: &totalPages,
+		Sort:       "updated_at",
+		Filters:    map[string]interface{}{"status": status},
+	}})
+}
+
+// ApproveBio approves a user's bio, so it is shown to everyone.
+// @Summary Approve bio
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag the user must still have"
+// @Param dry_run query bool false "check the request without saving"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.UserResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/moderation/bios/{id}/approve [post]
+func ApproveBio(c *gin.Context) {
+	setModerationStatus(c, models.ModerationApproved)
+}
+
+// RejectBio rejects a user's bio. It stays stored, hidden where unapproved
+// bios are, until the user writes a new one, which is checked again.
+// @Summary Reject bio
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag the user must still have"
+// @Param dry_run query bool false "check the request without saving"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.UserResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/moderation/bios/{id}/reject [post]
+func RejectBio(c *gin.Context) {
+	setModerationStatus(c, models.ModerationRejected)
+}
+
+// setModerationStatus moves the user in the path to status, guarded by
+// version, and records it in history as moderate_bio.
+func setModerationStatus(c *gin.Context, status string) {
+	user, ok := loadUserForWrite(c)
+	if !ok {
+		return
+	}
+	cal, _ := requestCalendar(c)
+	dry, _ := requestDryRun(c)
+	if user.ModerationStatus == status {
+		c.Header("ETag", user.ETag())
+		c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
+		return
+	}
+
+	before := user
+	err := writeUser(dry, func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND version = ?", user.ID, user.Version).
+			Updates(map[string]interface{}{
+				"moderation_status": status,
+				"version":           gorm.Expr("version + 1"),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errStaleVersion
+		}
+		if err := tx.First(&user, user.ID).Error; err != nil {
+			return err
+		}
+		return services.RecordUserRevision(tx, models.RevisionModerate, before, user, revisionContext(c, nil))
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errStaleVersion):
+		if c.GetHeader("If-Match") != "" {
+			respondError(c, http.StatusPreconditionFailed, "precondition_failed")
+			return
+		}
+		respondError(c, http.StatusConflict, "concurrent_update")
+		return
+	default:
+		respondError(c, http.StatusInternalServerError, "moderation_failed")
+		return
+	}
+	c.Header("ETag", user.ETag())
+	c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	paginationOffset = "offset"
+	paginationCursor = "cursor"
+)
+
+var (
+	errInvalidCursor  = errors.New("invalid cursor")
+	errCursorSort     = errors.New("cursor was issued for a different sort")
+	errCursorConflict = errors.New("use either after or before, not both")
+)
+
+// cursorErrorCodes are the catalog codes for the cursor errors clients can cause.
+var cursorErrorCodes = map[error]string{
+	errInvalidCursor:  "invalid_cursor",
+	errCursorSort:     "cursor_sort_mismatch",
+	errCursorConflict: "cursor_conflict",
+}
+
+// sortSpec is a validated ORDER BY column/direction pair.
+type sortSpec struct {
+	Field string
+	Desc  bool
+}
+
+func (s sortSpec) String() string {
+	if s.Desc {
+		return s.Field + " desc"
+	}
+	return s.Field + " asc"
+}
+
+// order returns the ORDER BY clause with id as a tie-breaker so that rows sharing
+// the same sort value still have a total, stable order. reverse flips both keys.
+func (s sortSpec) order(reverse bool) string {
+	dir := "asc"
+	if s.Desc != reverse {
+		dir = "desc"
+	}
+	return s.Field + " " + dir + ", id " + dir
+}
+
+// userCursor is the decoded form of an after/before token: the sort it was issued
+// for plus the sort key and id of the row it points at.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func encodeCursor(sort sortSpec, user models.User) string {
+	raw, _ := json.Marshal(userCursor{
+		Sort:  sort.String(),
+		Value: sortValue(sort.Field, user),
+		ID:    user.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(token string, sort sortSpec) (userCursor, error) {
+	var cur userCursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.ID == 0 {
+		return cur, errInvalidCursor
+	}
+	if cur.Sort != sort.String() {
+		return cur, errCursorSort
+	}
+	if _, err := cursorArg(sort.Field, cur.Value); err != nil {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+func sortValue(field string, user models.User) string {
+	switch field {
+	case "username":
+		return user.Username
+	case "email":
+		return user.Email
+	case "updated_at":
+		return user.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		return user.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+// cursorArg converts the encoded sort value back into the type the column is
+// compared against, so timestamps bind the same way they were stored.
+func cursorArg(field, value string) (interface{}, error) {
+	switch field {
+	case "created_at", "updated_at":
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return value, nil
+	}
+}
+
+// applyKeyset restricts tx to the rows strictly after (or, when backward is set,
+// strictly before) the cursor position in the given sort order.
+func applyKeyset(tx *gorm.DB, sort sortSpec, cur userCursor, backward bool) *gorm.DB {
+	op := ">"
+	if sort.Desc != backward {
+		op = "<"
+	}
+	value, _ := cursorArg(sort.Field, cur.Value)
+	return tx.Where(
+		sort.Field+" "+op+" ? OR ("+sort.Field+" = ? AND id "+op+" ?)",
+		value, value, cur.ID,
+	)
+}
+
+// fetchUserPage loads one keyset page. It asks for one extra row to learn whether
+// another page exists in the direction of travel without a COUNT query.
+func fetchUserPage(tx *gorm.DB, sort sortSpec, pageSize int, after, before string) ([]models.User, v1.Pagination, error) {
+	meta := v1.Pagination{Mode: paginationCursor, PageSize: pageSize}
+
+	if after != "" && before != "" {
+		return nil, meta, errCursorConflict
+	}
+
+	backward := before != ""
+	token := after
+	if backward {
+		token = before
+	}
+
+	if token != "" {
+		cur, err := decodeCursor(token, sort)
+		if err != nil {
+			return nil, meta, err
+		}
+		tx = applyKeyset(tx, sort, cur, backward)
+	}
+
+	var users []models.User
+	if err := tx.Order(sort.order(backward)).Limit(pageSize + 1).Find(&users).Error; err != nil {
+		return nil, meta, err
+	}
+
+	more := len(users) > pageSize
+	if more {
+		users = users[:pageSize]
+	}
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	if len(users) > 0 {
+		first, last := users[0], users[len(users)-1]
+		if backward {
+			meta.NextCursor = encodeCursor(sort, last)
+			if more {
+				meta.PrevCursor = encodeCursor(sort, first)
+			}
+		} else {
+			if more {
+				meta.NextCursor = encodeCursor(sort, last)
+			}
+			if token != "" {
+				meta.PrevCursor = encodeCursor(sort, first)
+			}
+		}
+	}
+
+	return users, meta, nil
+}
+
+func parseBoolQuery(c *gin.Context, key string, defaultVal bool) bool {
+	switch strings.ToLower(strings.TrimSpace(c.Query(key))) {
+	case "1", "true", "yes":
+		return true
+	case "0", "false", "no":
+		return false
+	default:
+		return defaultVal
+	}
+}
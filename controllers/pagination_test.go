@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testDB opens a fresh SQLite database with the users table. It lives in a
+// file, as every pooled connection to :memory: would get its own database.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDecodeCursor(t *testing.T) {
+	byCreated := sortSpec{Field: "created_at", Desc: true}
+	user := models.User{Username: "alice"}
+	user.ID = 7
+	user.CreatedAt = time.Date(2024, 3, 20, 10, 0, 0, 123, time.UTC)
+
+	cur, err := decodeCursor(encodeCursor(byCreated, user), byCreated)
+	if err != nil {
+		t.Fatalf("decodeCursor(encodeCursor()) failed: %v", err)
+	}
+	if cur.ID != 7 || cur.Value != "2024-03-20T10:00:00.000000123Z" {
+		t.Errorf("decodeCursor(encodeCursor()) = %+v", cur)
+	}
+
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"not base64", "!!!", errInvalidCursor},
+		{"not json", b64("seq"), errInvalidCursor},
+		{"no id", b64(`{"s":"created_at desc","v":"2024-03-20T10:00:00Z"}`), errInvalidCursor},
+		{"other sort", encodeCursor(sortSpec{Field: "created_at"}, user), errCursorSort},
+		{"other field", encodeCursor(sortSpec{Field: "username", Desc: true}, user), errCursorSort},
+		{"bad time", b64(`{"s":"created_at desc","v":"yesterday","id":7}`), errInvalidCursor},
+	}
+	for _, tc := range cases {
+		if _, err := decodeCursor(tc.token, byCreated); err != tc.want {
+			t.Errorf("%s: decodeCursor() error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestFetchUserPage(t *testing.T) {
+	db := testDB(t)
+	// Six users over three timestamps, so every page boundary cuts through a
+	// tie that only the id can break.
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for i := 1; i <= 6; i++ {
+		u := models.User{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i)}
+		u.CreatedAt = base.Add(time.Duration((i-1)/2) * time.Hour)
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		sort sortSpec
+		want []uint
+	}{
+		{sortSpec{Field: "created_at", Desc: true}, []uint{6, 5, 4, 3, 2, 1}},
+		{sortSpec{Field: "created_at"}, []uint{1, 2, 3, 4, 5, 6}},
+		{sortSpec{Field: "username", Desc: true}, []uint{6, 5, 4, 3, 2, 1}},
+	}
+	for _, tc := range cases {
+		// Walk forward two at a time, then back from the last page.
+		var forward []uint
+		var pages []string
+		after := ""
+		for {
+			users, meta, err := fetchUserPage(db.Model(&models.User{}), tc.sort, 2, after, "")
+			if err != nil {
+				t.Fatalf("%s: fetchUserPage(after=%q): %v", tc.sort, after, err)
+			}
+			for _, u := range users {
+				forward = append(forward, u.ID)
+			}
+			pages = append(pages, meta.PrevCursor)
+			if meta.NextCursor == "" {
+				break
+			}
+			after = meta.NextCursor
+		}
+		if fmt.Sprint(forward) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: forward = %v, want %v", tc.sort, forward, tc.want)
+		}
+
+		before := pages[len(pages)-1]
+		users, meta, err := fetchUserPage(db.Model(&models.User{}), tc.sort, 2, "", before)
+		if err != nil {
+			t.Fatalf("%s: fetchUserPage(before=%q): %v", tc.sort, before, err)
+		}
+		if got := []uint{users[0].ID, users[1].ID}; fmt.Sprint(got) != fmt.Sprint(tc.want[2:4]) {
+			t.Errorf("%s: page before the last = %v, want %v", tc.sort, got, tc.want[2:4])
+		}
+		if meta.PrevCursor == "" || meta.NextCursor == "" {
+			t.Errorf("%s: middle page cursors = %q, %q, want both", tc.sort, meta.PrevCursor, meta.NextCursor)
+		}
+	}
+
+	if _, _, err := fetchUserPage(db.Model(&models.User{}), sortSpec{Field: "created_at"}, 2, "a", "b"); err != errCursorConflict {
+		t.Errorf("after and before: error = %v, want errCursorConflict", err)
+	}
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sessionMeta describes the client of the current request. device is what the
+// client calls itself, if anything.
+func sessionMeta(c *gin.Context, device string) services.SessionMeta {
+	return services.SessionMeta{Device: device, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// respondTokens answers with a fresh access token for user in the session of
+// grant, together with the grant's refresh token.
+func respondTokens(c *gin.Context, user models.User, grant services.RefreshGrant, cal string) {
+	token, expires, err := services.Tokens.Issue(user, grant.Session)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "login_failed")
+		return
+	}
+	c.JSON(http.StatusOK, v1.TokenResponse{Data: v1.Token{
+		AccessToken:      token,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(time.Until(expires).Seconds()),
+		ExpiresAt:        expires,
+		RefreshToken:     grant.Token,
+		RefreshExpiresAt: grant.ExpiresAt,
+		SessionID:        grant.Session.ID,
+		User:             userDTO(user, cal),
+	}})
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token. Every refresh token works once: presenting one that was
+// already exchanged means it was copied, so the whole session is revoked and
+// the answer is 401 refresh_token_reused.
+// @Summary Refresh session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param payload body v1.RefreshRequest true "Refresh token"
+// @Param calendar query string false "gregorian (default) or jalali"
+// @Success 200 {object} v1.TokenResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse "invalid_refresh_token or refresh_token_reused"
+// @Failure 503 {object} controllers.ErrorResponse "login_unavailable without JWT_SECRET"
+// @Router /api/v1/auth/refresh [post]
+func RefreshSession(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	if !services.Tokens.Enabled() {
+		respondError(c, http.StatusServiceUnavailable, "login_unavailable")
+		return
+	}
+	var req v1.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+
+	grant, err := services.Sessions.Refresh(initializers.DB, req.RefreshToken, sessionMeta(c, ""))
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		respondError(c, http.StatusUnauthorized, "refresh_token_reused")
+		return
+	case errors.Is(err, services.ErrInvalidRefreshToken):
+		respondError(c, http.StatusUnauthorized, "invalid_refresh_token")
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, grant.Session.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusUnauthorized, "invalid_refresh_token")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+	respondTokens(c, user, grant, cal)
+}
+
+// Logout ends the session the access token belongs to. Its refresh token stops
+// working and so do its other access tokens.
+// @Summary Log out
+// @Tags auth
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} controllers.ErrorResponse "session_required: the token is not from a login"
+// @Failure 401 {object} controllers.ErrorResponse
+// @Router /api/v1/auth/logout [post]
+func Logout(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		respondUnauthorized(c, "")
+		return
+	}
+	if principal.SessionID == nil || principal.UserID == nil {
+		respondError(c, http.StatusBadRequest, "session_required")
+		return
+	}
+	err := services.Sessions.Revoke(initializers.DB, *principal.UserID, *principal.SessionID, models.SessionLogout)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListSessions lists the active sessions of a user, most recently used first.
+// @Summary List sessions
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} v1.SessionListResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/sessions [get]
+func ListSessions(c *gin.Context) {
+	userID, ok := loadSessionOwner(c)
+	if !ok {
+		return
+	}
+	sessions, err := services.Sessions.List(initializers.DB, userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+	current := currentSessionID(c)
+	items := make([]v1.Session, len(sessions))
+	for i, s := range sessions {
+		items[i] = v1.NewSession(s, s.ID == current)
+	}
+	c.JSON(http.StatusOK, v1.SessionListResponse{Data: items})
+}
+
+// RevokeSession logs one device of a user out.
+// @Summary Revoke session
+// @Tags auth
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param session_id path int true "Session ID"
+// @Success 204
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/sessions/{session_id} [delete]
+func RevokeSession(c *gin.Context) {
+	userID, ok := loadSessionOwner(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("session_id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "session_not_found")
+		return
+	}
+	if err := services.Sessions.Revoke(initializers.DB, userID, uint(id), models.SessionRevoked); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "session_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeSessions logs a user out on every device. With keep_current=true the
+// session the request was made with stays logged in.
+// @Summary Revoke all sessions
+// @Tags auth
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param keep_current query bool false "keep the session of this request"
+// @Success 204
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id}/sessions [delete]
+func RevokeSessions(c *gin.Context) {
+	userID, ok := loadSessionOwner(c)
+	if !ok {
+		return
+	}
+	var keep uint
+	if raw := c.Query("keep_current"); raw != "" {
+		keepCurrent, err := strconv.ParseBool(raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid_payload", "keep_current must be true or false")
+			return
+		}
+		if keepCurrent {
+			keep = currentSessionID(c)
+		}
+	}
+	if _, err := services.Sessions.RevokeAll(initializers.DB, userID, keep, models.SessionRevoked); err != nil {
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadSessionOwner resolves the user whose sessions the request is about.
+func loadSessionOwner(c *gin.Context) (uint, bool) {
+	var user models.User
+	if err := initializers.DB.Select("id").First(&user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return 0, false
+		}
+		respondError(c, http.StatusInternalServerError, "session_failed")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// currentSessionID is the session the caller's token was issued for, or 0.
+func currentSessionID(c *gin.Context) uint {
+	if principal, ok := currentPrincipal(c); ok && principal.SessionID != nil {
+		return *principal.SessionID
+	}
+	return 0
+}
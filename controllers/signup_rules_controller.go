@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/middlewares"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// signupRuleKinds are the kinds a rule can be created with.
+var signupRuleKinds = []string{
+	models.RuleReservedUsername,
+	models.RuleUsernamePattern,
+	models.RuleEmailPattern,
+	models.RuleBlockedDomain,
+	models.RuleDomainCap,
+}
+
+// enforceSignupRules checks attempt against the signup rules and answers 400
+// when it breaks one, logging and recording every rejection. userID is the
+// user being changed, nil for sign-ups. Admins are not held to the rules. It
+// reports whether the write may go on.
+func enforceSignupRules(c *gin.Context, attempt services.SignupAttempt, userID *uint) bool {
+	if principal, ok := currentPrincipal(c); ok && principal.Has(auth.RoleAdmin) {
+		return true
+	}
+	db := initializers.DB
+	violations, err := services.Signups.Check(db, attempt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	errs := make(validation.Errors, len(violations))
+	for i, v := range violations {
+		errs[i] = v.Error
+		rejection := models.SignupRejection{
+			Rule:      v.Rule,
+			RuleID:    v.RuleID,
+			Field:     v.Error.Field,
+			UserID:    userID,
+			Username:  attempt.Username,
+			Email:     attempt.Email,
+			ClientIP:  c.ClientIP(),
+			RequestID: c.GetString(middlewares.RequestIDKey),
+		}
+		log.Printf("signup rules: %s rule rejected %s of username=%q email=%q from %s (request %s)",
+			v.Rule, v.Error.Field, attempt.Username, attempt.Email, rejection.ClientIP, rejection.RequestID)
+		if err := db.Create(&rejection).Error; err != nil {
+			log.Printf("signup rules: recording rejection: %v", err)
+		}
+	}
+	respondValidationError(c, errs)
+	return false
+}
+
+// CreateSignupRule adds a signup rule. Usernames are stored in canonical form
+// and domains lowercased; patterns are matched against the canonical username
+// or email, so they should be written in lowercase.
+// @Summary Create signup rule
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param payload body v1.SignupRuleRequest true "Rule"
+// @Success 201 {object} v1.SignupRuleResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse "signup_rule_exists"
+// @Router /api/v1/admin/signup-rules [post]
+func CreateSignupRule(c *gin.Context) {
+	var req v1.SignupRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	rule, errs := signupRuleFrom(req)
+	if len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+	if err := initializers.DB.Create(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondError(c, http.StatusConflict, "signup_rule_exists")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return
+	}
+	c.JSON(http.StatusCreated, v1.SignupRuleResponse{Data: v1.NewSignupRule(rule)})
+}
+
+// ListSignupRules lists the signup rules, optionally of one kind.
+// @Summary List signup rules
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param kind query string false "only rules of this kind"
+// @Success 200 {object} v1.SignupRuleListResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/signup-rules [get]
+func ListSignupRules(c *gin.Context) {
+	tx := initializers.DB.Order("id")
+	if kind := c.Query("kind"); kind != "" {
+		if !contains(signupRuleKinds, kind) {
+			respondError(c, http.StatusBadRequest, "invalid_filter", "kind must be one of "+strings.Join(signupRuleKinds, ", "))
+			return
+		}
+		tx = tx.Where("kind = ?", kind)
+	}
+	var rules []models.SignupRule
+	if err := tx.Find(&rules).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return
+	}
+	items := make([]v1.SignupRule, len(rules))
+	for i, r := range rules {
+		items[i] = v1.NewSignupRule(r)
+	}
+	c.JSON(http.StatusOK, v1.SignupRuleListResponse{Data: items})
+}
+
+// DeleteSignupRule removes a signup rule.
+// @Summary Delete signup rule
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Rule ID"
+// @Success 204
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/signup-rules/{id} [delete]
+func DeleteSignupRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "signup_rule_not_found")
+		return
+	}
+	res := initializers.DB.Delete(&models.SignupRule{}, id)
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return
+	}
+	if res.RowsAffected == 0 {
+		respondError(c, http.StatusNotFound, "signup_rule_not_found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetDisposableDomains describes the disposable email domain list in use. The
+// list is a file, DISPOSABLE_EMAIL_DOMAINS_FILE, picked up within
+// DISPOSABLE_EMAIL_DOMAINS_RELOAD of every change.
+// @Summary Disposable email domains
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} v1.DisposableDomainsResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/signup-rules/disposable-domains [get]
+func GetDisposableDomains(c *gin.Context) {
+	c.JSON(http.StatusOK, v1.DisposableDomainsResponse{Data: disposableDomainsDTO(services.Signups.Disposable())})
+}
+
+// ReloadDisposableDomains reads the disposable email domain file right away.
+// @Summary Reload disposable email domains
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} v1.DisposableDomainsResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/signup-rules/disposable-domains/reload [post]
+func ReloadDisposableDomains(c *gin.Context) {
+	if err := services.Signups.Reload(); err != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, v1.DisposableDomainsResponse{Data: disposableDomainsDTO(services.Signups.Disposable())})
+}
+
+// ListSignupRejections lists the writes refused by signup rules, newest first.
+// Rejections are kept for SIGNUP_REJECTION_RETENTION.
+// @Summary List signup rejections
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param rule query string false "only rejections by this kind of rule, e.g. disposable_domain"
+// @Param page query int false "page"
+// @Param page_size query int false "page size (max 100)"
+// @Success 200 {object} v1.SignupRejectionListResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/signup-rejections [get]
+func ListSignupRejections(c *gin.Context) {
+	page := parsePositiveInt(c.DefaultQuery("page", "1"), 1)
+	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "20"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	tx := initializers.DB.Model(&models.SignupRejection{})
+	var filters map[string]interface{}
+	if rule := c.Query("rule"); rule != "" {
+		if rule != models.RuleDisposableDomain && !contains(signupRuleKinds, rule) {
+			respondError(c, http.StatusBadRequest, "invalid_filter", "rule must be one of "+strings.Join(signupRuleKinds, ", ")+", "+models.RuleDisposableDomain)
+			return
+		}
+		tx = tx.Where("rule = ?", rule)
+		filters = map[string]interface{}{"rule": rule}
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return
+	}
+	var rejections []models.SignupRejection
+	if err := tx.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rejections).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "signup_rules_failed")
+		return
+	}
+
+	items := make([]v1.SignupRejection, len(rejections))
+	for i, r := range rejections {
+		items[i] = v1.NewSignupRejection(r)
+	}
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	c.JSON(http.StatusOK, v1.SignupRejectionListResponse{Data: items, Meta: v1.Pagination{
+		Mode:       paginationOffset,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: &total,
+		TotalPages: &totalPages,
+		Sort:       "created_at desc",
+		Filters:    filters,
+	}})
+}
+
+// signupRuleFrom checks a new rule and brings its value to the form it is
+// compared in.
+func signupRuleFrom(req v1.SignupRuleRequest) (models.SignupRule, validation.Errors) {
+	rule := models.SignupRule{Kind: req.Kind, Note: strings.TrimSpace(req.Note)}
+	var errs validation.Errors
+	if req.Kind == "" {
+		errs = append(errs, validation.NewFieldError("kind", validation.CodeRequired, nil))
+	} else if !contains(signupRuleKinds, req.Kind) {
+		errs = append(errs, validation.NewFieldError("kind", validation.CodeNotAllowed, i18n.Params{"allowed": strings.Join(signupRuleKinds, ", ")}))
+	}
+
+	value := strings.TrimSpace(req.Value)
+	switch req.Kind {
+	case models.RuleReservedUsername:
+		value = identity.Username(value)
+	case models.RuleBlockedDomain, models.RuleDomainCap:
+		value = services.NormalizeDomain(value)
+	}
+	switch {
+	case value == "":
+		errs = append(errs, validation.NewFieldError("value", validation.CodeRequired, nil))
+	case len([]rune(value)) > 255:
+		errs = append(errs, validation.NewFieldError("value", validation.CodeTooLong, i18n.Params{"max": 255}))
+	case req.Kind == models.RuleUsernamePattern || req.Kind == models.RuleEmailPattern:
+		if _, err := regexp.Compile(value); err != nil {
+			errs = append(errs, validation.NewFieldError("value", validation.CodeInvalidFormat, nil))
+		}
+	case req.Kind == models.RuleBlockedDomain || req.Kind == models.RuleDomainCap:
+		if value == services.AnyDomain && req.Kind == models.RuleDomainCap {
+			break
+		}
+		if strings.ContainsAny(value, "@*/ ") || !strings.Contains(value, ".") {
+			errs = append(errs, validation.NewFieldError("value", validation.CodeInvalidFormat, nil))
+		}
+	}
+	rule.Value = value
+
+	if req.Kind == models.RuleDomainCap {
+		if req.MaxSignups < 1 {
+			errs = append(errs, validation.NewFieldError("max_signups", validation.CodeRequired, nil))
+		}
+		rule.MaxSignups = req.MaxSignups
+	}
+	if len([]rune(rule.Note)) > 255 {
+		errs = append(errs, validation.NewFieldError("note", validation.CodeTooLong, i18n.Params{"max": 255}))
+	}
+	return rule, errs
+}
+
+func disposableDomainsDTO(list services.DisposableList) v1.DisposableDomains {
+	return v1.DisposableDomains{
+		File:       list.File,
+		Domains:    list.Domains,
+		ModifiedAt: list.ModifiedAt,
+		LoadedAt:   list.LoadedAt,
+	}
+}
@@ -1,41 +1,16 @@
 package controllers
 
-// UserDoc is a Swagger-only representation of User (avoids gorm.Model embedding).
-type UserDoc struct {
-	ID          uint   `json:"id"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
-	Bio         string `json:"bio"`
-	Gender      string `json:"gender"`
-	Nationality string `json:"nationality"`
-}
-
-type PaginationDoc struct {
-	Page       int               `json:"page"`
-	PageSize   int               `json:"page_size"`
-	TotalItems int64             `json:"total_items"`
-	TotalPages int               `json:"total_pages"`
-	Sort       string            `json:"sort"`
-	Search     string            `json:"search,omitempty"`
-	Filters    map[string]string `json:"filters,omitempty"`
-}
-
-type UserListResponseDoc struct {
-	Data []UserDoc     `json:"data"`
-	Meta PaginationDoc `json:"meta"`
-}
-
 type GroupUsersResponseDoc struct {
-	GroupBy []string                 `json:"group_by"`
-	Data    []map[string]interface{} `json:"data"`
+	GroupBy  []string                 `json:"group_by"`
+	Data     []map[string]interface{} `json:"data"`
+	Calendar string                   `json:"calendar,omitempty" example:"jalali"`
 }
 
 type ChallengeVerifyRequest struct {
     ChallengeID string `json:"challenge_id"`
 }
 type ChallengeVerifyResponse struct {
-    Valid bool   `json:"valid"`
-    Error string `json:"error,omitempty"`
+    Valid bool `json:"valid"`
 }
 
 type ChallengeResponse struct {
@@ -43,7 +18,24 @@ type ChallengeResponse struct {
     Note        string `json:"note,omitempty"`
 }
 
+// ErrorResponse is every error body, sent as application/problem+json (RFC 7807).
+// code is stable and listed in the i18n catalog; title is its message in the
+// Accept-Language language (en or fa).
 type ErrorResponse struct {
-    Error   string `json:"error"`
-    Details string `json:"details,omitempty"`
+    Type      string          `json:"type" example:"/problems/user_not_found"`
+    Title     string          `json:"title" example:"user not found"`
+    Status    int             `json:"status" example:"404"`
+    Detail    string          `json:"detail,omitempty"`
+    Instance  string          `json:"instance" example:"/api/v1/users/42"`
+    Code      string          `json:"code" example:"user_not_found"`
+    RequestID string          `json:"request_id" example:"3f2b8c1d9e0a4b7c8d6e5f4a3b2c1d0e"`
+    Fields    []FieldErrorDoc `json:"fields,omitempty"`
+}
+
+// FieldErrorDoc is one entry of ErrorResponse.fields on validation failures.
+type FieldErrorDoc struct {
+    Field   string `json:"field" example:"nationality"`
+    Code    string `json:"code" example:"invalid_country"`
+    Message string `json:"message" example:"nationality must be an ISO 3166-1 alpha-2 country code such as IR or DE"`
+    Params  map[string]interface{} `json:"params,omitempty"`
 }
@@ -4,100 +4,143 @@ import (
 	"errors"
 	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
 	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
 	"github.com/amirkhgraphic/go-arcaptcha-service/models"
 	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-type createUserRequest struct {
-	Username    string `json:"username" binding:"required"`
-	Email       string `json:"email" binding:"required,email"`
-	Bio         string `json:"bio"`
-	Gender      string `json:"gender"`
-	Nationality string `json:"nationality"`
-	ChallengeID string `json:"challenge_id" binding:"required"`
-}
-
-type updateUserRequest struct {
-	Username    *string `json:"username,omitempty"`
-	Email       *string `json:"email,omitempty"`
-	Bio         *string `json:"bio,omitempty"`
-	Gender      *string `json:"gender,omitempty"`
-	Nationality *string `json:"nationality,omitempty"`
-	ChallengeID string  `json:"challenge_id" binding:"required"`
-}
-
-type userListResponse struct {
-	Data []models.User `json:"data"`
-	Meta pagination    `json:"meta"`
-}
-
-type pagination struct {
-	Page       int    `json:"page"`
-	PageSize   int    `json:"page_size"`
-	TotalItems int64  `json:"total_items"`
-	TotalPages int    `json:"total_pages"`
-	Sort       string `json:"sort"`
-	Search     string `json:"search,omitempty"`
-	Filters    gin.H  `json:"filters,omitempty"`
-}
-
-// CreateUser creates a new user after captcha validation.
+// CreateUser creates a new user after the signup rules and captcha validation,
+// and mails it a link to verify its email. A bio the moderation checks flag
+// waits in the review queue.
 // @Summary Create user
 // @Accept json
 // @Produce json
-// @Param payload body createUserRequest true "User payload"
-// @Success 201 {object} controllers.UserDoc
-// @Failure 400 {object} controllers.ErrorResponse
-// @Router /api/users [post]
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "validate and check uniqueness and the captcha without saving or consuming the challenge"
+// @Param payload body v1.CreateUserRequest true "User payload"
+// @Success 201 {object} v1.UserResponse
+// @Failure 400 {object} controllers.ErrorResponse "invalid payload; validation failures list fields"
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 422 {object} controllers.ErrorResponse "Idempotency-Key reused for a different request"
+// @Router /api/v1/users [post]
 func CreateUser(c *gin.Context) {
-	var req createUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	dry, err := requestDryRun(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_dry_run", err.Error())
+		return
+	}
+
+	var req v1.CreateUserRequest
+	fieldErrs, err := bindingErrors(c.ShouldBindJSON(&req))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
 		return
 	}
 
-	if err := services.Arcaptcha.ValidateChallenge(req.ChallengeID); err != nil {
+	fields := fieldsFromV1(req.UserFields).normalized()
+	fieldErrs = append(fieldErrs, validation.ValidateUser(fields.validationInput())...)
+	if req.Password != "" {
+		fieldErrs = append(fieldErrs, validation.ValidatePassword("password", req.Password, fields.Username, fields.Email)...)
+	}
+	if len(fieldErrs) > 0 {
+		respondValidationError(c, fieldErrs)
+		return
+	}
+	if !enforceSignupRules(c, services.SignupAttempt{Username: fields.Username, Email: fields.Email, Signup: true}, nil) {
+		return
+	}
+
+	if err := checkChallenge(req.ChallengeID, dry); err != nil {
 		respondCaptchaError(c, err)
 		return
 	}
 
 	user := models.User{
-		Username:    req.Username,
-		Email:       req.Email,
-		Bio:         req.Bio,
-		Gender:      strings.TrimSpace(req.Gender),
-		Nationality: strings.TrimSpace(req.Nationality),
+		Username:    fields.Username,
+		Email:       fields.Email,
+		Bio:         fields.Bio,
+		Gender:      fields.Gender,
+		Nationality: fields.Nationality,
+		Version:     1,
+	}
+	user.ModerationStatus, user.ModerationFlags = bioModeration(c, user.Bio)
+	if req.Password != "" && !dry {
+		if user.PasswordHash, err = auth.HashPassword(req.Password); err != nil {
+			respondError(c, http.StatusInternalServerError, "user_create_failed")
+			return
+		}
 	}
 
-	if err := initializers.DB.Create(&user).Error; err != nil {
-		if strings.Contains(err.Error(), "unique") {
-			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+	err = writeUser(dry, func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return services.RecordUserRevision(tx, models.RevisionCreate, models.User{}, user, revisionContext(c, nil))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			respondError(c, http.StatusConflict, "user_exists")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create user"})
+		respondError(c, http.StatusInternalServerError, "user_create_failed")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"data": user})
+	if !dry {
+		sendVerificationMail(c, user)
+	}
+	c.Header("ETag", user.ETag())
+	c.JSON(http.StatusCreated, v1.UserResponse{Data: userDTO(user, cal)})
 }
 
 // ListUsers returns paginated users with search/filter options.
+// A search without an explicit sort is ordered by relevance (offset mode only),
+// and every item then carries its rank and a highlighted snippet.
+// Filters use filter[field][op]=value; see userFilterFields for the fields and
+// filterOps for the operators each field accepts.
+// Offset pagination (page/page_size) is the default. Passing after/before, or
+// pagination=cursor, switches to keyset pagination with opaque cursors.
 // @Summary List users
 // @Produce json
-// @Param page query int false "page"
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "page (offset mode)"
 // @Param page_size query int false "page size"
-// @Param sort query string false "sort (e.g. -created_at)"
-// @Param search query string false "search in username/email"
-// @Param username query string false "filter by username"
-// @Param email query string false "filter by email"
-// @Success 200 {object} controllers.UserListResponseDoc
-// @Router /api/users [get]
+// @Param pagination query string false "offset (default) or cursor"
+// @Param after query string false "cursor: return the page after this token"
+// @Param before query string false "cursor: return the page before this token"
+// @Param include_total query bool false "include total_items/total_pages (default true in offset mode, false in cursor mode)"
+// @Param sort query string false "sort (e.g. -created_at, or relevance when searching)"
+// @Param search query string false "full-text search in username/email/bio"
+// @Param username query string false "filter by username (shorthand for filter[username][eq])"
+// @Param email query string false "filter by email (shorthand for filter[email][eq])"
+// @Param gender query string false "filter by gender (shorthand for filter[gender][eq])"
+// @Param nationality query string false "filter by nationality (shorthand for filter[nationality][eq])"
+// @Param filter query string false "filter[field][op]=value, e.g. filter[nationality][in]=IR,DE or filter[created_at][gte]=2024-01-01"
+// @Param calendar query string false "gregorian (default) or jalali: adds *_at_jalali fields and reads date filters as Jalali"
+// @Param Accept-Calendar header string false "same as calendar"
+// @Param fields query string false "comma separated fields to return and select, e.g. id,username"
+// @Param expand query string false "comma separated expansions: canonical, counts, history"
+// @Param If-None-Match header string false "ETag of a previously fetched page"
+// @Success 200 {object} v1.UserListResponse
+// @Success 304 "page unchanged"
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users [get]
 func ListUsers(c *gin.Context) {
 	page := parsePositiveInt(c.DefaultQuery("page", "1"), 1)
 	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "10"), 10)
@@ -105,161 +148,479 @@ func ListUsers(c *gin.Context) {
 		pageSize = 100
 	}
 
-	sort := sanitizeSort(c.DefaultQuery("sort", "-created_at"))
+	after := strings.TrimSpace(c.Query("after"))
+	before := strings.TrimSpace(c.Query("before"))
+	mode := paginationOffset
+	if after != "" || before != "" || c.Query("pagination") == paginationCursor {
+		mode = paginationCursor
+	}
+	includeTotal := parseBoolQuery(c, "include_total", mode == paginationOffset)
+
 	search := strings.TrimSpace(c.Query("search"))
-	usernameFilter := strings.TrimSpace(c.Query("username"))
-	emailFilter := strings.TrimSpace(c.Query("email"))
+	terms := services.SearchTerms(search)
+	rawSort := c.Query("sort")
+	relevance := len(terms) > 0 && (rawSort == "relevance" || rawSort == "")
+	if relevance && mode == paginationCursor {
+		if rawSort == "relevance" {
+			respondError(c, http.StatusBadRequest, "relevance_offset_only")
+			return
+		}
+		relevance = false
+	}
+	if rawSort == "relevance" || rawSort == "" {
+		rawSort = "-created_at"
+	}
+	sort := sanitizeSort(rawSort)
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+	filters, err := parseUserFilters(c.Request.URL.Query(), cal)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+	shape, ok := parseUserShape(c)
+	if !ok {
+		return
+	}
 
 	var users []models.User
 	tx := initializers.DB.Model(&models.User{})
+	userSearch := services.UserSearchFor(initializers.DB)
 
-	if search != "" {
-		searchValue := "%" + strings.ToLower(search) + "%"
-		tx = tx.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", searchValue, searchValue)
+	if len(terms) > 0 {
+		tx = filterUserSearch(c, userSearch, tx, terms)
 	}
-	if usernameFilter != "" {
-		tx = tx.Where("username = ?", usernameFilter)
+	tx = applyUserFilters(tx, filters)
+
+	var total int64
+	if includeTotal {
+		if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "users_count_failed")
+			return
+		}
 	}
-	if emailFilter != "" {
-		tx = tx.Where("email = ?", emailFilter)
+
+	var meta v1.Pagination
+	if mode == paginationCursor {
+		users, meta, err = fetchUserPage(shape.selectColumns(tx, sort.Field), sort, pageSize, after, before)
+		if err != nil {
+			if code, ok := cursorErrorCodes[err]; ok {
+				respondError(c, http.StatusBadRequest, code)
+				return
+			}
+			respondError(c, http.StatusInternalServerError, "users_fetch_failed")
+			return
+		}
+	} else {
+		offset := (page - 1) * pageSize
+		pageTx := tx.Order(sort.order(false))
+		if relevance {
+			pageTx = userSearch.OrderByRank(tx, terms)
+		}
+		pageTx = shape.selectColumns(pageTx)
+		if err := pageTx.Limit(pageSize).Offset(offset).Find(&users).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "users_fetch_failed")
+			return
+		}
+		meta = v1.Pagination{Mode: paginationOffset, Page: page, PageSize: pageSize}
 	}
 
-	var total int64
-	if err := tx.Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not count users"})
-		return
+	if includeTotal {
+		totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+		if totalPages == 0 {
+			totalPages = 1
+		}
+		meta.TotalItems = &total
+		meta.TotalPages = &totalPages
+	}
+	meta.Sort = sort.String()
+	if relevance {
+		meta.Sort = "relevance"
+	}
+	meta.Search = search
+	meta.Filters = filtersMeta(filters)
+	meta.Fields, meta.Expand = shape.Fields, shape.Expand
+
+	items := make([]v1.UserListItem, len(users))
+	ids := make([]uint, len(users))
+	hiddenBios := map[uint]bool{}
+	for i, u := range users {
+		hiddenBios[u.ID] = hideUnapprovedBio(c, &u)
+		items[i].User = userDTO(u, cal)
+		items[i].ETag = u.ETag()
+		ids[i] = u.ID
+	}
+	if len(terms) > 0 && len(ids) > 0 {
+		// Snippets only quote the fields the caller asked for.
+		matches, err := userSearch.Matches(initializers.DB, terms, ids, shape.Fields)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "search_matches_failed")
+			return
+		}
+		for i := range items {
+			if m, ok := matches[items[i].ID]; ok {
+				items[i].Search = &v1.SearchResult{Rank: m.Rank, Snippet: m.Snippet}
+				if hiddenBios[items[i].ID] {
+					// The snippet may quote the hidden bio.
+					items[i].Search.Snippet = ""
+				}
+			}
+		}
 	}
 
-	offset := (page - 1) * pageSize
-	if err := tx.Order(sort).Limit(pageSize).Offset(offset).Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch users"})
+	expanded, err := shape.expand(initializers.DB, ids)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "users_fetch_failed")
 		return
 	}
+	hideExpandedHistoryBios(c, expanded)
+	for i := range items {
+		items[i].Expanded = expanded[items[i].ID]
+	}
 
-	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
-	if totalPages == 0 {
-		totalPages = 1
-	}
-
-	c.JSON(http.StatusOK, userListResponse{
-		Data: users,
-		Meta: pagination{
-			Page:       page,
-			PageSize:   pageSize,
-			TotalItems: total,
-			TotalPages: totalPages,
-			Sort:       sort,
-			Search:     search,
-			Filters: gin.H{
-				"username": usernameFilter,
-				"email":    emailFilter,
-			},
-		},
-	})
+	var resp interface{} = v1.UserListResponse{Data: items, Meta: meta}
+	if shape.Fields != nil {
+		data := make([]interface{}, len(items))
+		for i := range items {
+			data[i] = shape.render(items[i])
+		}
+		resp = gin.H{"data": data, "meta": meta}
+	}
+	if notModified(c, bodyETag(resp)) {
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// GetUser fetches a user by id.
+// GetUser fetches a user by id. The response carries the user's ETag and honors
+// If-None-Match with a 304. Shaped responses carry a weak ETag over the body
+// instead, which If-Match on writes does not accept.
 // @Summary Get user
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
-// @Success 200 {object} controllers.UserDoc
+// @Param calendar query string false "gregorian (default) or jalali: adds *_at_jalali fields"
+// @Param fields query string false "comma separated fields to return and select, e.g. id,username"
+// @Param expand query string false "comma separated expansions: canonical, counts, history"
+// @Param If-None-Match header string false "ETag of a previously fetched revision"
+// @Success 200 {object} v1.UserResponse
+// @Success 304 "user unchanged"
+// @Header 200 {string} ETag "current revision of the user, or a weak ETag over a shaped body"
 // @Failure 400 {object} controllers.ErrorResponse
-// @Router /api/users/{id} [get]
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id} [get]
 func GetUser(c *gin.Context) {
+	cal, ok := resolveCalendar(c)
+	if !ok {
+		return
+	}
+
+	shape, ok := parseUserShape(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
 	var user models.User
-	if err := initializers.DB.First(&user, id).Error; err != nil {
+	if err := shape.selectColumns(initializers.DB).First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			respondError(c, http.StatusNotFound, "user_not_found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch user"})
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": user})
+
+	hidden := hideUnapprovedBio(c, &user)
+	dto := userDTO(user, cal)
+	expanded, err := shape.expand(initializers.DB, []uint{user.ID})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
+		return
+	}
+	hideExpandedHistoryBios(c, expanded)
+	dto.Expanded = expanded[user.ID]
+	resp := gin.H{"data": shape.render(dto)}
+
+	// The version ETag only names the plain representation. A body shaped by
+	// calendar, fields or expand, or with the bio hidden from the caller, gets a
+	// weak ETag over the body, so one validator never stands for two bodies.
+	etag := user.ETag()
+	if hidden || cal != calendarGregorian || shape.Fields != nil || len(shape.Expand) > 0 {
+		etag = bodyETag(resp)
+	}
+	if notModified(c, etag) {
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // UpdateUser updates a user after captcha validation.
+// It accepts three bodies, picked by Content-Type:
+//   - application/json: the fields to change (absent fields are left alone);
+//   - application/merge-patch+json: an RFC 7386 merge patch, where null clears a field;
+//   - application/json-patch+json: RFC 6902 operations, including test.
+//
+// For the patch formats the challenge id comes from the X-Challenge-ID header
+// (or a challenge_id member of the merge patch).
+// Writes are guarded by the user's version: If-Match must name the current ETag
+// when sent (412 otherwise), and a concurrent update between read and write is
+// rejected instead of being silently overwritten.
 // @Summary Update user
 // @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int true "User ID"
-// @Param payload body updateUserRequest true "Fields to update"
-// @Success 200 {object} controllers.UserDoc
+// @Param If-Match header string false "ETag the update is based on"
+// @Param X-Challenge-ID header string false "captcha challenge for the patch formats"
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "validate and check uniqueness and the captcha without saving or consuming the challenge"
+// @Param payload body v1.UpdateUserRequest true "Fields to update"
+// @Success 200 {object} v1.UserResponse
+// @Header 200 {string} ETag "new revision of the user"
 // @Failure 400 {object} controllers.ErrorResponse
-// @Router /api/users/{id} [patch]
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Failure 415 {object} controllers.ErrorResponse
+// @Failure 422 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id} [patch]
 func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
+	user, ok := loadUserForWrite(c)
+	if !ok {
+		return
+	}
 
-	var req updateUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "details": err.Error()})
+	var (
+		target      userFields
+		challengeID string
+		err         error
+	)
+	switch c.ContentType() {
+	case mimeMergePatch:
+		target, challengeID, err = mergePatchUser(c, user)
+	case mimeJSONPatch:
+		target, challengeID, err = jsonPatchUser(c, user)
+	case "application/json", "":
+		target, challengeID, err = partialUpdateUser(c, user)
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"use application/json, "+mimeMergePatch+" or "+mimeJSONPatch)
+		return
+	}
+	fieldErrs, err := bindingErrors(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPatchTestFailed):
+			respondError(c, http.StatusConflict, "patch_test_failed", err.Error())
+		case errors.Is(err, errNothingToUpdate):
+			respondError(c, http.StatusBadRequest, "nothing_to_update")
+		default:
+			respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		}
 		return
 	}
 
-	if req.Username == nil && req.Email == nil && req.Bio == nil && req.Gender == nil && req.Nationality == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+	saveUserFields(c, user, target, challengeID, fieldErrs, models.RevisionUpdate, nil)
+}
+
+// ReplaceUser replaces every editable field of a user after captcha validation.
+// Optional fields missing from the body are cleared.
+// @Summary Replace user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param If-Match header string false "ETag the replacement is based on"
+// @Param Idempotency-Key header string false "replay the stored response for retries with this key"
+// @Param dry_run query bool false "validate and check uniqueness and the captcha without saving or consuming the challenge"
+// @Param payload body v1.ReplaceUserRequest true "Complete user"
+// @Success 200 {object} v1.UserResponse
+// @Header 200 {string} ETag "new revision of the user"
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 409 {object} controllers.ErrorResponse
+// @Failure 412 {object} controllers.ErrorResponse
+// @Failure 422 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Failure 403 {object} controllers.ErrorResponse
+// @Router /api/v1/users/{id} [put]
+func ReplaceUser(c *gin.Context) {
+	user, ok := loadUserForWrite(c)
+	if !ok {
 		return
 	}
 
-	if err := services.Arcaptcha.ValidateChallenge(req.ChallengeID); err != nil {
-		respondCaptchaError(c, err)
+	var req v1.ReplaceUserRequest
+	fieldErrs, err := bindingErrors(c.ShouldBindJSON(&req))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
 		return
 	}
 
+	saveUserFields(c, user, fieldsFromV1(req.UserFields), req.ChallengeID, fieldErrs, models.RevisionUpdate, nil)
+}
+
+// loadUserForWrite checks the response calendar, fetches the user named in the
+// path and checks If-Match. The precondition runs before the captcha so a stale
+// client keeps its token.
+func loadUserForWrite(c *gin.Context) (models.User, bool) {
+	return loadWriteTarget(c, initializers.DB)
+}
+
+// loadWriteTarget is loadUserForWrite reading through db, which restores pass
+// unscoped to reach deleted users.
+func loadWriteTarget(c *gin.Context, db *gorm.DB) (models.User, bool) {
 	var user models.User
-	if err := initializers.DB.First(&user, id).Error; err != nil {
+	if _, ok := resolveCalendar(c); !ok {
+		return user, false
+	}
+	if _, err := requestDryRun(c); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_dry_run", err.Error())
+		return user, false
+	}
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-			return
+			respondError(c, http.StatusNotFound, "user_not_found")
+			return user, false
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch user"})
-		return
+		respondError(c, http.StatusInternalServerError, "user_fetch_failed")
+		return user, false
 	}
 
-	updates := make(map[string]interface{})
-	if req.Username != nil {
-		updates["username"] = strings.TrimSpace(*req.Username)
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && !etagMatches(ifMatch, user.ETag(), false) {
+		c.Header("ETag", user.ETag())
+		respondError(c, http.StatusPreconditionFailed, "precondition_failed")
+		return user, false
 	}
-	if req.Email != nil {
-		updates["email"] = strings.TrimSpace(*req.Email)
+	return user, true
+}
+
+// saveUserFields is the single write path behind PATCH, PUT and revert: validate
+// the changed fields of the target state (alongside any binding errors already
+// found), check a new username or email against the signup rules, consume the
+// captcha, then persist the changed columns guarded by version and record the
+// revision as action. A new email is unverified until the link mailed to it is
+// opened, and a new bio is moderated again.
+func saveUserFields(c *gin.Context, user models.User, target userFields, challengeID string, fieldErrs validation.Errors, action string, revertedTo *uint) {
+	cal, _ := requestCalendar(c)
+	dry, _ := requestDryRun(c)
+	target = target.normalized()
+	updates := target.changes(user)
+	if len(updates) > 0 {
+		changed := make([]string, 0, len(updates))
+		for field := range updates {
+			changed = append(changed, field)
+		}
+		sort.Strings(changed)
+		fieldErrs = append(fieldErrs, validation.ValidateUser(target.validationInput(), changed...)...)
 	}
-	if req.Bio != nil {
-		updates["bio"] = *req.Bio
+	if len(fieldErrs) > 0 {
+		respondValidationError(c, fieldErrs)
+		return
+	}
+	var attempt services.SignupAttempt
+	if _, ok := updates["username"]; ok {
+		attempt.Username = target.Username
 	}
-	if req.Gender != nil {
-		updates["gender"] = strings.TrimSpace(*req.Gender)
+	if _, ok := updates["email"]; ok {
+		attempt.Email = target.Email
+	}
+	if (attempt.Username != "" || attempt.Email != "") && !enforceSignupRules(c, attempt, &user.ID) {
+		return
 	}
-	if req.Nationality != nil {
-		updates["nationality"] = strings.TrimSpace(*req.Nationality)
+
+	if err := checkChallenge(challengeID, dry); err != nil {
+		respondCaptchaError(c, err)
+		return
 	}
 
-	if err := initializers.DB.Model(&user).Updates(updates).Error; err != nil {
-		if strings.Contains(err.Error(), "unique") {
-			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+	if len(updates) == 0 {
+		c.Header("ETag", user.ETag())
+		c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
+		return
+	}
+	if _, ok := updates["bio"]; ok {
+		updates["moderation_status"], updates["moderation_flags"] = bioModeration(c, target.Bio)
+	}
+	_, emailChanged := updates["email"]
+	if emailChanged {
+		updates["email_verified"] = false
+		updates["email_verified_at"] = nil
+	}
+	updates["version"] = gorm.Expr("version + 1")
+
+	before := user
+	err := writeUser(dry, func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND version = ?", user.ID, user.Version).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errStaleVersion
+		}
+		if err := tx.First(&user, user.ID).Error; err != nil {
+			return err
+		}
+		return services.RecordUserRevision(tx, action, before, user, revisionContext(c, revertedTo))
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		respondError(c, http.StatusConflict, "user_exists")
+		return
+	case errors.Is(err, errStaleVersion):
+		if c.GetHeader("If-Match") != "" {
+			respondError(c, http.StatusPreconditionFailed, "precondition_failed")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update user"})
+		respondError(c, http.StatusConflict, "concurrent_update")
+		return
+	default:
+		respondError(c, http.StatusInternalServerError, "user_update_failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": user})
+	if emailChanged && !dry {
+		sendVerificationMail(c, user)
+	}
+	c.Header("ETag", user.ETag())
+	c.JSON(http.StatusOK, v1.UserResponse{Data: userDTO(user, cal)})
 }
 
+// errStaleVersion means the user changed between read and write.
+var errStaleVersion = errors.New("user version changed")
+
 func respondCaptchaError(c *gin.Context, err error) {
+	status, code := captchaError(err)
+	respondError(c, status, code)
+}
+
+// captchaError maps an Arcaptcha error to its status and catalog code.
+func captchaError(err error) (int, string) {
 	switch err {
 	case services.ErrChallengeEmpty:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_id is required"})
+		return http.StatusBadRequest, "challenge_required"
 	case services.ErrChallengeInvalid:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "captcha did not match the issued challenge"})
+		return http.StatusBadRequest, "challenge_mismatch"
 	case services.ErrChallengeNetwork:
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "captcha provider unavailable, try again"})
+		return http.StatusServiceUnavailable, "captcha_unavailable"
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "captcha validation failed"})
+		return http.StatusBadRequest, "captcha_failed"
 	}
 }
 
-func sanitizeSort(raw string) string {
+func sanitizeSort(raw string) sortSpec {
 	allowed := map[string]bool{
 		"username":   true,
 		"email":      true,
@@ -268,13 +629,13 @@ func sanitizeSort(raw string) string {
 	}
 
 	if raw == "" {
-		return "created_at desc"
+		return sortSpec{Field: "created_at", Desc: true}
 	}
 
-	dir := "asc"
+	desc := false
 	field := raw
 	if strings.HasPrefix(raw, "-") {
-		dir = "desc"
+		desc = true
 		field = strings.TrimPrefix(raw, "-")
 	} else if strings.HasPrefix(raw, "+") {
 		field = strings.TrimPrefix(raw, "+")
@@ -284,7 +645,7 @@ func sanitizeSort(raw string) string {
 		field = "created_at"
 	}
 
-	return field + " " + dir
+	return sortSpec{Field: field, Desc: desc}
 }
 
 func parsePositiveInt(value string, defaultVal int) int {
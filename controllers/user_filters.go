@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/textnorm"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type filterKind int
+
+const (
+	filterText filterKind = iota
+	filterTime
+)
+
+// userFilterFields lists the columns that may appear in filter[field][op] and
+// how their values are parsed.
+var userFilterFields = map[string]filterKind{
+	"username":          filterText,
+	"email":             filterText,
+	"gender":            filterText,
+	"nationality":       filterText,
+	"moderation_status": filterText,
+	"created_at":        filterTime,
+	"updated_at":        filterTime,
+}
+
+// filterOps lists the operators per field kind. Text operators can be negated with
+// a not_ prefix (not_eq, not_in, not_prefix, not_contains).
+var filterOps = map[filterKind]map[string]bool{
+	filterText: {"eq": true, "in": true, "prefix": true, "contains": true},
+	filterTime: {"eq": true, "gt": true, "gte": true, "lt": true, "lte": true},
+}
+
+// canonicalFilterFields are compared through their canonical column for eq and
+// in, so filters are case-insensitive the way the unique indexes are.
+var canonicalFilterFields = map[string]struct {
+	column    string
+	canonical func(string) string
+}{
+	"username": {"username_canonical", identity.Username},
+	"email":    {"email_canonical", identity.Email},
+}
+
+// legacyFilterParams are the plain query params that predate filter[...] and are
+// treated as filter[field][eq].
+var legacyFilterParams = []string{"username", "email", "gender", "nationality"}
+
+var filterKeyPattern = regexp.MustCompile(`^filter\[([a-z_]+)\](?:\[([a-z_]+)\])?$`)
+
+// userFilter is one parsed filter[field][op]=value condition.
+type userFilter struct {
+	Field  string
+	Op     string
+	Values []string
+	cond   string
+	args   []interface{}
+}
+
+func (f userFilter) negated() bool {
+	return strings.HasPrefix(f.Op, "not_")
+}
+
+func (f userFilter) baseOp() string {
+	return strings.TrimPrefix(f.Op, "not_")
+}
+
+// parseUserFilters reads both the legacy shorthand params and the
+// filter[field][op]=value syntax. Unknown fields, unknown operators and values that
+// do not parse are reported as errors so callers can answer with a 400. Text
+// values are folded with textnorm.Compact, as usernames and emails are on write.
+// Date-only time values are read in cal (see requestCalendar).
+func parseUserFilters(query url.Values, cal string) ([]userFilter, error) {
+	byKey := map[string]*userFilter{}
+	var keys []string
+
+	add := func(field, op string, raw []string) error {
+		kind, ok := userFilterFields[field]
+		if !ok {
+			return fmt.Errorf("unknown filter field %q", field)
+		}
+		base := op
+		if kind == filterText {
+			base = strings.TrimPrefix(op, "not_")
+		}
+		if !filterOps[kind][base] {
+			return fmt.Errorf("operator %q is not supported for %q", op, field)
+		}
+
+		var values []string
+		for _, r := range raw {
+			if kind == filterText {
+				r = textnorm.Compact(r)
+			} else {
+				r = textnorm.Normalize(r)
+			}
+			if base == "in" {
+				values = append(values, splitList(r)...)
+				continue
+			}
+			if v := strings.TrimSpace(r); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return nil
+		}
+
+		key := field + "[" + op + "]"
+		f, exists := byKey[key]
+		if !exists {
+			f = &userFilter{Field: field, Op: op}
+			byKey[key] = f
+			keys = append(keys, key)
+		}
+		f.Values = append(f.Values, values...)
+		if base != "in" && len(f.Values) > 1 {
+			return fmt.Errorf("filter %s accepts a single value", key)
+		}
+		return nil
+	}
+
+	for _, field := range legacyFilterParams {
+		if raw, ok := query[field]; ok {
+			if err := add(field, "eq", raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var filterKeys []string
+	for key := range query {
+		if strings.HasPrefix(key, "filter[") {
+			filterKeys = append(filterKeys, key)
+		}
+	}
+	sort.Strings(filterKeys)
+	for _, key := range filterKeys {
+		m := filterKeyPattern.FindStringSubmatch(key)
+		if m == nil {
+			return nil, fmt.Errorf("malformed filter %q, expected filter[field][op]", key)
+		}
+		op := m[2]
+		if op == "" {
+			op = "eq"
+		}
+		if err := add(m[1], op, query[key]); err != nil {
+			return nil, err
+		}
+	}
+
+	filters := make([]userFilter, 0, len(keys))
+	for _, key := range keys {
+		f := *byKey[key]
+		cond, args, err := filterCondition(f, cal)
+		if err != nil {
+			return nil, err
+		}
+		f.cond, f.args = cond, args
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// filterCondition builds the WHERE fragment for f. Column names come from
+// userFilterFields, never from the request, so they are safe to interpolate.
+func filterCondition(f userFilter, cal string) (string, []interface{}, error) {
+	col := f.Field
+
+	if userFilterFields[f.Field] == filterTime {
+		raw := f.Values[0]
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			ops := map[string]string{"eq": "=", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+			return col + " " + ops[f.Op] + " ?", []interface{}{t.Local()}, nil
+		}
+		// A bare date covers the whole day, so compare against midnights.
+		day, next, err := parseCalendarDate(raw, cal)
+		if err != nil {
+			return "", nil, fmt.Errorf("filter %s[%s]: %q is not an RFC 3339 timestamp or YYYY-MM-DD %s date", f.Field, f.Op, raw, cal)
+		}
+		// Timestamps are stored in the server's zone; bind in the same zone so
+		// SQLite's text comparison stays chronological.
+		day, next = day.Local(), next.Local()
+		switch f.Op {
+		case "eq":
+			return col + " >= ? AND " + col + " < ?", []interface{}{day, next}, nil
+		case "gt":
+			return col + " >= ?", []interface{}{next}, nil
+		case "gte":
+			return col + " >= ?", []interface{}{day}, nil
+		case "lt":
+			return col + " < ?", []interface{}{day}, nil
+		default:
+			return col + " < ?", []interface{}{next}, nil
+		}
+	}
+
+	values := f.Values
+	if c, ok := canonicalFilterFields[f.Field]; ok && (f.baseOp() == "eq" || f.baseOp() == "in") {
+		col = c.column
+		values = make([]string, len(f.Values))
+		for i, v := range f.Values {
+			values[i] = c.canonical(v)
+		}
+	}
+
+	var cond string
+	var arg interface{}
+	switch f.baseOp() {
+	case "in":
+		cond, arg = col+" IN ?", values
+	case "prefix":
+		cond, arg = "LOWER("+col+") LIKE ? ESCAPE '\\'", escapeLike(strings.ToLower(f.Values[0]))+"%"
+	case "contains":
+		cond, arg = "LOWER("+col+") LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(f.Values[0]))+"%"
+	default:
+		cond, arg = col+" = ?", values[0]
+	}
+	if f.negated() {
+		cond = "NOT (" + cond + ")"
+	}
+	return cond, []interface{}{arg}, nil
+}
+
+// applyUserFilters adds one WHERE clause per parsed filter.
+func applyUserFilters(tx *gorm.DB, filters []userFilter) *gorm.DB {
+	for _, f := range filters {
+		tx = tx.Where(f.cond, f.args...)
+	}
+	return tx
+}
+
+// filtersMeta echoes the applied filters as {field: {op: value}}; in/not_in
+// report their value list, every other operator its single value.
+func filtersMeta(filters []userFilter) gin.H {
+	if len(filters) == 0 {
+		return nil
+	}
+	out := gin.H{}
+	for _, f := range filters {
+		ops, ok := out[f.Field].(gin.H)
+		if !ok {
+			ops = gin.H{}
+			out[f.Field] = ops
+		}
+		if f.baseOp() == "in" {
+			ops[f.Op] = f.Values
+		} else {
+			ops[f.Op] = f.Values[0]
+		}
+	}
+	return out
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseUserFilters(t *testing.T) {
+	day := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC).Local()
+	next := day.AddDate(0, 0, 1)
+
+	cases := []struct {
+		query string
+		cond  string
+		args  string
+	}{
+		{"gender=female", "gender = ?", "[female]"},
+		{"filter[gender]=female", "gender = ?", "[female]"},
+		{"filter[nationality][in]=IR,DE&filter[nationality][in]=FR", "nationality IN ?", "[[IR DE FR]]"},
+		{"filter[nationality][not_in]=IR", "NOT (nationality IN ?)", "[[IR]]"},
+		{"filter[moderation_status][not_eq]=approved", "NOT (moderation_status = ?)", "[approved]"},
+		// Usernames and emails match case-insensitively, like their unique indexes.
+		{"email=Foo@X.com", "email_canonical = ?", "[foo@x.com]"},
+		{"filter[username][in]=Alice,ＢＯＢ", "username_canonical IN ?", "[[alice bob]]"},
+		{"filter[username][not_eq]=Alice", "NOT (username_canonical = ?)", "[alice]"},
+		{"filter[username][prefix]=Al_", `LOWER(username) LIKE ? ESCAPE '\'`, `[al\_%]`},
+		{"filter[email][contains]=50%25", `LOWER(email) LIKE ? ESCAPE '\'`, `[%50\%%]`},
+		// Persian digits are folded as they are on write.
+		{"filter[gender][eq]=x۱", "gender = ?", "[x1]"},
+		{"filter[created_at][gte]=2024-03-20", "created_at >= ?", fmt.Sprint([]interface{}{day})},
+		{"filter[created_at][gt]=2024-03-20", "created_at >= ?", fmt.Sprint([]interface{}{next})},
+		{"filter[created_at]=2024-03-20", "created_at >= ? AND created_at < ?", fmt.Sprint([]interface{}{day, next})},
+		{"filter[updated_at][lt]=2024-03-20T00:00:00Z", "updated_at < ?", fmt.Sprint([]interface{}{day})},
+		// Empty values are ignored.
+		{"filter[gender]=", "", ""},
+	}
+	for _, tc := range cases {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filters, err := parseUserFilters(query, calendarGregorian)
+		if err != nil {
+			t.Errorf("%s: parseUserFilters() error = %v", tc.query, err)
+			continue
+		}
+		if tc.cond == "" {
+			if len(filters) != 0 {
+				t.Errorf("%s: got %d filters, want none", tc.query, len(filters))
+			}
+			continue
+		}
+		if len(filters) != 1 {
+			t.Errorf("%s: got %d filters, want 1", tc.query, len(filters))
+			continue
+		}
+		if f := filters[0]; f.cond != tc.cond || fmt.Sprint(f.args) != tc.args {
+			t.Errorf("%s: condition = %q %v, want %q %s", tc.query, f.cond, f.args, tc.cond, tc.args)
+		}
+	}
+}
+
+func TestParseUserFiltersErrors(t *testing.T) {
+	queries := []string{
+		"filter[password_hash]=x",
+		"filter[gender][gt]=f",
+		"filter[created_at][prefix]=2024",
+		"filter[created_at][not_eq]=2024-01-01",
+		"filter[gender][like]=f",
+		"filter[gender][eq]=a&filter[gender][eq]=b",
+		"filter[created_at]=yesterday",
+		"filter[created_at]=2024-02-30",
+		"filter[gender",
+		"filter[Gender]=f",
+	}
+	for _, q := range queries {
+		query, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseUserFilters(query, calendarGregorian); err == nil {
+			t.Errorf("%s: parseUserFilters() succeeded, want an error", q)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/textnorm"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+
+	// challengeHeader carries the captcha challenge when the body format has no
+	// room for it (JSON Patch) or the client prefers not to mix it into the patch.
+	challengeHeader = "X-Challenge-ID"
+)
+
+var (
+	errPatchInvalid    = errors.New("invalid patch")
+	errPatchTestFailed = errors.New("patch test operation failed")
+)
+
+// patchOp is one RFC 6902 operation.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	// HasValue is set when the operation has a value member, null included.
+	HasValue bool `json:"-"`
+}
+
+// UnmarshalJSON decodes an operation and records whether value was present, as
+// null is a valid value and only a missing one is an error.
+func (op *patchOp) UnmarshalJSON(data []byte) error {
+	type plain patchOp
+	if err := json.Unmarshal(data, (*plain)(op)); err != nil {
+		return err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	_, op.HasValue = members["value"]
+	return nil
+}
+
+// applyMergePatch applies an RFC 7386 merge patch: objects merge recursively, null
+// removes a member and any other value replaces the target.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = applyMergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// applyJSONPatch applies RFC 6902 operations in order. A failed test operation
+// returns errPatchTestFailed; every other problem wraps errPatchInvalid.
+func applyJSONPatch(doc interface{}, ops []patchOp) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			if errors.Is(err, errPatchTestFailed) {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("%w: operation %d (%s %s): %v", errPatchInvalid, i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op patchOp) (interface{}, error) {
+	value := func() (interface{}, error) {
+		if !op.HasValue {
+			return nil, errors.New("missing value")
+		}
+		var v interface{}
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, op.Path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = pointerRemove(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "move":
+		if op.Path == op.From || strings.HasPrefix(op.Path, op.From+"/") {
+			if op.Path == op.From {
+				return doc, nil
+			}
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, v, err := pointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "copy":
+		v, err := pointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, deepCopy(v))
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := pointerGet(doc, op.Path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// splitPointer decodes an RFC 6901 JSON pointer into its reference tokens.
+func splitPointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", path)
+	}
+	parts := strings.Split(path[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+func pointerGet(doc interface{}, path string) (interface{}, error) {
+	parts, err := splitPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, p := range parts {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[p]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", path)
+			}
+			cur = v
+		case []interface{}:
+			i, err := arrayIndex(p, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[i]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", path)
+		}
+	}
+	return cur, nil
+}
+
+// editParent walks to the container holding the last token of parts and lets fn
+// return that container's replacement, rebuilding the path back up to the root.
+func editParent(node interface{}, parts []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(parts) == 1 {
+		return fn(node, parts[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", parts[0])
+		}
+		updated, err := editParent(child, parts[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[parts[0]] = updated
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(parts[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := editParent(n[i], parts[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%q is not a container", parts[0])
+	}
+}
+
+// pointerAdd sets value at path. Object members are created or replaced; array
+// targets insert before the index, and "-" appends.
+func pointerAdd(doc interface{}, path string, value interface{}) (interface{}, error) {
+	parts, err := splitPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return value, nil
+	}
+	return editParent(doc, parts, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i := len(node)
+			if key != "-" {
+				var err error
+				if i, err = arrayIndex(key, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("parent of %q is not a container", path)
+		}
+	})
+}
+
+// pointerRemove deletes the value at path and returns it.
+func pointerRemove(doc interface{}, path string) (interface{}, interface{}, error) {
+	parts, err := splitPointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	doc, err = editParent(doc, parts, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", path)
+			}
+			removed = v
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %q does not exist", path)
+		}
+	})
+	return doc, removed, err
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	raw, _ := json.Marshal(v)
+	var out interface{}
+	_ = json.Unmarshal(raw, &out)
+	return out
+}
+
+var errNothingToUpdate = errors.New("nothing to update")
+
+// userFields is the editable state of a user. Create and PUT take it wholesale
+// and both patch formats are applied to it, so every write path runs the same
+// validation.ValidateUser rules. It is mapped from the request DTOs and never
+// serialized itself.
+type userFields struct {
+	Username    string
+	Email       string
+	Bio         string
+	Gender      string
+	Nationality string
+}
+
+func fieldsFromV1(f v1.UserFields) userFields {
+	return userFields{
+		Username:    f.Username,
+		Email:       f.Email,
+		Bio:         f.Bio,
+		Gender:      f.Gender,
+		Nationality: f.Nationality,
+	}
+}
+
+func fieldsOf(u models.User) userFields {
+	return fieldsFromV1(v1.FieldsOf(u))
+}
+
+// normalized trims the fields, folds Arabic/Persian letter and digit variants
+// (textnorm) and puts the enum-like ones in canonical case, so "IR " and "ir" are
+// stored and validated as "IR".
+func (f userFields) normalized() userFields {
+	f.Username = textnorm.Compact(strings.TrimSpace(f.Username))
+	f.Email = textnorm.Compact(strings.TrimSpace(f.Email))
+	f.Bio = textnorm.Normalize(f.Bio)
+	f.Gender = strings.ToLower(strings.TrimSpace(f.Gender))
+	f.Nationality = strings.ToUpper(strings.TrimSpace(f.Nationality))
+	return f
+}
+
+func (f userFields) validationInput() validation.User {
+	return validation.User{
+		Username:    f.Username,
+		Email:       f.Email,
+		Bio:         f.Bio,
+		Gender:      f.Gender,
+		Nationality: f.Nationality,
+	}
+}
+
+// changes returns the columns whose value differs between f and u. A new username
+// or email also rewrites its canonical column.
+func (f userFields) changes(u models.User) map[string]interface{} {
+	updates := make(map[string]interface{})
+	current := fieldsOf(u)
+	if f.Username != current.Username {
+		updates["username"] = f.Username
+		updates["username_canonical"] = identity.Username(f.Username)
+	}
+	if f.Email != current.Email {
+		updates["email"] = f.Email
+		updates["email_canonical"] = identity.Email(f.Email)
+	}
+	if f.Bio != current.Bio {
+		updates["bio"] = f.Bio
+	}
+	if f.Gender != current.Gender {
+		updates["gender"] = f.Gender
+	}
+	if f.Nationality != current.Nationality {
+		updates["nationality"] = f.Nationality
+	}
+	return updates
+}
+
+// userDocument renders the editable fields as the generic JSON document that both
+// patch formats operate on.
+func userDocument(u models.User) interface{} {
+	raw, _ := json.Marshal(v1.FieldsOf(u))
+	var doc interface{}
+	_ = json.Unmarshal(raw, &doc)
+	return doc
+}
+
+// decodeUserDocument turns a patched document back into userFields, rejecting
+// members that are not editable user fields.
+func decodeUserDocument(doc interface{}) (userFields, error) {
+	var f v1.UserFields
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return userFields{}, errors.New("patched document must be a JSON object")
+	}
+	raw, _ := json.Marshal(doc)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&f)
+	return fieldsFromV1(f), err
+}
+
+func partialUpdateUser(c *gin.Context, user models.User) (userFields, string, error) {
+	var req v1.UpdateUserRequest
+	// Binding tag failures are returned with the target so they are reported
+	// together with the field rules.
+	err := c.ShouldBindJSON(&req)
+	var verrs validator.ValidationErrors
+	if err != nil && !errors.As(err, &verrs) {
+		return userFields{}, "", err
+	}
+	if req.Username == nil && req.Email == nil && req.Bio == nil && req.Gender == nil && req.Nationality == nil {
+		return userFields{}, "", errNothingToUpdate
+	}
+
+	target := fieldsOf(user)
+	if req.Username != nil {
+		target.Username = *req.Username
+	}
+	if req.Email != nil {
+		target.Email = *req.Email
+	}
+	if req.Bio != nil {
+		target.Bio = *req.Bio
+	}
+	if req.Gender != nil {
+		target.Gender = *req.Gender
+	}
+	if req.Nationality != nil {
+		target.Nationality = *req.Nationality
+	}
+	return target, req.ChallengeID, err
+}
+
+func mergePatchUser(c *gin.Context, user models.User) (userFields, string, error) {
+	var patch map[string]interface{}
+	if err := c.ShouldBindBodyWith(&patch, binding.JSON); err != nil {
+		return userFields{}, "", fmt.Errorf("merge patch must be a JSON object: %v", err)
+	}
+
+	challengeID := c.GetHeader(challengeHeader)
+	if v, ok := patch["challenge_id"].(string); ok {
+		challengeID = v
+	}
+	delete(patch, "challenge_id")
+
+	target, err := decodeUserDocument(applyMergePatch(userDocument(user), patch))
+	return target, challengeID, err
+}
+
+func jsonPatchUser(c *gin.Context, user models.User) (userFields, string, error) {
+	var ops []patchOp
+	if err := c.ShouldBindBodyWith(&ops, binding.JSON); err != nil {
+		return userFields{}, "", fmt.Errorf("json patch must be an array of operations: %v", err)
+	}
+
+	doc, err := applyJSONPatch(userDocument(user), ops)
+	if err != nil {
+		return userFields{}, "", err
+	}
+	target, err := decodeUserDocument(doc)
+	return target, c.GetHeader(challengeHeader), err
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"add into array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"add appends", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove from array", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"replace", `{"bio":"old"}`, `[{"op":"replace","path":"/bio","value":"new"}]`, `{"bio":"new"}`},
+		{"replace with null", `{"bio":"old"}`, `[{"op":"replace","path":"/bio","value":null}]`, `{"bio":null}`},
+		{"move", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"move onto itself", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`, `{"m~n":3}`},
+		{"test passes", `{"a":[1,"x"]}`, `[{"op":"test","path":"/a","value":[1,"x"]},{"op":"add","path":"/b","value":true}]`, `{"a":[1,"x"],"b":true}`},
+		{"test null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`},
+	}
+	for _, tc := range cases {
+		var doc interface{}
+		var ops []patchOp
+		if err := json.Unmarshal([]byte(tc.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tc.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyJSONPatch(doc, ops)
+		if err != nil {
+			t.Errorf("%s: applyJSONPatch() error = %v", tc.name, err)
+			continue
+		}
+		if raw, _ := json.Marshal(got); string(raw) != tc.want {
+			t.Errorf("%s: applyJSONPatch() = %s, want %s", tc.name, raw, tc.want)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		patch string
+		want  error
+	}{
+		{"test fails", `[{"op":"test","path":"/a","value":2}]`, errPatchTestFailed},
+		{"test of a missing member", `[{"op":"test","path":"/x","value":null}]`, errPatchTestFailed},
+		{"missing value", `[{"op":"replace","path":"/a"}]`, errPatchInvalid},
+		{"unknown op", `[{"op":"increment","path":"/a"}]`, errPatchInvalid},
+		{"remove missing member", `[{"op":"remove","path":"/x"}]`, errPatchInvalid},
+		{"replace missing member", `[{"op":"replace","path":"/x","value":1}]`, errPatchInvalid},
+		{"remove whole document", `[{"op":"remove","path":""}]`, errPatchInvalid},
+		{"pointer without slash", `[{"op":"add","path":"a","value":1}]`, errPatchInvalid},
+		{"index out of range", `[{"op":"add","path":"/l/3","value":1}]`, errPatchInvalid},
+		{"leading zero index", `[{"op":"remove","path":"/l/01"}]`, errPatchInvalid},
+		{"move into own child", `[{"op":"move","from":"/o","path":"/o/p"}]`, errPatchInvalid},
+		{"add under a scalar", `[{"op":"add","path":"/a/b","value":1}]`, errPatchInvalid},
+	}
+	for _, tc := range cases {
+		var doc interface{}
+		var ops []patchOp
+		_ = json.Unmarshal([]byte(`{"a":1,"l":[1,2],"o":{}}`), &doc)
+		if err := json.Unmarshal([]byte(tc.patch), &ops); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := applyJSONPatch(doc, ops); !errors.Is(err, tc.want) {
+			t.Errorf("%s: applyJSONPatch() error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// The examples of RFC 7386, appendix A.
+	cases := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range cases {
+		var target, patch interface{}
+		if err := json.Unmarshal([]byte(tc.target), &target); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tc.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		if raw, _ := json.Marshal(applyMergePatch(target, patch)); string(raw) != tc.want {
+			t.Errorf("applyMergePatch(%s, %s) = %s, want %s", tc.target, tc.patch, raw, tc.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// userFieldColumns maps the public user fields accepted by fields= to their
+// columns, in the order they are rendered.
+var userFieldColumns = []struct{ Field, Column string }{
+	{"id", "id"},
+	{"username", "username"},
+	{"email", "email"},
+	{"email_verified", "email_verified"},
+	{"bio", "bio"},
+	{"moderation_status", "moderation_status"},
+	{"gender", "gender"},
+	{"nationality", "nationality"},
+	{"version", "version"},
+	{"created_at", "created_at"},
+	{"updated_at", "updated_at"},
+}
+
+// userExpansion loads optional related data for a set of users, keyed by id.
+type userExpansion func(db *gorm.DB, ids []uint) (map[uint]interface{}, error)
+
+// userExpansions is the registry behind expand=. Each entry adds
+// expanded.<name> to every returned user.
+var userExpansions = map[string]userExpansion{
+	"canonical": expandCanonical,
+	"counts":    expandCounts,
+	"history":   expandHistory,
+}
+
+// userShape is the response shape asked for with fields= and expand=.
+type userShape struct {
+	// Fields are the public fields to return; nil means all of them.
+	Fields []string
+	Expand []string
+}
+
+// parseUserShape reads fields= and expand=, answering 400 for unknown names.
+func parseUserShape(c *gin.Context) (userShape, bool) {
+	var shape userShape
+	if raw, ok := c.GetQuery("fields"); ok {
+		known := map[string]bool{}
+		for _, fc := range userFieldColumns {
+			known[fc.Field] = true
+		}
+		for _, f := range splitList(raw) {
+			if !known[f] {
+				respondError(c, http.StatusBadRequest, "invalid_fields", fmt.Sprintf("unknown field %q", f))
+				return shape, false
+			}
+			shape.Fields = appendUnique(shape.Fields, f)
+		}
+		if len(shape.Fields) == 0 {
+			respondError(c, http.StatusBadRequest, "invalid_fields", "fields must name at least one field")
+			return shape, false
+		}
+	}
+	for _, name := range splitList(c.Query("expand")) {
+		if _, ok := userExpansions[name]; !ok {
+			respondError(c, http.StatusBadRequest, "invalid_expand", fmt.Sprintf("unknown expansion %q, use %s", name, expansionNames()))
+			return shape, false
+		}
+		shape.Expand = appendUnique(shape.Expand, name)
+	}
+	return shape, true
+}
+
+// has reports whether field is part of the response.
+func (s userShape) has(field string) bool {
+	if s.Fields == nil {
+		return true
+	}
+	for _, f := range s.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// columns returns the users columns to SELECT: the requested fields plus id and
+// version (always needed for ETags and expansions) and any extra columns the
+// query relies on, such as the sort key of a cursor.
+func (s userShape) columns(extra ...string) []string {
+	if s.Fields == nil {
+		return nil
+	}
+	want := map[string]bool{"id": true, "version": true}
+	for _, f := range s.Fields {
+		want[f] = true
+	}
+	// Whether a bio may be shown depends on its moderation status.
+	if want["bio"] {
+		want["moderation_status"] = true
+	}
+	for _, col := range extra {
+		want[col] = true
+	}
+	var cols []string
+	for _, fc := range userFieldColumns {
+		if want[fc.Field] {
+			cols = append(cols, "users."+fc.Column)
+		}
+	}
+	return cols
+}
+
+// selectColumns restricts tx to the shape's columns; a full shape selects
+// everything.
+func (s userShape) selectColumns(tx *gorm.DB, extra ...string) *gorm.DB {
+	if cols := s.columns(extra...); cols != nil {
+		return tx.Select(cols)
+	}
+	return tx
+}
+
+// render drops the user fields that were not asked for from v, a user DTO or a
+// list item. Other members (etag, search, expanded) are kept.
+func (s userShape) render(v interface{}) interface{} {
+	if s.Fields == nil {
+		return v
+	}
+	raw, _ := json.Marshal(v)
+	var out map[string]interface{}
+	_ = json.Unmarshal(raw, &out)
+	for _, fc := range userFieldColumns {
+		if !s.has(fc.Field) {
+			delete(out, fc.Field)
+			delete(out, fc.Field+"_jalali")
+		}
+	}
+	return out
+}
+
+// expand runs the requested expansions for ids and groups the results per user.
+func (s userShape) expand(db *gorm.DB, ids []uint) (map[uint]map[string]interface{}, error) {
+	if len(s.Expand) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+	out := make(map[uint]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		out[id] = map[string]interface{}{}
+	}
+	for _, name := range s.Expand {
+		values, err := userExpansions[name](db, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id, v := range values {
+			if m, ok := out[id]; ok {
+				m[name] = v
+			}
+		}
+	}
+	return out, nil
+}
+
+// expandCanonical returns the canonical username and email the uniqueness
+// checks compare.
+func expandCanonical(db *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+	var users []models.User
+	if err := db.Select("id", "username_canonical", "email_canonical").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]interface{}, len(users))
+	for _, u := range users {
+		out[u.ID] = gin.H{"username": u.UsernameCanonical, "email": u.EmailCanonical}
+	}
+	return out, nil
+}
+
+// expandCounts returns how many other users share the user's nationality and
+// gender (0 when the user has none set).
+func expandCounts(db *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+	var rows []struct {
+		ID              uint
+		SameNationality int64
+		SameGender      int64
+	}
+	err := db.Raw(`SELECT u.id,
+			(SELECT COUNT(*) FROM users o WHERE o.deleted_at IS NULL AND u.nationality <> '' AND o.nationality = u.nationality AND o.id <> u.id) AS same_nationality,
+			(SELECT COUNT(*) FROM users o WHERE o.deleted_at IS NULL AND u.gender <> '' AND o.gender = u.gender AND o.id <> u.id) AS same_gender
+		FROM users u WHERE u.id IN ?`, ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint]interface{}, len(rows))
+	for _, r := range rows {
+		out[r.ID] = gin.H{"same_nationality": r.SameNationality, "same_gender": r.SameGender}
+	}
+	return out, nil
+}
+
+// expansionNames lists the registered expansions for error details.
+func expansionNames() string {
+	names := make([]string, 0, len(userExpansions))
+	for name := range userExpansions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, item := range list {
+		if item == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report binding tag failures under the JSON field name clients actually send.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// respondValidationError answers a 400 problem listing one {field, code, message}
+// per rejected field, the messages in the request language.
+func respondValidationError(c *gin.Context, errs validation.Errors) {
+	p := newProblem(c, http.StatusBadRequest, "validation_failed")
+	p.Fields = errs.Localized(i18n.Negotiate(c.GetHeader("Accept-Language")))
+	p.send(c)
+}
+
+// bindingErrors splits the result of ShouldBind: binding tag failures become field
+// errors so they can be reported together with the domain rules, while malformed
+// JSON and type mismatches come back as err.
+func bindingErrors(bindErr error) (validation.Errors, error) {
+	if bindErr == nil {
+		return nil, nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(bindErr, &verrs) {
+		return nil, bindErr
+	}
+
+	errs := make(validation.Errors, 0, len(verrs))
+	for _, fe := range verrs {
+		code := validation.CodeInvalidFormat
+		if fe.Tag() == "required" {
+			code = validation.CodeRequired
+		}
+		errs = append(errs, validation.NewFieldError(fe.Field(), code, nil))
+	}
+	return errs, nil
+}
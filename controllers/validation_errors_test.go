@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestBindingErrors(t *testing.T) {
+	type input struct {
+		Username string `json:"username" binding:"required"`
+		Email    string `json:"email" binding:"omitempty,email"`
+	}
+	cases := []struct {
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{`{"username":"alice","email":"alice@example.com"}`, "[]", false},
+		// Tag failures are reported under the JSON field name.
+		{`{}`, "[username:required]", false},
+		{`{"email":"nope"}`, "[username:required email:invalid_format]", false},
+		// Malformed JSON and type mismatches are not field errors.
+		{`{"username":`, "[]", true},
+		{`{"username":7}`, "[]", true},
+	}
+	for _, tc := range cases {
+		var in input
+		errs, err := bindingErrors(binding.JSON.BindBody([]byte(tc.body), &in))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: bindingErrors() error = %v, want error = %v", tc.body, err, tc.wantErr)
+		}
+		got := make([]string, len(errs))
+		for i, fe := range errs {
+			got[i] = fe.Field + ":" + fe.Code
+		}
+		if fmt.Sprint(got) != tc.want {
+			t.Errorf("%s: bindingErrors() = %v, want %s", tc.body, got, tc.want)
+		}
+	}
+	if errs, err := bindingErrors(nil); errs != nil || err != nil {
+		t.Errorf("bindingErrors(nil) = %v, %v", errs, err)
+	}
+}
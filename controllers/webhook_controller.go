@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	v1 "github.com/amirkhgraphic/go-arcaptcha-service/dto/v1"
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateWebhook subscribes an endpoint to user lifecycle events. The response
+// is the only one that includes the signing secret.
+// @Summary Create webhook subscription
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param payload body v1.WebhookRequest true "Subscription"
+// @Success 201 {object} v1.WebhookResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks [post]
+func CreateWebhook(c *gin.Context) {
+	var req v1.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	if errs := validateWebhook(req, true); len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+
+	sub := models.WebhookSubscription{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: strings.Join(req.Events, ","),
+		Active: req.Active == nil || *req.Active,
+	}
+	if sub.Secret == "" {
+		sub.Secret = services.NewWebhookSecret()
+	}
+	if err := initializers.DB.Create(&sub).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+
+	out := v1.NewWebhook(sub)
+	out.Secret = sub.Secret
+	c.JSON(http.StatusCreated, v1.WebhookResponse{Data: out})
+}
+
+// ListWebhooks lists every subscription.
+// @Summary List webhook subscriptions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} v1.WebhookListResponse
+// @Failure 401 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks [get]
+func ListWebhooks(c *gin.Context) {
+	var subs []models.WebhookSubscription
+	if err := initializers.DB.Order("id").Find(&subs).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+	items := make([]v1.Webhook, len(subs))
+	for i, sub := range subs {
+		items[i] = v1.NewWebhook(sub)
+	}
+	c.JSON(http.StatusOK, v1.WebhookListResponse{Data: items})
+}
+
+// GetWebhook returns one subscription.
+// @Summary Get webhook subscription
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} v1.WebhookResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [get]
+func GetWebhook(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, v1.WebhookResponse{Data: v1.NewWebhook(sub)})
+}
+
+// UpdateWebhook changes the members present in the body: url, events, active
+// or secret (rotating it).
+// @Summary Update webhook subscription
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param payload body v1.WebhookRequest true "Members to change"
+// @Success 200 {object} v1.WebhookResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [patch]
+func UpdateWebhook(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	var req v1.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_payload", err.Error())
+		return
+	}
+	if errs := validateWebhook(req, false); len(errs) > 0 {
+		respondValidationError(c, errs)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.URL != "" {
+		updates["url"] = req.URL
+	}
+	if req.Events != nil {
+		updates["events"] = strings.Join(req.Events, ",")
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if req.Secret != "" {
+		updates["secret"] = req.Secret
+	}
+	if len(updates) > 0 {
+		if err := initializers.DB.Model(&sub).Updates(updates).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "webhook_failed")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, v1.WebhookResponse{Data: v1.NewWebhook(sub)})
+}
+
+// DeleteWebhook removes a subscription together with its deliveries.
+// @Summary Delete webhook subscription
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id} [delete]
+func DeleteWebhook(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", sub.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&sub).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries lists the deliveries of a subscription, newest first.
+// @Summary List webhook deliveries
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param status query string false "pending, delivered, dead or dropped"
+// @Param page query int false "page"
+// @Param page_size query int false "page size (max 100)"
+// @Success 200 {object} v1.WebhookDeliveryListResponse
+// @Failure 400 {object} controllers.ErrorResponse
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id}/deliveries [get]
+func ListWebhookDeliveries(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	page := parsePositiveInt(c.DefaultQuery("page", "1"), 1)
+	pageSize := parsePositiveInt(c.DefaultQuery("page_size", "20"), 20)
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	tx := initializers.DB.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", sub.ID)
+	var filters map[string]interface{}
+	if status := c.Query("status"); status != "" {
+		switch status {
+		case models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead, models.DeliveryDropped:
+		default:
+			respondError(c, http.StatusBadRequest, "invalid_filter", "status must be pending, delivered, dead or dropped")
+			return
+		}
+		tx = tx.Where("status = ?", status)
+		filters = map[string]interface{}{"status": status}
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+	var deliveries []models.WebhookDelivery
+	if err := tx.Preload("Event").Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+
+	items := make([]v1.WebhookDelivery, len(deliveries))
+	for i, d := range deliveries {
+		items[i] = v1.NewWebhookDelivery(d)
+	}
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	c.JSON(http.StatusOK, v1.WebhookDeliveryListResponse{Data: items, Meta: v1.Pagination{
+		Mode:       paginationOffset,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: &total,
+		TotalPages: &totalPages,
+		Sort:       "created_at desc",
+		Filters:    filters,
+	}})
+}
+
+// RedeliverWebhook queues a delivery again, typically a dead one, with a fresh
+// attempt budget. The event is sent as originally recorded.
+// @Summary Redeliver a webhook delivery
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 202 {object} v1.WebhookDelivery
+// @Failure 404 {object} controllers.ErrorResponse
+// @Router /api/v1/admin/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func RedeliverWebhook(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	var delivery models.WebhookDelivery
+	err := initializers.DB.Where("subscription_id = ?", sub.ID).First(&delivery, c.Param("delivery_id")).Error
+	if err == nil {
+		err = services.Webhooks.Redeliver(initializers.DB, delivery.ID)
+	}
+	if err == nil {
+		err = initializers.DB.Preload("Event").First(&delivery, delivery.ID).Error
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "delivery_not_found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return
+	}
+	c.JSON(http.StatusAccepted, v1.NewWebhookDelivery(delivery))
+}
+
+func loadWebhook(c *gin.Context) (models.WebhookSubscription, bool) {
+	var sub models.WebhookSubscription
+	if err := initializers.DB.First(&sub, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, "webhook_not_found")
+			return sub, false
+		}
+		respondError(c, http.StatusInternalServerError, "webhook_failed")
+		return sub, false
+	}
+	return sub, true
+}
+
+// validateWebhook checks a subscription body; on create url and events are
+// required.
+func validateWebhook(req v1.WebhookRequest, create bool) validation.Errors {
+	var errs validation.Errors
+	if req.URL != "" || create {
+		u, err := url.Parse(req.URL)
+		switch {
+		case req.URL == "":
+			errs = append(errs, validation.NewFieldError("url", validation.CodeRequired, nil))
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			errs = append(errs, validation.NewFieldError("url", validation.CodeInvalidFormat, nil))
+		}
+	}
+	if req.Events != nil || create {
+		allowed := append([]string{"*"}, services.EventTypes...)
+		if len(req.Events) == 0 {
+			errs = append(errs, validation.NewFieldError("events", validation.CodeRequired, nil))
+		}
+		for _, e := range req.Events {
+			if !contains(allowed, e) {
+				errs = append(errs, validation.NewFieldError("events", validation.CodeNotAllowed, i18n.Params{"allowed": strings.Join(allowed, ", ")}))
+				break
+			}
+		}
+	}
+	if req.Secret != "" && len(req.Secret) < 16 {
+		errs = append(errs, validation.NewFieldError("secret", validation.CodeTooShort, i18n.Params{"min": 16}))
+	}
+	return errs
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// APIKeyRequest is the body of POST /admin/api-keys.
+type APIKeyRequest struct {
+	Name string `json:"name" example:"crm-sync"`
+	// Role is reader, editor or admin.
+	Role string `json:"role" example:"reader"`
+	// UserID links the key to the user an editor key may change.
+	UserID    *uint      `json:"user_id,omitempty" example:"3"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKey describes an API key. Key is only returned when the key is created.
+type APIKey struct {
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"crm-sync"`
+	Prefix     string     `json:"prefix" example:"ak_3f9a12c4"`
+	Role       string     `json:"role" example:"reader"`
+	UserID     *uint      `json:"user_id,omitempty" example:"3"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyResponse wraps a single API key.
+type APIKeyResponse struct {
+	Data APIKey `json:"data"`
+}
+
+// APIKeyListResponse lists API keys.
+type APIKeyListResponse struct {
+	Data []APIKey `json:"data"`
+}
+
+// NewAPIKey maps a stored key to its v1 representation, without the key.
+func NewAPIKey(k models.APIKey) APIKey {
+	return APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Role:       k.Role,
+		UserID:     k.UserID,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
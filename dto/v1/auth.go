@@ -0,0 +1,67 @@
+package v1
+
+import "time"
+
+// LoginRequest is the body of POST /auth/login.
+type LoginRequest struct {
+	// Login is the username or the email.
+	Login    string `json:"login" binding:"required" example:"alice"`
+	Password string `json:"password" binding:"required"`
+	// ChallengeID is only needed after repeated failures (428 captcha_required).
+	ChallengeID string `json:"challenge_id,omitempty"`
+	// Device names the device in the session list, e.g. "Pixel 8".
+	Device string `json:"device,omitempty" example:"Pixel 8"`
+}
+
+// RefreshRequest is the body of POST /auth/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Token is an access token for the logged in user, with the refresh token
+// that gets the next one. Each refresh token can be used once.
+type Token struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type" example:"Bearer"`
+	ExpiresIn        int       `json:"expires_in" example:"900"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token" example:"rt_5c1d..."`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionID        uint      `json:"session_id" example:"12"`
+	User             User      `json:"user"`
+}
+
+// TokenResponse wraps a Token.
+type TokenResponse struct {
+	Data Token `json:"data"`
+}
+
+// ChangePasswordRequest is the body of POST /users/:id/password. Admins may
+// leave current_password out when changing someone else's password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetRequest is the body of POST /auth/password-reset.
+type PasswordResetRequest struct {
+	Email       string `json:"email" binding:"required" example:"alice@example.com"`
+	ChallengeID string `json:"challenge_id" binding:"required"`
+}
+
+// VerifyEmailRequest is the body of POST /users/verify-email.
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest is the body of POST /users/verify-email/resend.
+type ResendVerificationRequest struct {
+	Email       string `json:"email" binding:"required" example:"alice@example.com"`
+	ChallengeID string `json:"challenge_id" binding:"required"`
+}
+
+// PasswordResetConfirmRequest is the body of POST /auth/password-reset/confirm.
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password"`
+}
@@ -0,0 +1,26 @@
+package v1
+
+import "time"
+
+// UserChange is one entry of the sync feed: the current state of a changed user,
+// or a tombstone (Deleted, without User) for a deleted one.
+type UserChange struct {
+	ID        uint       `json:"id" example:"4"`
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	User      *User      `json:"user,omitempty"`
+}
+
+// UserChangesResponse is a page of the sync feed.
+type UserChangesResponse struct {
+	Data []UserChange `json:"data"`
+	Meta ChangesMeta  `json:"meta"`
+}
+
+// ChangesMeta carries the token to pass as since for the next call.
+type ChangesMeta struct {
+	NextToken string `json:"next_token" example:"eyJzZXEiOjQyfQ"`
+	// HasMore is set when more changes are waiting; call again right away.
+	HasMore  bool `json:"has_more"`
+	PageSize int  `json:"page_size" example:"100"`
+}
@@ -0,0 +1,44 @@
+package v1
+
+import (
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// BioReview is a user's bio in the moderation queue.
+type BioReview struct {
+	UserID           uint   `json:"user_id" example:"3"`
+	Username         string `json:"username" example:"alice"`
+	Bio              string `json:"bio"`
+	ModerationStatus string `json:"moderation_status" example:"pending"`
+	// Flags are the checks the bio failed: wordlist, link, phone or
+	// repeated_chars.
+	Flags     []string  `json:"flags" example:"link,phone"`
+	Version   uint      `json:"version" example:"4"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BioReviewListResponse is a page of the moderation queue, oldest first.
+type BioReviewListResponse struct {
+	Data []BioReview `json:"data"`
+	Meta Pagination  `json:"meta"`
+}
+
+// NewBioReview maps a user to its entry in the moderation queue.
+func NewBioReview(u models.User) BioReview {
+	flags := []string{}
+	if u.ModerationFlags != "" {
+		flags = strings.Split(u.ModerationFlags, ",")
+	}
+	return BioReview{
+		UserID:           u.ID,
+		Username:         u.Username,
+		Bio:              u.Bio,
+		ModerationStatus: u.ModerationStatus,
+		Flags:            flags,
+		Version:          u.Version,
+		UpdatedAt:        u.UpdatedAt,
+	}
+}
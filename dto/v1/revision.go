@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/jalali"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+)
+
+// UserRevision is one entry of a user's change history.
+type UserRevision struct {
+	Version   uint   `json:"version" example:"3"`
+	Action    string `json:"action" example:"update"`
+	Actor     string `json:"actor" example:"ip:203.0.113.7"`
+	RequestID string `json:"request_id,omitempty"`
+	// Changes maps each changed field to its value before and after.
+	Changes    map[string]services.FieldChange `json:"changes"`
+	RevertedTo *uint                           `json:"reverted_to,omitempty"`
+	At         time.Time                       `json:"at"`
+	// Only with calendar=jalali (or Accept-Calendar: jalali).
+	AtJalali string `json:"at_jalali,omitempty" example:"1403-01-15T10:20:30+03:30"`
+}
+
+// UserHistoryResponse is a page of a user's history, newest first.
+type UserHistoryResponse struct {
+	Data []UserRevision `json:"data"`
+	Meta Pagination     `json:"meta"`
+}
+
+// NewUserRevision maps a revision to its v1 representation.
+func NewUserRevision(rev models.UserRevision, jalaliDates bool) UserRevision {
+	out := UserRevision{
+		Version:    rev.Version,
+		Action:     rev.Action,
+		Actor:      rev.Actor,
+		RequestID:  rev.RequestID,
+		Changes:    services.RevisionChanges(rev),
+		RevertedTo: rev.RevertedTo,
+		At:         rev.CreatedAt,
+	}
+	if jalaliDates {
+		out.AtJalali = jalali.Format(rev.CreatedAt, jalali.Location())
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// Session is one logged in device of a user.
+type Session struct {
+	ID         uint      `json:"id" example:"12"`
+	Device     string    `json:"device,omitempty" example:"Pixel 8"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// SessionListResponse lists sessions.
+type SessionListResponse struct {
+	Data []Session `json:"data"`
+}
+
+// NewSession maps a stored session to its v1 representation.
+func NewSession(s models.UserSession, current bool) Session {
+	return Session{
+		ID:         s.ID,
+		Device:     s.Device,
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    current,
+	}
+}
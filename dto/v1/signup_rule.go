@@ -0,0 +1,102 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// SignupRuleRequest is the body of POST /admin/signup-rules.
+type SignupRuleRequest struct {
+	// Kind is reserved_username, username_pattern, email_pattern,
+	// blocked_domain or domain_cap.
+	Kind string `json:"kind" example:"reserved_username"`
+	// Value is a username, a regular expression, a domain, or "*" for a
+	// domain_cap that applies to every domain without its own.
+	Value string `json:"value" example:"ceo"`
+	// MaxSignups is the number of sign-ups a domain_cap allows per window.
+	MaxSignups int    `json:"max_signups,omitempty" example:"20"`
+	Note       string `json:"note,omitempty" example:"impersonation attempts"`
+}
+
+// SignupRule is one signup abuse rule.
+type SignupRule struct {
+	ID         uint      `json:"id" example:"24"`
+	Kind       string    `json:"kind" example:"reserved_username"`
+	Value      string    `json:"value" example:"ceo"`
+	MaxSignups int       `json:"max_signups,omitempty" example:"20"`
+	Note       string    `json:"note,omitempty" example:"impersonation attempts"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SignupRuleResponse wraps a single rule.
+type SignupRuleResponse struct {
+	Data SignupRule `json:"data"`
+}
+
+// SignupRuleListResponse lists rules.
+type SignupRuleListResponse struct {
+	Data []SignupRule `json:"data"`
+}
+
+// NewSignupRule maps a stored rule to its v1 representation.
+func NewSignupRule(r models.SignupRule) SignupRule {
+	return SignupRule{
+		ID:         r.ID,
+		Kind:       r.Kind,
+		Value:      r.Value,
+		MaxSignups: r.MaxSignups,
+		Note:       r.Note,
+		CreatedAt:  r.CreatedAt,
+	}
+}
+
+// DisposableDomains describes the disposable email domain list in use.
+type DisposableDomains struct {
+	File       string     `json:"file" example:"data/disposable_domains.txt"`
+	Domains    int        `json:"domains" example:"3120"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	LoadedAt   time.Time  `json:"loaded_at"`
+}
+
+// DisposableDomainsResponse wraps the list description.
+type DisposableDomainsResponse struct {
+	Data DisposableDomains `json:"data"`
+}
+
+// SignupRejection is one write refused by a signup rule.
+type SignupRejection struct {
+	ID uint `json:"id" example:"7"`
+	// Rule is the kind of rule, or disposable_domain for the domain list.
+	Rule      string    `json:"rule" example:"reserved_username"`
+	RuleID    *uint     `json:"rule_id,omitempty" example:"1"`
+	Field     string    `json:"field" example:"username"`
+	UserID    *uint     `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty" example:"admin"`
+	Email     string    `json:"email,omitempty" example:"someone@example.com"`
+	ClientIP  string    `json:"client_ip" example:"203.0.113.7"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SignupRejectionListResponse is a page of rejections, newest first.
+type SignupRejectionListResponse struct {
+	Data []SignupRejection `json:"data"`
+	Meta Pagination        `json:"meta"`
+}
+
+// NewSignupRejection maps a stored rejection to its v1 representation.
+func NewSignupRejection(r models.SignupRejection) SignupRejection {
+	return SignupRejection{
+		ID:        r.ID,
+		Rule:      r.Rule,
+		RuleID:    r.RuleID,
+		Field:     r.Field,
+		UserID:    r.UserID,
+		Username:  r.Username,
+		Email:     r.Email,
+		ClientIP:  r.ClientIP,
+		RequestID: r.RequestID,
+		CreatedAt: r.CreatedAt,
+	}
+}
@@ -0,0 +1,144 @@
+// Package v1 is the public JSON contract of /api/v1. Handlers map models to
+// these types instead of serializing gorm models, so schema changes stay
+// internal until a mapping exposes them. A future /api/v2 gets its own package
+// next to this one; v1 types only ever gain optional fields.
+package v1
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/jalali"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// UserFields are the editable fields of a user. The validate tags only document
+// the rules for swagger; validation.ValidateUser enforces them.
+type UserFields struct {
+	Username    string `json:"username" validate:"required"`
+	Email       string `json:"email" validate:"required"`
+	Bio         string `json:"bio"`
+	Gender      string `json:"gender"`
+	Nationality string `json:"nationality" example:"IR"`
+}
+
+// CreateUserRequest is the body of POST /users.
+type CreateUserRequest struct {
+	UserFields
+	// Password is optional; without one the user can only log in after a
+	// password reset.
+	Password    string `json:"password,omitempty"`
+	ChallengeID string `json:"challenge_id" binding:"required"`
+}
+
+// ReplaceUserRequest is the body of PUT /users/:id; omitted optional fields are
+// cleared.
+type ReplaceUserRequest struct {
+	UserFields
+	ChallengeID string `json:"challenge_id" binding:"required"`
+}
+
+// UpdateUserRequest is the application/json body of PATCH /users/:id; absent
+// fields are left alone.
+type UpdateUserRequest struct {
+	Username    *string `json:"username,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	Gender      *string `json:"gender,omitempty"`
+	Nationality *string `json:"nationality,omitempty"`
+	ChallengeID string  `json:"challenge_id" binding:"required"`
+}
+
+// User is a user as returned by the API.
+type User struct {
+	ID               uint      `json:"id" example:"1"`
+	Username         string    `json:"username" example:"alice"`
+	Email            string    `json:"email" example:"alice@example.com"`
+	EmailVerified    bool      `json:"email_verified"`
+	Bio              string    `json:"bio"`
+	ModerationStatus string    `json:"moderation_status" example:"approved"`
+	Gender           string    `json:"gender" example:"female"`
+	Nationality      string    `json:"nationality" example:"IR"`
+	Version          uint      `json:"version" example:"1"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// Only with calendar=jalali (or Accept-Calendar: jalali).
+	CreatedAtJalali string `json:"created_at_jalali,omitempty" example:"1403-01-15T10:20:30+03:30"`
+	UpdatedAtJalali string `json:"updated_at_jalali,omitempty" example:"1403-01-15T10:20:30+03:30"`
+	// Only for the names requested with expand=.
+	Expanded map[string]interface{} `json:"expanded,omitempty"`
+}
+
+// UserResponse wraps a single user.
+type UserResponse struct {
+	Data User `json:"data"`
+}
+
+// UserListItem is a listed user with its ETag; Search is only present when the
+// request searched.
+type UserListItem struct {
+	User
+	ETag   string        `json:"etag" example:"\"1.3\""`
+	Search *SearchResult `json:"search,omitempty"`
+}
+
+// SearchResult is how a listed user matched the search.
+type SearchResult struct {
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet" example:"<mark>ali</mark>ce@example.com"`
+}
+
+// UserListResponse is a page of users.
+type UserListResponse struct {
+	Data []UserListItem `json:"data"`
+	Meta Pagination     `json:"meta"`
+}
+
+// Pagination describes the page and the query that produced it.
+type Pagination struct {
+	Mode       string                 `json:"mode" example:"offset"`
+	Page       int                    `json:"page,omitempty"`
+	PageSize   int                    `json:"page_size"`
+	TotalItems *int64                 `json:"total_items,omitempty"`
+	TotalPages *int                   `json:"total_pages,omitempty"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+	PrevCursor string                 `json:"prev_cursor,omitempty"`
+	Sort       string                 `json:"sort"`
+	Search     string                 `json:"search,omitempty"`
+	Filters    map[string]interface{} `json:"filters,omitempty"`
+	Fields     []string               `json:"fields,omitempty"`
+	Expand     []string               `json:"expand,omitempty"`
+}
+
+// NewUser maps a model to its v1 representation, adding the Jalali timestamps
+// when jalaliDates is set.
+func NewUser(u models.User, jalaliDates bool) User {
+	out := User{
+		ID:               u.ID,
+		Username:         u.Username,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		Bio:              u.Bio,
+		ModerationStatus: u.ModerationStatus,
+		Gender:           u.Gender,
+		Nationality:      u.Nationality,
+		Version:          u.Version,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+	}
+	if jalaliDates {
+		out.CreatedAtJalali = jalali.Format(u.CreatedAt, jalali.Location())
+		out.UpdatedAtJalali = jalali.Format(u.UpdatedAt, jalali.Location())
+	}
+	return out
+}
+
+// FieldsOf returns the editable fields of u.
+func FieldsOf(u models.User) UserFields {
+	return UserFields{
+		Username:    u.Username,
+		Email:       u.Email,
+		Bio:         u.Bio,
+		Gender:      u.Gender,
+		Nationality: u.Nationality,
+	}
+}
@@ -0,0 +1,96 @@
+package v1
+
+import (
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// WebhookRequest is the body of POST /admin/webhooks. On PATCH every member is
+// optional.
+type WebhookRequest struct {
+	URL string `json:"url" example:"https://crm.example.com/hooks/users"`
+	// Events to receive: user.created, user.updated, user.deleted,
+	// user.restored, or "*" for all of them.
+	Events []string `json:"events" example:"user.created,user.updated"`
+	Active *bool    `json:"active,omitempty"`
+	// Secret signs deliveries; one is generated when left empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Webhook is a webhook subscription. Secret is only returned when it is set.
+type Webhook struct {
+	ID        uint      `json:"id" example:"1"`
+	URL       string    `json:"url" example:"https://crm.example.com/hooks/users"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookResponse wraps a single subscription.
+type WebhookResponse struct {
+	Data Webhook `json:"data"`
+}
+
+// WebhookListResponse lists subscriptions.
+type WebhookListResponse struct {
+	Data []Webhook `json:"data"`
+}
+
+// WebhookDelivery is one event sent to one subscription.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" example:"12"`
+	WebhookID      uint       `json:"webhook_id" example:"1"`
+	EventID        uint       `json:"event_id" example:"40"`
+	EventType      string     `json:"event_type" example:"user.updated"`
+	Status         string     `json:"status" example:"dead"`
+	Attempts       int        `json:"attempts" example:"8"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty" example:"502"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// WebhookDeliveryListResponse is a page of deliveries, newest first.
+type WebhookDeliveryListResponse struct {
+	Data []WebhookDelivery `json:"data"`
+	Meta Pagination        `json:"meta"`
+}
+
+// NewWebhook maps a subscription to its v1 representation, without the secret.
+func NewWebhook(s models.WebhookSubscription) Webhook {
+	return Webhook{
+		ID:        s.ID,
+		URL:       s.URL,
+		Events:    strings.Split(s.Events, ","),
+		Active:    s.Active,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// NewWebhookDelivery maps a delivery (with its event loaded) to its v1
+// representation.
+func NewWebhookDelivery(d models.WebhookDelivery) WebhookDelivery {
+	out := WebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.Event.Type,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Status == models.DeliveryPending {
+		next := d.NextAttemptAt
+		out.NextAttemptAt = &next
+	}
+	return out
+}
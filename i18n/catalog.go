@@ -0,0 +1,454 @@
+package i18n
+
+// catalog maps a message key to its text per language. Error codes returned by
+// the API are keys here, so clients can rely on the code and show the text.
+// Validation messages live under validation.<code>, optionally overridden for
+// one field by validation.<field>.<code>; field.<name> is the label of a field.
+var catalog = map[string]map[string]string{
+	// Request and resource errors.
+	"route_not_found": {
+		English: "route not found",
+		Persian: "مسیر پیدا نشد",
+	},
+	"method_not_allowed": {
+		English: "method not allowed",
+		Persian: "این متد برای این مسیر مجاز نیست",
+	},
+	"internal_error": {
+		English: "internal server error",
+		Persian: "خطای داخلی سرور",
+	},
+	"invalid_payload": {
+		English: "invalid payload",
+		Persian: "بدنهٔ درخواست نامعتبر است",
+	},
+	"validation_failed": {
+		English: "validation failed",
+		Persian: "اعتبارسنجی ناموفق بود",
+	},
+	"user_not_found": {
+		English: "user not found",
+		Persian: "کاربر پیدا نشد",
+	},
+	"user_exists": {
+		English: "username or email already exists",
+		Persian: "این نام کاربری یا ایمیل قبلاً ثبت شده است",
+	},
+	"user_create_failed": {
+		English: "could not create user",
+		Persian: "ایجاد کاربر ممکن نشد",
+	},
+	"user_update_failed": {
+		English: "could not update user",
+		Persian: "به‌روزرسانی کاربر ممکن نشد",
+	},
+	"user_fetch_failed": {
+		English: "could not fetch user",
+		Persian: "دریافت کاربر ممکن نشد",
+	},
+	"users_fetch_failed": {
+		English: "could not fetch users",
+		Persian: "دریافت فهرست کاربران ممکن نشد",
+	},
+	"users_count_failed": {
+		English: "could not count users",
+		Persian: "شمارش کاربران ممکن نشد",
+	},
+	"search_matches_failed": {
+		English: "could not fetch search matches",
+		Persian: "دریافت نتایج جست‌وجو ممکن نشد",
+	},
+	"user_delete_failed": {
+		English: "could not delete user",
+		Persian: "حذف کاربر ممکن نشد",
+	},
+	"user_restore_failed": {
+		English: "could not restore user",
+		Persian: "بازگردانی کاربر ممکن نشد",
+	},
+	"user_not_deleted": {
+		English: "user is not deleted",
+		Persian: "کاربر حذف نشده است",
+	},
+	"history_fetch_failed": {
+		English: "could not fetch user history",
+		Persian: "دریافت تاریخچه کاربر ممکن نشد",
+	},
+	"revision_not_found": {
+		English: "revision not found",
+		Persian: "نسخه مورد نظر پیدا نشد",
+	},
+	"invalid_version": {
+		English: "invalid version",
+		Persian: "نسخه نامعتبر است",
+	},
+	"group_failed": {
+		English: "could not group users",
+		Persian: "گروه‌بندی کاربران ممکن نشد",
+	},
+	"relevance_offset_only": {
+		English: "relevance sort is only available in offset mode",
+		Persian: "مرتب‌سازی بر اساس ارتباط فقط در صفحه‌بندی offset در دسترس است",
+	},
+	"invalid_filter": {
+		English: "invalid filter",
+		Persian: "فیلتر نامعتبر است",
+	},
+	"invalid_format": {
+		English: "unsupported export format",
+		Persian: "قالب خروجی پشتیبانی نمی‌شود",
+	},
+	"invalid_fields": {
+		English: "invalid fields parameter",
+		Persian: "پارامتر fields نامعتبر است",
+	},
+	"invalid_expand": {
+		English: "invalid expand parameter",
+		Persian: "پارامتر expand نامعتبر است",
+	},
+	"invalid_cursor": {
+		English: "invalid cursor",
+		Persian: "cursor نامعتبر است",
+	},
+	"cursor_sort_mismatch": {
+		English: "cursor was issued for a different sort",
+		Persian: "این cursor برای مرتب‌سازی دیگری صادر شده است",
+	},
+	"cursor_conflict": {
+		English: "use either after or before, not both",
+		Persian: "فقط یکی از after یا before را بفرستید",
+	},
+	"unsupported_calendar": {
+		English: "unsupported calendar, use gregorian or jalali",
+		Persian: "تقویم پشتیبانی نمی‌شود؛ از gregorian یا jalali استفاده کنید",
+	},
+	"invalid_dry_run": {
+		English: "dry_run must be true or false",
+		Persian: "مقدار dry_run باید true یا false باشد",
+	},
+	"invalid_idempotency_key": {
+		English: "invalid Idempotency-Key header",
+		Persian: "سرآیند Idempotency-Key نامعتبر است",
+	},
+	"idempotency_key_reused": {
+		English: "Idempotency-Key was already used for a different request",
+		Persian: "این Idempotency-Key قبلاً برای درخواست دیگری استفاده شده است",
+	},
+	"idempotency_in_progress": {
+		English: "a request with this Idempotency-Key is still being processed",
+		Persian: "درخواستی با این Idempotency-Key هنوز در حال پردازش است",
+	},
+	"unauthorized": {
+		English: "missing or invalid credentials",
+		Persian: "اطلاعات احراز هویت ارسال نشده یا نامعتبر است",
+	},
+	"forbidden": {
+		English: "you are not allowed to do this",
+		Persian: "اجازهٔ انجام این کار را ندارید",
+	},
+	"invalid_credentials": {
+		English: "invalid login or password",
+		Persian: "نام کاربری یا گذرواژه نادرست است",
+	},
+	"captcha_required": {
+		English: "too many failed logins, solve a captcha and send its challenge_id",
+		Persian: "تلاش‌های ناموفق ورود زیاد است؛ کپچا را حل کنید و challenge_id آن را بفرستید",
+	},
+	"login_unavailable": {
+		English: "login is not available, JWT_SECRET is not configured",
+		Persian: "ورود در دسترس نیست؛ JWT_SECRET تنظیم نشده است",
+	},
+	"login_failed": {
+		English: "could not log in, try again",
+		Persian: "ورود ممکن نشد؛ دوباره تلاش کنید",
+	},
+	"password_change_failed": {
+		English: "could not change password",
+		Persian: "تغییر گذرواژه ممکن نشد",
+	},
+	"password_reset_failed": {
+		English: "could not reset password",
+		Persian: "بازنشانی گذرواژه ممکن نشد",
+	},
+	"invalid_reset_token": {
+		English: "password reset token is invalid, used or expired",
+		Persian: "توکن بازنشانی گذرواژه نامعتبر، استفاده‌شده یا منقضی است",
+	},
+	"invalid_refresh_token": {
+		English: "refresh token is invalid, expired or its session has ended",
+		Persian: "توکن نوسازی نامعتبر یا منقضی است یا نشست آن پایان یافته است",
+	},
+	"refresh_token_reused": {
+		English: "refresh token was already used, the session has been revoked for safety",
+		Persian: "توکن نوسازی قبلاً استفاده شده است؛ برای امنیت، نشست لغو شد",
+	},
+	"session_required": {
+		English: "this credential does not belong to a login session",
+		Persian: "این اعتبارنامه متعلق به یک نشست ورود نیست",
+	},
+	"session_not_found": {
+		English: "session not found",
+		Persian: "نشست پیدا نشد",
+	},
+	"session_failed": {
+		English: "could not process session request",
+		Persian: "پردازش درخواست نشست ممکن نشد",
+	},
+	"api_key_not_found": {
+		English: "API key not found",
+		Persian: "کلید API پیدا نشد",
+	},
+	"api_key_failed": {
+		English: "could not process API key request",
+		Persian: "پردازش درخواست کلید API ممکن نشد",
+	},
+	"webhook_not_found": {
+		English: "webhook not found",
+		Persian: "وب‌هوک پیدا نشد",
+	},
+	"delivery_not_found": {
+		English: "webhook delivery not found",
+		Persian: "ارسال وب‌هوک پیدا نشد",
+	},
+	"webhook_failed": {
+		English: "could not process webhook request",
+		Persian: "پردازش درخواست وب‌هوک ممکن نشد",
+	},
+	"signup_rule_not_found": {
+		English: "signup rule not found",
+		Persian: "قاعدهٔ ثبت‌نام پیدا نشد",
+	},
+	"signup_rule_exists": {
+		English: "a signup rule of this kind and value already exists",
+		Persian: "قاعدهٔ ثبت‌نامی با همین نوع و مقدار از قبل وجود دارد",
+	},
+	"signup_rules_failed": {
+		English: "could not process signup rules",
+		Persian: "پردازش قواعد ثبت‌نام ممکن نشد",
+	},
+	"moderation_failed": {
+		English: "could not process moderation request",
+		Persian: "پردازش درخواست بازبینی ممکن نشد",
+	},
+	"invalid_verification_token": {
+		English: "email verification token is invalid or expired",
+		Persian: "توکن تأیید ایمیل نامعتبر یا منقضی است",
+	},
+	"email_verification_failed": {
+		English: "could not verify email",
+		Persian: "تأیید ایمیل ممکن نشد",
+	},
+	"too_many_requests": {
+		English: "too many requests, retry later",
+		Persian: "درخواست‌ها بیش از حد مجاز است؛ بعداً دوباره تلاش کنید",
+	},
+	"too_many_subscribers": {
+		English: "too many event stream subscribers, retry later",
+		Persian: "تعداد مشترکان جریان رویداد زیاد است؛ بعداً دوباره تلاش کنید",
+	},
+	"unsupported_media_type": {
+		English: "unsupported content type",
+		Persian: "نوع محتوا پشتیبانی نمی‌شود",
+	},
+	"patch_test_failed": {
+		English: "patch test failed",
+		Persian: "شرط test در patch برقرار نبود",
+	},
+	"nothing_to_update": {
+		English: "nothing to update",
+		Persian: "چیزی برای به‌روزرسانی وجود ندارد",
+	},
+	"precondition_failed": {
+		English: "user has been modified since the given ETag",
+		Persian: "کاربر پس از این ETag تغییر کرده است",
+	},
+	"concurrent_update": {
+		English: "user was modified concurrently, fetch it and retry",
+		Persian: "کاربر هم‌زمان تغییر کرد؛ آن را دوباره دریافت و تلاش کنید",
+	},
+
+	// Captcha.
+	"challenge_required": {
+		English: "challenge_id is required",
+		Persian: "challenge_id الزامی است",
+	},
+	"challenge_mismatch": {
+		English: "captcha did not match the issued challenge",
+		Persian: "کپچا با چالش صادرشده مطابقت ندارد",
+	},
+	"captcha_unavailable": {
+		English: "captcha provider unavailable, try again",
+		Persian: "سرویس کپچا در دسترس نیست؛ دوباره تلاش کنید",
+	},
+	"captcha_failed": {
+		English: "captcha validation failed",
+		Persian: "اعتبارسنجی کپچا ناموفق بود",
+	},
+	"challenge_note": {
+		English: "Use this challenge_id in protected requests. Suffix -neterr to simulate network errors.",
+		Persian: "از این challenge_id در درخواست‌های محافظت‌شده استفاده کنید. برای شبیه‌سازی خطای شبکه، پسوند -neterr را اضافه کنید.",
+	},
+
+	// Field labels.
+	"field.username": {
+		English: "username",
+		Persian: "نام کاربری",
+	},
+	"field.email": {
+		English: "email",
+		Persian: "ایمیل",
+	},
+	"field.bio": {
+		English: "bio",
+		Persian: "بیوگرافی",
+	},
+	"field.gender": {
+		English: "gender",
+		Persian: "جنسیت",
+	},
+	"field.nationality": {
+		English: "nationality",
+		Persian: "ملیت",
+	},
+
+	"field.url": {
+		English: "URL",
+		Persian: "نشانی",
+	},
+	"field.events": {
+		English: "events",
+		Persian: "رویدادها",
+	},
+	"field.password": {
+		English: "password",
+		Persian: "گذرواژه",
+	},
+	"field.new_password": {
+		English: "new password",
+		Persian: "گذرواژهٔ جدید",
+	},
+	"field.name": {
+		English: "name",
+		Persian: "نام",
+	},
+	"field.role": {
+		English: "role",
+		Persian: "نقش",
+	},
+	"field.user_id": {
+		English: "user_id",
+		Persian: "شناسهٔ کاربر",
+	},
+	"field.expires_at": {
+		English: "expires_at",
+		Persian: "زمان انقضا",
+	},
+	"field.kind": {
+		English: "kind",
+		Persian: "نوع",
+	},
+	"field.value": {
+		English: "value",
+		Persian: "مقدار",
+	},
+	"field.max_signups": {
+		English: "max_signups",
+		Persian: "حداکثر ثبت‌نام",
+	},
+	"field.note": {
+		English: "note",
+		Persian: "یادداشت",
+	},
+
+	// Validation.
+	"validation.required": {
+		English: "{field} is required",
+		Persian: "{field} الزامی است",
+	},
+	"validation.too_short": {
+		English: "{field} must be at least {min} characters",
+		Persian: "{field} باید دست‌کم {min} نویسه باشد",
+	},
+	"validation.too_long": {
+		English: "{field} must be at most {max} characters",
+		Persian: "{field} باید حداکثر {max} نویسه باشد",
+	},
+	"validation.invalid_format": {
+		English: "{field} is invalid",
+		Persian: "{field} نامعتبر است",
+	},
+	"validation.not_allowed": {
+		English: "{field} must be one of: {allowed}",
+		Persian: "{field} باید یکی از این مقادیر باشد: {allowed}",
+	},
+	"validation.invalid_country": {
+		English: "{field} must be an ISO 3166-1 alpha-2 country code such as IR or DE",
+		Persian: "{field} باید کد دوحرفی کشور طبق ISO 3166-1 باشد، مانند IR یا DE",
+	},
+	"validation.reserved": {
+		English: "{field} is reserved",
+		Persian: "{field} رزرو شده است",
+	},
+	"validation.blocked": {
+		English: "{field} is not allowed",
+		Persian: "{field} مجاز نیست",
+	},
+	"validation.disposable": {
+		English: "{field} may not use a disposable email domain",
+		Persian: "{field} نباید از دامنهٔ ایمیل موقت باشد",
+	},
+	"validation.domain_limit": {
+		English: "too many accounts were created with this {field} domain recently (at most {max}), try again later",
+		Persian: "اخیراً حساب‌های زیادی با دامنهٔ این {field} ساخته شده است (حداکثر {max})؛ بعداً دوباره تلاش کنید",
+	},
+	"validation.username.invalid_format": {
+		English: "username may only contain letters, digits, '_', '.' and '-'",
+		Persian: "نام کاربری فقط می‌تواند شامل حروف، ارقام، «_»، «.» و «-» باشد",
+	},
+	"validation.url.invalid_format": {
+		English: "URL must be an absolute http or https URL",
+		Persian: "نشانی باید یک URL کامل http یا https باشد",
+	},
+	"validation.password.not_allowed": {
+		English: "password may not be the username or email",
+		Persian: "گذرواژه نباید همان نام کاربری یا ایمیل باشد",
+	},
+	"validation.new_password.not_allowed": {
+		English: "new password may not be the username or email",
+		Persian: "گذرواژهٔ جدید نباید همان نام کاربری یا ایمیل باشد",
+	},
+	"validation.user_id.invalid_format": {
+		English: "user_id must be the id of an existing user",
+		Persian: "شناسهٔ کاربر باید متعلق به کاربری موجود باشد",
+	},
+	"validation.expires_at.invalid_format": {
+		English: "expires_at must be in the future",
+		Persian: "زمان انقضا باید در آینده باشد",
+	},
+	"validation.value.invalid_format": {
+		English: "value must be a valid regular expression for patterns and a domain like example.com for domains",
+		Persian: "مقدار باید برای الگوها یک عبارت باقاعدهٔ معتبر و برای دامنه‌ها دامنه‌ای مانند example.com باشد",
+	},
+	"validation.email.invalid_format": {
+		English: "email must be a valid address like name@example.com",
+		Persian: "ایمیل باید نشانی معتبری مانند name@example.com باشد",
+	},
+
+	// Mail.
+	"mail.password_reset.subject": {
+		English: "Reset your password",
+		Persian: "بازنشانی گذرواژه",
+	},
+	"mail.password_reset.body": {
+		English: "Hi {username},\n\nSomeone asked to reset the password of your account. If it was you, use this to choose a new one:\n\n{link}\n\nIt can be used once and expires soon. If you did not ask for it, ignore this mail; your password stays the same.\n",
+		Persian: "سلام {username}،\n\nدرخواستی برای بازنشانی گذرواژهٔ حساب شما ثبت شده است. اگر خودتان درخواست داده‌اید، با این پیوند گذرواژهٔ جدید را انتخاب کنید:\n\n{link}\n\nاین پیوند یک بار قابل استفاده است و به‌زودی منقضی می‌شود. اگر شما درخواست نداده‌اید، این نامه را نادیده بگیرید؛ گذرواژهٔ شما تغییری نمی‌کند.\n",
+	},
+	"mail.verify_email.subject": {
+		English: "Verify your email",
+		Persian: "تأیید ایمیل",
+	},
+	"mail.verify_email.body": {
+		English: "Hi {username},\n\nPlease confirm that this is your email address:\n\n{link}\n\nThe link expires soon. If you did not sign up or change your email, ignore this mail.\n",
+		Persian: "سلام {username}،\n\nلطفاً تأیید کنید که این نشانی ایمیل متعلق به شماست:\n\n{link}\n\nاین پیوند به‌زودی منقضی می‌شود. اگر ثبت‌نام نکرده‌اید یا ایمیل خود را تغییر نداده‌اید، این نامه را نادیده بگیرید.\n",
+	},
+}
@@ -0,0 +1,64 @@
+// Package i18n holds the catalog of user-facing messages, keyed by stable codes,
+// and picks a language from an Accept-Language header.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Supported languages. English is the fallback for anything else and for
+// messages that have no translation.
+const (
+	English = "en"
+	Persian = "fa"
+)
+
+// Default is the language used when a request does not ask for one.
+const Default = English
+
+var matcher = language.NewMatcher([]language.Tag{language.English, language.Persian})
+
+// Params fill the {name} placeholders of a message.
+type Params map[string]interface{}
+
+// Negotiate returns the supported language that best matches an Accept-Language
+// header value.
+func Negotiate(acceptLanguage string) string {
+	if strings.TrimSpace(acceptLanguage) == "" {
+		return Default
+	}
+	_, index := language.MatchStrings(matcher, acceptLanguage)
+	if index == 1 {
+		return Persian
+	}
+	return English
+}
+
+// Has reports whether the catalog defines key.
+func Has(key string) bool {
+	_, ok := catalog[key]
+	return ok
+}
+
+// Translate renders the message for key in lang, falling back to English and
+// then to the key itself, and substitutes params into its {name} placeholders.
+func Translate(lang, key string, params Params) string {
+	msg, ok := catalog[key][lang]
+	if !ok {
+		msg, ok = catalog[key][English]
+	}
+	if !ok {
+		msg = key
+	}
+	if len(params) == 0 {
+		return msg
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
@@ -0,0 +1,84 @@
+// Package identity derives the canonical forms of usernames and emails that the
+// unique indexes are built on, so "Alice" and "alice" are the same account.
+package identity
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/textnorm"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmailRules toggles the optional, provider-specific email canonicalization.
+// GmailDots strips dots from the local part and maps googlemail.com to gmail.com
+// for Gmail addresses; PlusTags drops a "+tag" suffix from any local part. The
+// two are independent.
+type EmailRules struct {
+	GmailDots bool
+	PlusTags  bool
+}
+
+var (
+	emailRulesOnce sync.Once
+	emailRules     EmailRules
+)
+
+// CurrentEmailRules reads EMAIL_CANONICAL_GMAIL_DOTS and EMAIL_CANONICAL_PLUS_TAGS
+// ("1" or "true" enables them) once.
+func CurrentEmailRules() EmailRules {
+	emailRulesOnce.Do(func() {
+		emailRules = EmailRules{
+			GmailDots: envBool("EMAIL_CANONICAL_GMAIL_DOTS"),
+			PlusTags:  envBool("EMAIL_CANONICAL_PLUS_TAGS"),
+		}
+	})
+	return emailRules
+}
+
+// fold applies Unicode NFKC (so full-width and compatibility characters compare
+// equal to their plain forms), folds Arabic/Persian variants, trims and lowercases.
+func fold(s string) string {
+	return strings.ToLower(strings.TrimSpace(textnorm.Compact(norm.NFKC.String(s))))
+}
+
+// Username returns the canonical username.
+func Username(s string) string {
+	return fold(s)
+}
+
+// Email returns the canonical email under the current rules.
+func Email(s string) string {
+	return CanonicalEmail(s, CurrentEmailRules())
+}
+
+// CanonicalEmail returns the canonical email under the given rules.
+func CanonicalEmail(s string, rules EmailRules) string {
+	email := fold(s)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if rules.PlusTags {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if rules.GmailDots && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,60 @@
+package identity
+
+import "testing"
+
+func TestUsername(t *testing.T) {
+	cases := map[string]string{
+		"alice":      "alice",
+		"Alice":      "alice",
+		"  ALICE  ":  "alice",
+		"ＡＬＩＣＥ":      "alice",
+		"ａｌｉｃｅ１２":    "alice12",
+		"علي":        "علی",
+		"علی\u200c۱": "علی1",
+		"ß":          "ß",
+	}
+	for in, want := range cases {
+		if got := Username(in); got != want {
+			t.Errorf("Username(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	none := EmailRules{}
+	dots := EmailRules{GmailDots: true}
+	plus := EmailRules{PlusTags: true}
+	both := EmailRules{GmailDots: true, PlusTags: true}
+
+	cases := []struct {
+		in    string
+		rules EmailRules
+		want  string
+	}{
+		{"Alice@Example.COM", none, "alice@example.com"},
+		{" alice@example.com ", none, "alice@example.com"},
+		{"ａｌｉｃｅ@example.com", none, "alice@example.com"},
+		{"a.l.ice+news@gmail.com", none, "a.l.ice+news@gmail.com"},
+		{"not-an-email", none, "not-an-email"},
+		{"@example.com", none, "@example.com"},
+
+		{"A.Lice@gmail.com", dots, "alice@gmail.com"},
+		{"a.lice@googlemail.com", dots, "alice@gmail.com"},
+		{"a.lice@example.com", dots, "a.lice@example.com"},
+		// Dots alone keep the tag: the rules are independent.
+		{"a.lice+news@gmail.com", dots, "alice+news@gmail.com"},
+
+		{"alice+news@example.com", plus, "alice@example.com"},
+		{"a.lice+news@gmail.com", plus, "a.lice@gmail.com"},
+		{"+news@example.com", plus, "+news@example.com"},
+		{"alice+a+b@example.com", plus, "alice@example.com"},
+
+		{"A.Lice+News@GoogleMail.com", both, "alice@gmail.com"},
+		{"a.lice+news@example.com", both, "a.lice@example.com"},
+	}
+	for _, tc := range cases {
+		if got := CanonicalEmail(tc.in, tc.rules); got != tc.want {
+			t.Errorf("CanonicalEmail(%q, %+v) = %q, want %q", tc.in, tc.rules, got, tc.want)
+		}
+	}
+}
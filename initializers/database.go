@@ -15,7 +15,7 @@ func ConnectToDB() {
 	var err error
 
 	if dbURL := os.Getenv("DB_URL"); dbURL != "" {
-		DB, err = gorm.Open(postgres.Open(dbURL), &gorm.Config{})
+		DB, err = gorm.Open(postgres.Open(dbURL), &gorm.Config{TranslateError: true})
 		if err != nil {
 			panic("failed to connect database: " + err.Error())
 		}
@@ -31,7 +31,7 @@ func ConnectToDB() {
 		_ = os.MkdirAll(dir, 0o755)
 	}
 
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic("failed to connect database: " + err.Error())
 	}
@@ -0,0 +1,234 @@
+// Package jalali converts between the Gregorian and the Jalali (Solar Hijri)
+// calendars. Leap years follow the astronomical break table used by the
+// widely deployed jalaali algorithm, which is valid for Jalali years -61..3177.
+package jalali
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the zone database so Asia/Tehran resolves in minimal images.
+	_ "time/tzdata"
+)
+
+// Date is a calendar date in the Jalali calendar. Months are 1 (Farvardin)
+// through 12 (Esfand).
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+var (
+	ErrInvalidDate = errors.New("invalid jalali date")
+	ErrOutOfRange  = errors.New("jalali year out of supported range")
+)
+
+// breaks are the Jalali years at which the 33-year leap pattern shifts.
+var breaks = []int{
+	-61, 9, 38, 199, 426, 686, 756, 818, 1111, 1181, 1210,
+	1635, 2060, 2097, 2192, 2262, 2324, 2394, 2456, 3178,
+}
+
+// yearInfo is what the break table says about one Jalali year: the Gregorian
+// year it starts in, the day of March on which 1 Farvardin falls, and how many
+// years have passed since the last leap year (0 means this year is leap).
+type yearInfo struct {
+	gy    int
+	march int
+	leap  int
+}
+
+func calendarYear(jy int) (yearInfo, error) {
+	if jy < breaks[0] || jy >= breaks[len(breaks)-1] {
+		return yearInfo{}, ErrOutOfRange
+	}
+
+	gy := jy + 621
+	leapJ := -14
+	jp := breaks[0]
+	jump := 0
+	for _, jm := range breaks[1:] {
+		jump = jm - jp
+		if jy < jm {
+			break
+		}
+		leapJ += jump/33*8 + jump%33/4
+		jp = jm
+	}
+	n := jy - jp
+
+	leapJ += n/33*8 + (n%33+3)/4
+	if jump%33 == 4 && jump-n == 4 {
+		leapJ++
+	}
+	leapG := gy/4 - (gy/100+1)*3/4 - 150
+	march := 20 + leapJ - leapG
+
+	if jump-n < 6 {
+		n = n - jump + (jump+4)/33*33
+	}
+	leap := ((n+1)%33 - 1) % 4
+	if leap == -1 {
+		leap = 4
+	}
+	return yearInfo{gy: gy, march: march, leap: leap}, nil
+}
+
+// IsLeap reports whether Esfand of year jy has 30 days.
+func IsLeap(jy int) bool {
+	info, err := calendarYear(jy)
+	return err == nil && info.leap == 0
+}
+
+// MonthLength returns the number of days in the given month: 31 for the first
+// six months, 30 for the next five and 29 or 30 for Esfand. It returns 0 for an
+// invalid month.
+func MonthLength(jy, jm int) int {
+	switch {
+	case jm >= 1 && jm <= 6:
+		return 31
+	case jm >= 7 && jm <= 11:
+		return 30
+	case jm == 12 && IsLeap(jy):
+		return 30
+	case jm == 12:
+		return 29
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether d names a real day within the supported range.
+func (d Date) Valid() bool {
+	if _, err := calendarYear(d.Year); err != nil {
+		return false
+	}
+	return d.Day >= 1 && d.Day <= MonthLength(d.Year, d.Month)
+}
+
+// String formats d as YYYY-MM-DD.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// dayNumber counts days since 1970-01-01 for a Gregorian date, letting
+// time.Date normalize overflowing days.
+func dayNumber(gy int, gm time.Month, gd int) int {
+	return int(time.Date(gy, gm, gd, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// FromGregorian converts a Gregorian calendar date.
+func FromGregorian(gy int, gm time.Month, gd int) (Date, error) {
+	jy := gy - 621
+	info, err := calendarYear(jy)
+	if err != nil {
+		return Date{}, err
+	}
+
+	k := dayNumber(gy, gm, gd) - dayNumber(info.gy, time.March, info.march)
+	if k >= 0 {
+		if k <= 185 {
+			return Date{Year: jy, Month: 1 + k/31, Day: k%31 + 1}, nil
+		}
+		k -= 186
+	} else {
+		jy--
+		k += 179
+		if info.leap == 1 {
+			k++
+		}
+	}
+	return Date{Year: jy, Month: 7 + k/30, Day: k%30 + 1}, nil
+}
+
+// FromTime converts the calendar day t falls on in its own location.
+func FromTime(t time.Time) Date {
+	gy, gm, gd := t.Date()
+	d, _ := FromGregorian(gy, gm, gd)
+	return d
+}
+
+// Gregorian returns the Gregorian date of d.
+func (d Date) Gregorian() (int, time.Month, int, error) {
+	if !d.Valid() {
+		return 0, 0, 0, ErrInvalidDate
+	}
+	info, _ := calendarYear(d.Year)
+	offset := (d.Month-1)*31 - d.Month/7*(d.Month-7) + d.Day - 1
+	t := time.Date(info.gy, time.March, info.march+offset, 0, 0, 0, 0, time.UTC)
+	return t.Year(), t.Month(), t.Day(), nil
+}
+
+// Time returns midnight at the start of d in loc.
+func (d Date) Time(loc *time.Location) (time.Time, error) {
+	gy, gm, gd, err := d.Gregorian()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(gy, gm, gd, 0, 0, 0, 0, loc), nil
+}
+
+// AddMonths returns the first day of the month n months after d's month.
+func (d Date) AddMonths(n int) Date {
+	m := d.Year*12 + d.Month - 1 + n
+	return Date{Year: m / 12, Month: m%12 + 1, Day: 1}
+}
+
+// Parse reads a YYYY-MM-DD or YYYY/MM/DD Jalali date.
+func Parse(s string) (Date, error) {
+	parts := strings.FieldsFunc(strings.TrimSpace(s), func(r rune) bool {
+		return r == '-' || r == '/'
+	})
+	if len(parts) != 3 {
+		return Date{}, ErrInvalidDate
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Date{}, ErrInvalidDate
+		}
+		nums[i] = n
+	}
+	d := Date{Year: nums[0], Month: nums[1], Day: nums[2]}
+	if !d.Valid() {
+		return Date{}, ErrInvalidDate
+	}
+	return d, nil
+}
+
+// Format renders t in loc as a Jalali timestamp, e.g. 1403-01-15T10:20:30+03:30.
+func Format(t time.Time, loc *time.Location) string {
+	t = t.In(loc)
+	return FromTime(t).String() + t.Format("T15:04:05Z07:00")
+}
+
+var (
+	locationOnce sync.Once
+	location     *time.Location
+)
+
+// Location is the zone Jalali days are counted in, JALALI_TIMEZONE or
+// Asia/Tehran by default.
+func Location() *time.Location {
+	locationOnce.Do(func() {
+		name := strings.TrimSpace(os.Getenv("JALALI_TIMEZONE"))
+		if name == "" {
+			name = "Asia/Tehran"
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			log.Printf("Warning: ignoring invalid JALALI_TIMEZONE=%q: %v", name, err)
+			loc = time.FixedZone("IRST", 3*3600+1800)
+		}
+		location = loc
+	})
+	return location
+}
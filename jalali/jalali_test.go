@@ -0,0 +1,147 @@
+package jalali
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromGregorian(t *testing.T) {
+	cases := []struct {
+		gy   int
+		gm   time.Month
+		gd   int
+		want Date
+	}{
+		{1979, time.February, 11, Date{1357, 11, 22}},
+		{2000, time.January, 1, Date{1378, 10, 11}},
+		// Nowruz and the last day of Esfand around leap and common years.
+		{2021, time.March, 20, Date{1399, 12, 30}},
+		{2021, time.March, 21, Date{1400, 1, 1}},
+		{2022, time.March, 20, Date{1400, 12, 29}},
+		{2022, time.March, 21, Date{1401, 1, 1}},
+		{2023, time.March, 20, Date{1401, 12, 29}},
+		{2023, time.March, 21, Date{1402, 1, 1}},
+		{2024, time.March, 19, Date{1402, 12, 29}},
+		{2024, time.March, 20, Date{1403, 1, 1}},
+		{2025, time.March, 20, Date{1403, 12, 30}},
+		{2025, time.March, 21, Date{1404, 1, 1}},
+		// Month boundaries: 31-day to 30-day months and Mehr.
+		{2023, time.April, 20, Date{1402, 1, 31}},
+		{2023, time.April, 21, Date{1402, 2, 1}},
+		{2023, time.September, 22, Date{1402, 6, 31}},
+		{2023, time.September, 23, Date{1402, 7, 1}},
+		{2024, time.February, 19, Date{1402, 11, 30}},
+		{2024, time.February, 20, Date{1402, 12, 1}},
+		// Gregorian leap day.
+		{2024, time.February, 29, Date{1402, 12, 10}},
+	}
+	for _, tc := range cases {
+		got, err := FromGregorian(tc.gy, tc.gm, tc.gd)
+		if err != nil {
+			t.Fatalf("FromGregorian(%d-%02d-%02d): %v", tc.gy, tc.gm, tc.gd, err)
+		}
+		if got != tc.want {
+			t.Errorf("FromGregorian(%d-%02d-%02d) = %v, want %v", tc.gy, tc.gm, tc.gd, got, tc.want)
+		}
+
+		gy, gm, gd, err := tc.want.Gregorian()
+		if err != nil {
+			t.Fatalf("%v.Gregorian(): %v", tc.want, err)
+		}
+		if gy != tc.gy || gm != tc.gm || gd != tc.gd {
+			t.Errorf("%v.Gregorian() = %d-%02d-%02d, want %d-%02d-%02d", tc.want, gy, gm, gd, tc.gy, tc.gm, tc.gd)
+		}
+	}
+}
+
+func TestIsLeap(t *testing.T) {
+	leap := map[int]bool{
+		1395: true, 1396: false, 1399: true, 1400: false,
+		1402: false, 1403: true, 1404: false, 1407: false, 1408: true,
+	}
+	for year, want := range leap {
+		if got := IsLeap(year); got != want {
+			t.Errorf("IsLeap(%d) = %v, want %v", year, got, want)
+		}
+	}
+}
+
+func TestMonthLength(t *testing.T) {
+	cases := []struct{ year, month, want int }{
+		{1402, 1, 31}, {1402, 6, 31}, {1402, 7, 30}, {1402, 11, 30},
+		{1402, 12, 29}, {1403, 12, 30}, {1402, 0, 0}, {1402, 13, 0},
+	}
+	for _, tc := range cases {
+		if got := MonthLength(tc.year, tc.month); got != tc.want {
+			t.Errorf("MonthLength(%d, %d) = %d, want %d", tc.year, tc.month, got, tc.want)
+		}
+	}
+}
+
+// TestRoundTrip walks every day of two centuries and checks that conversion is
+// reversible and that Jalali dates advance by exactly one day at a time.
+func TestRoundTrip(t *testing.T) {
+	day := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+	prev := FromTime(day.AddDate(0, 0, -1))
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		d := FromTime(day)
+		if !d.Valid() {
+			t.Fatalf("%s converted to invalid %v", day.Format("2006-01-02"), d)
+		}
+
+		next := Date{prev.Year, prev.Month, prev.Day + 1}
+		if next.Day > MonthLength(next.Year, next.Month) {
+			next = prev.AddMonths(1)
+		}
+		if d != next {
+			t.Fatalf("%s = %v, expected the day after %v to be %v", day.Format("2006-01-02"), d, prev, next)
+		}
+
+		gy, gm, gd, err := d.Gregorian()
+		if err != nil || gy != day.Year() || gm != day.Month() || gd != day.Day() {
+			t.Fatalf("%v.Gregorian() = %d-%02d-%02d (%v), want %s", d, gy, gm, gd, err, day.Format("2006-01-02"))
+		}
+		prev = d
+	}
+}
+
+func TestParse(t *testing.T) {
+	valid := map[string]Date{
+		"1403-01-15":  {1403, 1, 15},
+		"1403/1/5":    {1403, 1, 5},
+		" 1403-12-30": {1403, 12, 30},
+	}
+	for in, want := range valid {
+		got, err := Parse(in)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "1403-01", "1403-13-01", "1403-07-31", "1402-12-30", "1403-01-xx", "4000-01-01"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	// 21:00 UTC on 20 March 2024 is already 21 March (2 Farvardin) in Tehran.
+	ts := time.Date(2024, time.March, 20, 21, 0, 0, 0, time.UTC)
+	if got, want := Format(ts, tehran), "1403-01-02T00:30:00+03:30"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	got, err := Date{1403, 1, 1}.Time(tehran)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, time.March, 19, 20, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Time = %v, want %v", got.UTC(), want)
+	}
+}
@@ -0,0 +1,165 @@
+// Package mailer sends the service's transactional mail. Mailer is the
+// extension point; FromEnv picks an implementation from MAILER.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv builds the mailer named by MAILER: "log", which prints whole
+// messages, "file", which writes to MAILER_DIR (default data/mail), "smtp",
+// which sends through SMTP_HOST:SMTP_PORT (default 587) with SMTP_USERNAME and
+// SMTP_PASSWORD, or "memory". Without MAILER nothing is delivered and only the
+// recipient and subject are logged, so tokens never reach the log by accident.
+// MAIL_FROM sets the sender.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch kind := os.Getenv("MAILER"); kind {
+	case "":
+		log.Printf("Warning: MAILER is not set; mail is not delivered, only its recipient and subject are logged")
+		return LogMailer{From: from, Redact: true}, nil
+	case "log":
+		return LogMailer{From: from}, nil
+	case "file":
+		dir := os.Getenv("MAILER_DIR")
+		if dir == "" {
+			dir = filepath.Join("data", "mail")
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return FileMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("MAILER=smtp needs SMTP_HOST")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return SMTPMailer{
+			Addr:     net.JoinHostPort(host, port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, use log, file, smtp or memory", kind)
+	}
+}
+
+// LogMailer writes every message to the log, for local development. Bodies
+// carry reset tokens and verification links; Redact leaves them out.
+type LogMailer struct {
+	From   string
+	Redact bool
+}
+
+// Send logs msg.
+func (m LogMailer) Send(_ context.Context, msg Message) error {
+	if m.Redact {
+		log.Printf("mail from %s to %s: %s (body not logged)", m.From, msg.To, msg.Subject)
+		return nil
+	}
+	log.Printf("mail from %s to %s: %s\n%s", m.From, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message to Dir as an .eml file that mail clients
+// can open.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+// Send writes msg to a new file named after the time and recipient.
+func (m FileMailer) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(format(m.From, msg, now)), 0o644)
+}
+
+// SMTPMailer sends every message through an SMTP server, with STARTTLS when
+// the server offers it. Username and Password, when set, authenticate with
+// PLAIN, which net/smtp only allows over TLS or to localhost.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers msg to the server at Addr.
+func (m SMTPMailer) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(format(m.From, msg, time.Now())))
+}
+
+// MemoryMailer keeps every message in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records msg.
+func (m *MemoryMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message, date time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String()
+}
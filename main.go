@@ -1,8 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
 	"github.com/amirkhgraphic/go-arcaptcha-service/controllers"
 	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"github.com/amirkhgraphic/go-arcaptcha-service/mailer"
+	"github.com/amirkhgraphic/go-arcaptcha-service/middlewares"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
 	_ "github.com/amirkhgraphic/go-arcaptcha-service/docs"
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
@@ -12,6 +26,13 @@ import (
 // @title Arcaptcha Service API
 // @version 1.0
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description "Bearer " followed by a JWT, an API key or ADMIN_TOKEN.
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 
 func init() {
 	initializers.LoadEnvVariables()
@@ -19,7 +40,41 @@ func init() {
 }
 
 func main() {
-	router := gin.Default()
+	verifier, err := auth.NewJWTVerifierFromEnv()
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	services.Tokens = services.NewTokenIssuer(verifier)
+	services.Logins = services.NewLoginGuard()
+	services.Sessions = services.NewSessionManager()
+	services.EmailVerification = services.NewEmailVerifier()
+	services.Signups = services.NewSignupGuard()
+	services.Idempotency = services.NewIdempotencyStore()
+	services.Webhooks = services.NewWebhookDispatcher()
+	services.UserEvents = services.NewUserEventBroker()
+	if services.Mailer, err = mailer.FromEnv(); err != nil {
+		log.Fatalf("mailer: %v", err)
+	}
+
+	// ctx ends on SIGINT or SIGTERM, which stops the background loops and
+	// shuts the server down.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Deliver webhook events from the outbox, feed the event stream, sweep
+	// ended sessions and reload the disposable email domains in the background.
+	go services.Webhooks.Run(ctx, initializers.DB)
+	go services.UserEvents.Run(ctx, initializers.DB)
+	go services.Sessions.Run(ctx, initializers.DB)
+	go services.Signups.Run(ctx, initializers.DB)
+
+	router := gin.New()
+	router.Use(middlewares.RequestID(), gin.Logger(), gin.CustomRecovery(controllers.RecoverPanic))
+
+	// Unknown routes and methods answer with the same problem+json errors.
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(controllers.RouteNotFound)
+	router.NoMethod(controllers.MethodNotAllowed)
 
 	// Health/ping endpoint kept for quick checks.
 	router.GET("/ping", func(c *gin.Context) {
@@ -35,19 +90,100 @@ func main() {
 		fake.POST("/arcaptcha/verify", controllers.VerifyFakeChallenge)
 	}
 
-	api := router.Group("/api")
+	// /api/v1 is the versioned contract (see dto/v1); a future /api/v2 gets its
+	// own group.
+	api := router.Group("/api/v1", controllers.Authenticate(verifier))
+
+	// Sign-up, login, refresh, password reset and email verification stay open
+	// (sign-up behind the signup rules and the captcha, reset and resending
+	// verification mail behind the captcha, login once it has failed
+	// repeatedly). Reads need the reader role; writes to a user, and its
+	// sessions, need an editor or a login token linked to that user, or an
+	// admin. Login tokens can read only their own user.
+	reader := controllers.RequireRole(auth.RoleReader)
+	readerOrSelf := controllers.RequireReaderOrSelf()
+	owner := controllers.RequireSelfOrAdmin()
 	{
-		api.POST("/users", controllers.CreateUser)
-		api.GET("/users", controllers.ListUsers)
-		api.GET("/users/:id", controllers.GetUser)
-		api.PATCH("/users/:id", controllers.UpdateUser)
+		api.POST("/auth/login", controllers.Login)
+		api.POST("/auth/refresh", controllers.RefreshSession)
+		api.POST("/auth/logout", controllers.Logout)
+		api.POST("/auth/password-reset", controllers.RequestPasswordReset)
+		api.POST("/auth/password-reset/confirm", controllers.ConfirmPasswordReset)
 
-		api.GET("/users/group", controllers.GroupUsers)
+		api.POST("/users", controllers.Idempotent(), controllers.CreateUser)
+		api.POST("/users/verify-email", controllers.VerifyEmail)
+		api.POST("/users/verify-email/resend", controllers.ResendVerificationEmail)
+		api.GET("/users", reader, controllers.ListUsers)
+		api.GET("/users/:id", readerOrSelf, controllers.GetUser)
+		api.PATCH("/users/:id", owner, controllers.Idempotent(), controllers.UpdateUser)
+		api.PUT("/users/:id", owner, controllers.Idempotent(), controllers.ReplaceUser)
+		api.DELETE("/users/:id", owner, controllers.Idempotent(), controllers.DeleteUser)
+		api.POST("/users/:id/restore", owner, controllers.Idempotent(), controllers.RestoreUser)
+		api.GET("/users/:id/history", reader, controllers.UserHistory)
+		api.POST("/users/:id/revert", owner, controllers.Idempotent(), controllers.RevertUser)
+		api.POST("/users/:id/password", owner, controllers.ChangePassword)
+		api.GET("/users/:id/sessions", owner, controllers.ListSessions)
+		api.DELETE("/users/:id/sessions", owner, controllers.RevokeSessions)
+		api.DELETE("/users/:id/sessions/:session_id", owner, controllers.RevokeSession)
+
+		api.GET("/users/group", reader, controllers.GroupUsers)
+		api.GET("/users/export", reader, controllers.ExportUsers)
+		api.GET("/users/events", reader, controllers.UserEvents)
+		api.GET("/users/changes", reader, controllers.UserChanges)
+	}
+
+	admin := api.Group("/admin", controllers.RequireRole(auth.RoleAdmin))
+	{
+		admin.POST("/api-keys", controllers.CreateAPIKey)
+		admin.GET("/api-keys", controllers.ListAPIKeys)
+		admin.DELETE("/api-keys/:id", controllers.RevokeAPIKey)
+
+		admin.POST("/webhooks", controllers.CreateWebhook)
+		admin.GET("/webhooks", controllers.ListWebhooks)
+		admin.GET("/webhooks/:id", controllers.GetWebhook)
+		admin.PATCH("/webhooks/:id", controllers.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", controllers.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", controllers.ListWebhookDeliveries)
+		admin.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", controllers.RedeliverWebhook)
+
+		admin.POST("/signup-rules", controllers.CreateSignupRule)
+		admin.GET("/signup-rules", controllers.ListSignupRules)
+		admin.DELETE("/signup-rules/:id", controllers.DeleteSignupRule)
+		admin.GET("/signup-rules/disposable-domains", controllers.GetDisposableDomains)
+		admin.POST("/signup-rules/disposable-domains/reload", controllers.ReloadDisposableDomains)
+		admin.GET("/signup-rejections", controllers.ListSignupRejections)
+
+		admin.GET("/moderation/bios", controllers.ListBioReviews)
+		admin.POST("/moderation/bios/:id/approve", controllers.ApproveBio)
+		admin.POST("/moderation/bios/:id/reject", controllers.RejectBio)
 	}
 
 	// Serve swagger UI (uses the bundled docs/swagger.json)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
-	// listens on 0.0.0.0:8080 by default
-	router.Run()
+	// Listens on 0.0.0.0:$PORT, 8080 by default. Requests get ctx as their
+	// base context, so open event streams end when the server shuts down.
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
 }
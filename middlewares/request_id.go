@@ -0,0 +1,40 @@
+// Package middlewares holds the gin middleware shared by every route.
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the request ID in both directions.
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the gin context key the request ID is stored under.
+	RequestIDKey = "request_id"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID tags every request with an ID, reusing a well-formed X-Request-ID
+// sent by the client or a proxy, and echoes it in the response so logs and error
+// reports can be correlated.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
+	"gorm.io/gorm"
+)
+
+func init() {
+	initializers.LoadEnvVariables()
+	initializers.ConnectToDB()
+}
+
+// migration is one schema step. Up runs inside a transaction and is recorded in
+// schema_migrations so it only ever runs once per database.
+type migration struct {
+	ID string
+	Up func(tx *gorm.DB) error
+}
+
+// migrations lists every step in the order it must be applied. Append only.
+var migrations = []migration{
+	{ID: "001_create_users", Up: migration001},
+	{ID: "002_user_search_index", Up: migration002},
+	{ID: "003_user_version", Up: migration003},
+	{ID: "004_user_canonical_identity", Up: migration004},
+	{ID: "005_persian_text_normalization", Up: migration005},
+	{ID: "006_idempotency_keys", Up: migration006},
+	{ID: "007_user_revisions", Up: migration007},
+	{ID: "008_webhooks", Up: migration008},
+	{ID: "009_user_change_seq", Up: migration009},
+	{ID: "010_api_keys", Up: migration010},
+	{ID: "011_user_passwords", Up: migration011},
+	{ID: "012_user_sessions", Up: migration012},
+	{ID: "013_email_verification", Up: migration013},
+	{ID: "014_signup_rules", Up: migration014},
+	{ID: "015_bio_moderation", Up: migration015},
+	{ID: "016_idempotency_key_scope", Up: migration016},
+	{ID: "017_independent_email_rules", Up: migration017},
+}
+
+type schemaMigration struct {
+	ID        string `gorm:"primaryKey;type:varchar(64)"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+func main() {
+	db := initializers.DB
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		log.Fatalf("could not prepare schema_migrations: %v", err)
+	}
+
+	var appliedIDs []string
+	if err := db.Model(&schemaMigration{}).Pluck("id", &appliedIDs).Error; err != nil {
+		log.Fatalf("could not read schema_migrations: %v", err)
+	}
+	applied := make(map[string]bool, len(appliedIDs))
+	for _, id := range appliedIDs {
+		applied[id] = true
+	}
+
+	for _, m := range migrations {
+		if applied[m.ID] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			log.Fatalf("migration %s failed: %v", m.ID, err)
+		}
+		log.Printf("applied migration %s", m.ID)
+	}
+}
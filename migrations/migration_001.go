@@ -1,16 +1,24 @@
 package main
 
-import (
-	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
-	"github.com/amirkhgraphic/go-arcaptcha-service/models"
-)
+import "gorm.io/gorm"
 
-func init() {
-	initializers.LoadEnvVariables()
-	initializers.ConnectToDB()
+// usersV1 is the users table as first shipped. Later steps alter it explicitly,
+// so replaying 001 on a database that predates schema_migrations never jumps
+// ahead of them.
+type usersV1 struct {
+	gorm.Model
+	Username    string `gorm:"type:varchar(64);uniqueIndex:idx_users_username"`
+	Email       string `gorm:"type:varchar(128);uniqueIndex:idx_users_email"`
+	Bio         string `gorm:"type:text"`
+	Gender      string `gorm:"type:varchar(16)"`
+	Nationality string `gorm:"type:varchar(64)"`
 }
 
-func main() {
-	// AutoMigrate keeps the schema in sync with the User model.
-	initializers.DB.AutoMigrate(&models.User{})
+func (usersV1) TableName() string {
+	return "users"
+}
+
+// migration001 creates the users table.
+func migration001(tx *gorm.DB) error {
+	return tx.AutoMigrate(&usersV1{})
 }
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
+	"gorm.io/gorm"
+)
+
+// migration002 builds the full-text index behind the users search param and
+// indexes the rows that already exist.
+func migration002(tx *gorm.DB) error {
+	return services.UserSearchFor(tx).Migrate(tx)
+}
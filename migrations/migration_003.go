@@ -0,0 +1,24 @@
+package main
+
+import "gorm.io/gorm"
+
+// usersAt003 holds the users column migration003 adds, as it was when it
+// shipped.
+type usersAt003 struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (usersAt003) TableName() string {
+	return "users"
+}
+
+// migration003 adds users.version for optimistic concurrency control. Rows that
+// predate the column start at version 1.
+func migration003(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&usersAt003{}, "Version") {
+		if err := tx.Migrator().AddColumn(&usersAt003{}, "Version"); err != nil {
+			return err
+		}
+	}
+	return tx.Exec("UPDATE users SET version = 1 WHERE version IS NULL OR version = 0").Error
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+var canonicalIndexes = []string{"idx_users_username_canonical", "idx_users_email_canonical"}
+
+// usersAt004 holds the users columns and indexes migration004 adds, as they
+// were when it shipped.
+type usersAt004 struct {
+	UsernameCanonical string `gorm:"type:varchar(64);uniqueIndex:idx_users_username_canonical"`
+	EmailCanonical    string `gorm:"type:varchar(128);uniqueIndex:idx_users_email_canonical"`
+}
+
+func (usersAt004) TableName() string {
+	return "users"
+}
+
+// userIdentityAt004 is a users row as the canonical backfills read it.
+type userIdentityAt004 struct {
+	ID        uint
+	Username  string
+	Email     string
+	DeletedAt *time.Time
+}
+
+func (userIdentityAt004) TableName() string {
+	return "users"
+}
+
+// emailRulesAt004 are the optional email rules, read from the environment
+// variables the service reads them from.
+type emailRulesAt004 struct {
+	GmailDots bool
+	PlusTags  bool
+}
+
+func emailRulesFromEnv() emailRulesAt004 {
+	return emailRulesAt004{GmailDots: envBool("EMAIL_CANONICAL_GMAIL_DOTS"), PlusTags: envBool("EMAIL_CANONICAL_PLUS_TAGS")}
+}
+
+// foldAt004 is the identity package's fold as migration004 shipped it: NFKC,
+// trimmed and lowercased.
+func foldAt004(s string) string {
+	return strings.ToLower(strings.TrimSpace(norm.NFKC.String(s)))
+}
+
+// canonicalEmailAt004 applies the email rules as they were when migrations 004
+// and 005 shipped to a folded email. Back then Gmail dot folding also dropped
+// a +tag, whether or not PlusTags was on.
+func canonicalEmailAt004(email string, rules emailRulesAt004) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	gmail := domain == "gmail.com" || domain == "googlemail.com"
+	if rules.PlusTags || (rules.GmailDots && gmail) {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if rules.GmailDots && gmail {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// migration004 adds the canonical username/email columns, backfills them and only
+// then adds their unique indexes. Existing accounts that collide once
+// canonicalized are reported and the migration fails without changing anything,
+// so they can be merged or renamed first. The backfill uses the canonical forms
+// as they were when it shipped, not the identity package's current ones.
+func migration004(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, field := range []string{"UsernameCanonical", "EmailCanonical"} {
+		if !m.HasColumn(&usersAt004{}, field) {
+			if err := m.AddColumn(&usersAt004{}, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	rules := emailRulesFromEnv()
+	var users []userIdentityAt004
+	err := tx.Select("id", "username", "email").FindInBatches(&users, 500, func(_ *gorm.DB, _ int) error {
+		for _, u := range users {
+			if err := tx.Table("users").Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+				"username_canonical": foldAt004(u.Username),
+				"email_canonical":    canonicalEmailAt004(foldAt004(u.Email), rules),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return indexCanonicalIdentity(tx)
+}
+
+// indexCanonicalIdentity adds the unique canonical indexes, failing with every
+// collision logged if existing rows would violate them.
+func indexCanonicalIdentity(tx *gorm.DB) error {
+	collisions := 0
+	for _, col := range []string{"username", "email"} {
+		n, err := reportCollisions(tx, col)
+		if err != nil {
+			return err
+		}
+		collisions += n
+	}
+	if collisions > 0 {
+		return fmt.Errorf("%d canonical username/email collision(s) found, resolve them and re-run", collisions)
+	}
+
+	m := tx.Migrator()
+	for _, index := range canonicalIndexes {
+		if !m.HasIndex(&usersAt004{}, index) {
+			if err := m.CreateIndex(&usersAt004{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reportCollisions logs every group of users (soft-deleted ones included, as the
+// index covers them) that share a canonical value for col.
+func reportCollisions(tx *gorm.DB, col string) (int, error) {
+	canonical := col + "_canonical"
+	var groups []struct {
+		Canonical string
+		Total     int
+	}
+	if err := tx.Table("users").
+		Select(canonical + " AS canonical, COUNT(*) AS total").
+		Group(canonical).
+		Having("COUNT(*) > 1").
+		Scan(&groups).Error; err != nil {
+		return 0, err
+	}
+
+	for _, g := range groups {
+		var rows []userIdentityAt004
+		if err := tx.Where(canonical+" = ?", g.Canonical).Order("id").Find(&rows).Error; err != nil {
+			return 0, err
+		}
+		accounts := make([]string, len(rows))
+		for i, u := range rows {
+			value := u.Username
+			if col == "email" {
+				value = u.Email
+			}
+			accounts[i] = fmt.Sprintf("#%d %q", u.ID, value)
+			if u.DeletedAt != nil {
+				accounts[i] += " (deleted)"
+			}
+		}
+		log.Printf("collision on %s %q: %s", col, g.Canonical, strings.Join(accounts, ", "))
+	}
+	return len(groups), nil
+}
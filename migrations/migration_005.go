@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// usersAt005 holds the users columns migration005 rewrites, as they were when
+// it shipped.
+type usersAt005 struct {
+	ID       uint
+	Username string
+	Email    string
+	Bio      string
+}
+
+func (usersAt005) TableName() string {
+	return "users"
+}
+
+// lettersAt005 and joinersAt005 are the textnorm replacements as migration005
+// shipped them: Arabic letter variants and Persian/Arabic-Indic digits, and the
+// invisible joiners and direction marks.
+var (
+	lettersAt005 = strings.NewReplacer(
+		"\u064a", "\u06cc", // ARABIC YEH -> FARSI YEH
+		"\u0649", "\u06cc", // ALEF MAKSURA -> FARSI YEH
+		"\u0643", "\u06a9", // ARABIC KAF -> KEHEH
+		"\u0640", "", // TATWEEL
+		"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+		"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+		"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+		"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	)
+	joinersAt005 = strings.NewReplacer(
+		"\u200c", "", // ZERO WIDTH NON-JOINER
+		"\u200d", "", // ZERO WIDTH JOINER
+		"\u200e", "", // LEFT-TO-RIGHT MARK
+		"\u200f", "", // RIGHT-TO-LEFT MARK
+	)
+)
+
+// compactAt005 is textnorm.Compact as migration005 shipped it.
+func compactAt005(s string) string {
+	return joinersAt005.Replace(lettersAt005.Replace(s))
+}
+
+// foldAt005 is the identity package's fold as migration005 shipped it, with
+// the Arabic/Persian folding migration004's lacked.
+func foldAt005(s string) string {
+	return strings.ToLower(strings.TrimSpace(compactAt005(norm.NFKC.String(s))))
+}
+
+// migration005 folds Arabic/Persian letter and digit variants in the usernames,
+// emails and bios written before textnorm was applied on write, and recomputes
+// the canonical columns. The canonical indexes are dropped for the rewrite and
+// rebuilt afterwards, so accounts that only now collide (علي vs علی) are reported
+// the same way migration 004 reports them. Like migration004 it uses the
+// normalization and canonical forms as they were when it shipped.
+func migration005(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, index := range canonicalIndexes {
+		// The indexes are still the ones migration004 created.
+		if m.HasIndex(&usersAt004{}, index) {
+			if err := m.DropIndex(&usersAt004{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	rules := emailRulesFromEnv()
+	var users []usersAt005
+	err := tx.Select("id", "username", "email", "bio").FindInBatches(&users, 500, func(_ *gorm.DB, _ int) error {
+		for _, u := range users {
+			username, email, bio := compactAt005(u.Username), compactAt005(u.Email), lettersAt005.Replace(u.Bio)
+			updates := map[string]interface{}{}
+			if username != u.Username || email != u.Email || bio != u.Bio {
+				// The stored representation changes, so bump the version to
+				// invalidate ETags clients may hold.
+				updates["username"], updates["email"], updates["bio"] = username, email, bio
+				updates["version"] = gorm.Expr("version + 1")
+			}
+			updates["username_canonical"] = foldAt005(username)
+			updates["email_canonical"] = canonicalEmailAt004(foldAt005(email), rules)
+
+			if err := tx.Table("users").Where("id = ?", u.ID).UpdateColumns(updates).Error; err != nil {
+				// username and email keep their own unique indexes.
+				return fmt.Errorf("user #%d: normalizing to %q / %q: %w", u.ID, username, email, err)
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return indexCanonicalIdentity(tx)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyKeysV1 is the idempotency_keys table as first shipped.
+type idempotencyKeysV1 struct {
+	Key         string `gorm:"primaryKey;type:varchar(255)"`
+	Fingerprint string `gorm:"type:varchar(64);not null"`
+	Status      int    `gorm:"not null;default:0"`
+	Header      string `gorm:"type:text"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index:idx_idempotency_keys_expires_at"`
+}
+
+func (idempotencyKeysV1) TableName() string {
+	return "idempotency_keys"
+}
+
+// migration006 creates idempotency_keys, which stores responses to replay for
+// retried writes.
+func migration006(tx *gorm.DB) error {
+	return tx.AutoMigrate(&idempotencyKeysV1{})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userRevisionsV1 is the user_revisions table as first shipped.
+type userRevisionsV1 struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;index:idx_user_revisions_user_id"`
+	Version       uint   `gorm:"not null"`
+	Action        string `gorm:"type:varchar(16);not null"`
+	Actor         string `gorm:"type:varchar(128)"`
+	RequestID     string `gorm:"type:varchar(128)"`
+	ChangedFields string `gorm:"type:varchar(255)"`
+	Changes       string `gorm:"type:text"`
+	Snapshot      string `gorm:"type:text"`
+	RevertedTo    *uint
+	CreatedAt     time.Time `gorm:"index:idx_user_revisions_created_at"`
+}
+
+func (userRevisionsV1) TableName() string {
+	return "user_revisions"
+}
+
+// usersAt007 holds the users columns migration007 reads, as they were when it
+// shipped.
+type usersAt007 struct {
+	ID          uint
+	Version     uint
+	Username    string
+	Email       string
+	Bio         string
+	Gender      string
+	Nationality string
+}
+
+func (usersAt007) TableName() string {
+	return "users"
+}
+
+// migration007 creates user_revisions and gives every existing user, deleted
+// ones included, a baseline revision holding its current fields, so history has
+// a starting point and the current version can be reverted to.
+func migration007(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&userRevisionsV1{}); err != nil {
+		return err
+	}
+
+	var users []usersAt007
+	return tx.Select("id", "version", "username", "email", "bio", "gender", "nationality").
+		FindInBatches(&users, 500, func(_ *gorm.DB, _ int) error {
+			now := time.Now()
+			revisions := make([]userRevisionsV1, 0, len(users))
+			for _, u := range users {
+				snapshot, err := json.Marshal(map[string]string{
+					"username":    u.Username,
+					"email":       u.Email,
+					"bio":         u.Bio,
+					"gender":      u.Gender,
+					"nationality": u.Nationality,
+				})
+				if err != nil {
+					return fmt.Errorf("user #%d: recording baseline revision: %w", u.ID, err)
+				}
+				revisions = append(revisions, userRevisionsV1{
+					UserID:    u.ID,
+					Version:   u.Version,
+					Action:    "baseline",
+					Actor:     "migration",
+					Changes:   "{}",
+					Snapshot:  string(snapshot),
+					CreatedAt: now,
+				})
+			}
+			if len(revisions) == 0 {
+				return nil
+			}
+			return tx.Create(&revisions).Error
+		}).Error
+}
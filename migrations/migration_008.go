@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webhookSubscriptionsV1 is the webhook_subscriptions table as first shipped.
+type webhookSubscriptionsV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	URL       string `gorm:"type:varchar(2048);not null"`
+	Secret    string `gorm:"type:varchar(128);not null"`
+	Events    string `gorm:"type:varchar(255);not null"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (webhookSubscriptionsV1) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// outboxEventsV1 is the outbox_events table as first shipped.
+type outboxEventsV1 struct {
+	ID           uint   `gorm:"primaryKey"`
+	Type         string `gorm:"type:varchar(64);not null"`
+	UserID       uint   `gorm:"not null;index:idx_outbox_events_user_id"`
+	Payload      string `gorm:"type:text;not null"`
+	CreatedAt    time.Time
+	DispatchedAt *time.Time `gorm:"index:idx_outbox_events_dispatched_at"`
+}
+
+func (outboxEventsV1) TableName() string {
+	return "outbox_events"
+}
+
+// webhookDeliveriesV1 is the webhook_deliveries table as first shipped.
+type webhookDeliveriesV1 struct {
+	ID             uint      `gorm:"primaryKey"`
+	SubscriptionID uint      `gorm:"not null;index:idx_webhook_deliveries_subscription_id"`
+	EventID        uint      `gorm:"not null;index:idx_webhook_deliveries_event_id"`
+	Status         string    `gorm:"type:varchar(16);not null;index:idx_webhook_deliveries_status"`
+	Attempts       int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"index:idx_webhook_deliveries_next_attempt_at"`
+	LastStatusCode int
+	LastError      string `gorm:"type:text"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (webhookDeliveriesV1) TableName() string {
+	return "webhook_deliveries"
+}
+
+// migration008 creates the webhook subscriptions, the event outbox and the
+// delivery log.
+func migration008(tx *gorm.DB) error {
+	return tx.AutoMigrate(&webhookSubscriptionsV1{}, &outboxEventsV1{}, &webhookDeliveriesV1{})
+}
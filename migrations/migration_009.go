@@ -0,0 +1,54 @@
+package main
+
+import "gorm.io/gorm"
+
+// changeSequencesV1 is the change_sequences table as first shipped.
+type changeSequencesV1 struct {
+	Name  string `gorm:"primaryKey;type:varchar(32)"`
+	Value uint64 `gorm:"not null;default:0"`
+}
+
+func (changeSequencesV1) TableName() string {
+	return "change_sequences"
+}
+
+// usersAt009 holds the users column and index migration009 adds, as they were
+// when it shipped.
+type usersAt009 struct {
+	ChangeSeq uint64 `gorm:"not null;default:0;index"`
+}
+
+func (usersAt009) TableName() string {
+	return "users"
+}
+
+// migration009 adds users.change_seq for the sync feed and numbers the existing
+// users, deleted ones included, in the order they last changed.
+func migration009(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&changeSequencesV1{}); err != nil {
+		return err
+	}
+	m := tx.Migrator()
+	if !m.HasColumn(&usersAt009{}, "ChangeSeq") {
+		if err := m.AddColumn(&usersAt009{}, "ChangeSeq"); err != nil {
+			return err
+		}
+	}
+	if !m.HasIndex(&usersAt009{}, "ChangeSeq") {
+		if err := m.CreateIndex(&usersAt009{}, "ChangeSeq"); err != nil {
+			return err
+		}
+	}
+
+	var ids []uint
+	if err := tx.Table("users").Order("updated_at, id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := tx.Table("users").Where("id = ?", id).UpdateColumn("change_seq", i+1).Error; err != nil {
+			return err
+		}
+	}
+	// "users" is the counter behind users.change_seq.
+	return tx.Create(&changeSequencesV1{Name: "users", Value: uint64(len(ids))}).Error
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// apiKeysV1 is the api_keys table as first shipped.
+type apiKeysV1 struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"type:varchar(100);not null"`
+	Prefix     string `gorm:"type:varchar(16);not null"`
+	Hash       string `gorm:"type:varchar(64);not null;uniqueIndex:idx_api_keys_hash"`
+	Role       string `gorm:"type:varchar(16);not null"`
+	UserID     *uint  `gorm:"index:idx_api_keys_user_id"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+func (apiKeysV1) TableName() string {
+	return "api_keys"
+}
+
+// migration010 creates api_keys, the hashed API credentials.
+func migration010(tx *gorm.DB) error {
+	return tx.AutoMigrate(&apiKeysV1{})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// usersAt011 holds the users column migration011 adds, as it was when it
+// shipped.
+type usersAt011 struct {
+	PasswordHash string `gorm:"type:varchar(255)"`
+}
+
+func (usersAt011) TableName() string {
+	return "users"
+}
+
+// passwordResetTokensV1 is the password_reset_tokens table as first shipped.
+type passwordResetTokensV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index:idx_password_reset_tokens_user_id"`
+	TokenHash string `gorm:"type:varchar(64);not null;uniqueIndex:idx_password_reset_tokens_token_hash"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (passwordResetTokensV1) TableName() string {
+	return "password_reset_tokens"
+}
+
+// loginFailuresV1 is the login_failures table as first shipped.
+type loginFailuresV1 struct {
+	Key          string `gorm:"primaryKey;type:varchar(191)"`
+	Failures     int    `gorm:"not null;default:0"`
+	LastFailedAt time.Time
+}
+
+func (loginFailuresV1) TableName() string {
+	return "login_failures"
+}
+
+// migration011 adds password credentials: the users.password_hash column, the
+// reset tokens and the failed login counters.
+func migration011(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&usersAt011{}, "PasswordHash") {
+		if err := tx.Migrator().AddColumn(&usersAt011{}, "PasswordHash"); err != nil {
+			return err
+		}
+	}
+	return tx.AutoMigrate(&passwordResetTokensV1{}, &loginFailuresV1{})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userSessionsV1 is the user_sessions table as first shipped.
+type userSessionsV1 struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;index:idx_user_sessions_user_id"`
+	Device        string `gorm:"type:varchar(100)"`
+	IP            string `gorm:"type:varchar(45)"`
+	UserAgent     string `gorm:"type:varchar(255)"`
+	CreatedAt     time.Time
+	LastSeenAt    time.Time
+	ExpiresAt     time.Time `gorm:"index:idx_user_sessions_expires_at"`
+	RevokedAt     *time.Time
+	RevokedReason string `gorm:"type:varchar(32)"`
+}
+
+func (userSessionsV1) TableName() string {
+	return "user_sessions"
+}
+
+// refreshTokensV1 is the refresh_tokens table as first shipped.
+type refreshTokensV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID uint   `gorm:"not null;index:idx_refresh_tokens_session_id"`
+	TokenHash string `gorm:"type:varchar(64);not null;uniqueIndex:idx_refresh_tokens_token_hash"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (refreshTokensV1) TableName() string {
+	return "refresh_tokens"
+}
+
+// migration012 adds login sessions and their rotating refresh tokens.
+func migration012(tx *gorm.DB) error {
+	return tx.AutoMigrate(&userSessionsV1{}, &refreshTokensV1{})
+}
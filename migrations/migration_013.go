@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// usersAt013 holds the users columns migration013 adds, as they were when it
+// shipped.
+type usersAt013 struct {
+	EmailVerified   bool `gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time
+}
+
+func (usersAt013) TableName() string {
+	return "users"
+}
+
+// rateLimitsV1 is the rate_limits table as first shipped.
+type rateLimitsV1 struct {
+	Key         string `gorm:"primaryKey;type:varchar(191)"`
+	Hits        int    `gorm:"not null;default:0"`
+	WindowStart time.Time
+}
+
+func (rateLimitsV1) TableName() string {
+	return "rate_limits"
+}
+
+// migration013 adds email verification: users.email_verified, which existing
+// users start without, users.email_verified_at and the rate limit counters of
+// the resend endpoint.
+func migration013(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, field := range []string{"EmailVerified", "EmailVerifiedAt"} {
+		if !m.HasColumn(&usersAt013{}, field) {
+			if err := m.AddColumn(&usersAt013{}, field); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.AutoMigrate(&rateLimitsV1{})
+}
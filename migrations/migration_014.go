@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// signupRulesV1 is the signup_rules table as first shipped.
+type signupRulesV1 struct {
+	ID         uint   `gorm:"primaryKey"`
+	Kind       string `gorm:"type:varchar(32);not null;uniqueIndex:idx_signup_rules_kind_value"`
+	Value      string `gorm:"type:varchar(255);not null;uniqueIndex:idx_signup_rules_kind_value"`
+	MaxSignups int    `gorm:"not null;default:0"`
+	Note       string `gorm:"type:varchar(255)"`
+	CreatedAt  time.Time
+}
+
+func (signupRulesV1) TableName() string {
+	return "signup_rules"
+}
+
+// signupRejectionsV1 is the signup_rejections table as first shipped.
+type signupRejectionsV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Rule      string `gorm:"type:varchar(32);not null;index:idx_signup_rejections_rule"`
+	RuleID    *uint
+	Field     string `gorm:"type:varchar(32);not null"`
+	UserID    *uint
+	Username  string    `gorm:"type:varchar(255)"`
+	Email     string    `gorm:"type:varchar(255)"`
+	ClientIP  string    `gorm:"type:varchar(45)"`
+	RequestID string    `gorm:"type:varchar(64)"`
+	CreatedAt time.Time `gorm:"index:idx_signup_rejections_created_at"`
+}
+
+func (signupRejectionsV1) TableName() string {
+	return "signup_rejections"
+}
+
+// reservedUsernames seed the signup rules; admins can remove them.
+var reservedUsernames = []string{
+	"admin", "administrator", "root", "superuser", "sysadmin", "system",
+	"support", "help", "info", "contact", "security", "abuse", "postmaster",
+	"webmaster", "hostmaster", "noreply", "no-reply", "moderator", "staff",
+	"api", "www", "mail", "arcaptcha",
+}
+
+// migration014 adds the signup abuse rules, seeded with the reserved usernames,
+// and the log of the writes they rejected.
+func migration014(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&signupRulesV1{}, &signupRejectionsV1{}); err != nil {
+		return err
+	}
+	rules := make([]signupRulesV1, len(reservedUsernames))
+	for i, name := range reservedUsernames {
+		rules[i] = signupRulesV1{Kind: "reserved_username", Value: name, Note: "built in"}
+	}
+	return tx.Create(&rules).Error
+}
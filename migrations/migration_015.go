@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// usersAt015 holds the users columns and index migration015 adds, as they were
+// when it shipped.
+type usersAt015 struct {
+	ModerationStatus string `gorm:"type:varchar(16);not null;default:approved;index"`
+	ModerationFlags  string `gorm:"type:varchar(64)"`
+}
+
+func (usersAt015) TableName() string {
+	return "users"
+}
+
+// bioAt015 is a users row as migration015 reads it.
+type bioAt015 struct {
+	ID  uint
+	Bio string
+}
+
+func (bioAt015) TableName() string {
+	return "users"
+}
+
+// moderationAt015 is the bio moderation as migration015 shipped it, configured
+// from the environment variables the service reads: MODERATION_CHECKS,
+// MODERATION_WORDLISTS and MODERATION_MAX_REPEAT.
+type moderationAt015 struct {
+	checks    map[string]bool
+	words     []string
+	maxRepeat int
+}
+
+var (
+	linkPatternAt015  = regexp.MustCompile(`(?:https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*\.(?:com|net|org|info|biz|io|co|me|ir|ru|xyz|top|site|online|link|click|app|shop|live)\b|\bt\.me/`)
+	phonePatternAt015 = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+)
+
+// moderationFromEnv loads the configuration. Unlike the service, which only
+// warns, it fails when a wordlist can not be read: the backfill runs once, and
+// bios it lets through unchecked would never be queued.
+func moderationFromEnv() (moderationAt015, error) {
+	all := []string{"wordlist", "link", "phone", "repeated_chars"}
+	c := moderationAt015{checks: map[string]bool{}, maxRepeat: 5}
+	checks := strings.TrimSpace(os.Getenv("MODERATION_CHECKS"))
+	if checks == "" {
+		checks = strings.Join(all, ",")
+	}
+	for _, name := range strings.Split(checks, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, check := range all {
+			known = known || check == name
+		}
+		switch {
+		case name == "" || name == "none":
+		case known:
+			c.checks[name] = true
+		default:
+			log.Printf("Warning: ignoring unknown moderation check %q", name)
+		}
+	}
+	if v := os.Getenv("MODERATION_MAX_REPEAT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Printf("Warning: ignoring invalid MODERATION_MAX_REPEAT=%q", v)
+		} else {
+			c.maxRepeat = n
+		}
+	}
+	if !c.checks["wordlist"] {
+		return c, nil
+	}
+	files := os.Getenv("MODERATION_WORDLISTS")
+	if files == "" {
+		files = "data/moderation/en.txt,data/moderation/fa.txt"
+	}
+	for _, file := range strings.Split(files, ",") {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		words, err := readWordlistAt015(file)
+		if err != nil {
+			return c, fmt.Errorf("moderation wordlist %s: %w (set MODERATION_WORDLISTS or run from the service directory)", file, err)
+		}
+		c.words = append(c.words, words...)
+	}
+	return c, nil
+}
+
+// check returns the flags text raises.
+func (c moderationAt015) check(text string) []string {
+	folded := foldBioAt015(text)
+	var flags []string
+	if c.checks["wordlist"] && len(c.words) > 0 {
+		padded := " " + strings.Join(wordsAt015(folded), " ") + " "
+		for _, w := range c.words {
+			if strings.Contains(padded, " "+w+" ") {
+				flags = append(flags, "wordlist")
+				break
+			}
+		}
+	}
+	if c.checks["link"] && linkPatternAt015.MatchString(folded) {
+		flags = append(flags, "link")
+	}
+	if c.checks["phone"] {
+		for _, m := range phonePatternAt015.FindAllString(folded, -1) {
+			digits := 0
+			for _, r := range m {
+				if r >= '0' && r <= '9' {
+					digits++
+				}
+			}
+			if digits >= 9 {
+				flags = append(flags, "phone")
+				break
+			}
+		}
+	}
+	if c.checks["repeated_chars"] && longestRunAt015(folded) > c.maxRepeat {
+		flags = append(flags, "repeated_chars")
+	}
+	return flags
+}
+
+func foldBioAt015(s string) string {
+	return strings.ToLower(compactAt005(norm.NFKC.String(s)))
+}
+
+func wordsAt015(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+}
+
+func longestRunAt015(s string) int {
+	longest, run := 0, 0
+	var prev rune
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			run, prev = 0, 0
+			continue
+		}
+		if r == prev {
+			run++
+		} else {
+			run, prev = 1, r
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+func readWordlistAt015(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if w := strings.Join(wordsAt015(foldBioAt015(line)), " "); w != "" {
+			out = append(out, w)
+		}
+	}
+	return out, scanner.Err()
+}
+
+// migration015 adds bio moderation: users.moderation_status, which existing
+// users start approved in, and users.moderation_flags. Existing bios are run
+// through the moderation checks as they were when it shipped, and the flagged
+// ones are queued for review.
+func migration015(tx *gorm.DB) error {
+	moderation, err := moderationFromEnv()
+	if err != nil {
+		return err
+	}
+
+	m := tx.Migrator()
+	for _, field := range []string{"ModerationStatus", "ModerationFlags"} {
+		if !m.HasColumn(&usersAt015{}, field) {
+			if err := m.AddColumn(&usersAt015{}, field); err != nil {
+				return err
+			}
+		}
+	}
+	if !m.HasIndex(&usersAt015{}, "ModerationStatus") {
+		if err := m.CreateIndex(&usersAt015{}, "ModerationStatus"); err != nil {
+			return err
+		}
+	}
+
+	var users []bioAt015
+	return tx.Select("id", "bio").Where("bio <> ''").
+		FindInBatches(&users, 500, func(_ *gorm.DB, _ int) error {
+			for _, u := range users {
+				flags := moderation.check(u.Bio)
+				if len(flags) == 0 {
+					continue
+				}
+				err := tx.Table("users").Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+					"moderation_status": "pending",
+					"moderation_flags":  strings.Join(flags, ","),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
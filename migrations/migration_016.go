@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyKeysV2 scopes keys to the caller: the primary key is (scope, key).
+type idempotencyKeysV2 struct {
+	Scope       string `gorm:"primaryKey;type:varchar(255)"`
+	Key         string `gorm:"primaryKey;type:varchar(255)"`
+	Fingerprint string `gorm:"type:varchar(64);not null"`
+	Status      int    `gorm:"not null;default:0"`
+	Header      string `gorm:"type:text"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index:idx_idempotency_keys_expires_at"`
+}
+
+func (idempotencyKeysV2) TableName() string {
+	return "idempotency_keys"
+}
+
+// migration016 rebuilds idempotency_keys with a per-caller key namespace. The
+// stored responses only exist to replay retries for IDEMPOTENCY_TTL and do not
+// say whose key they were, so they are dropped rather than carried over.
+func migration016(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&idempotencyKeysV1{}); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(&idempotencyKeysV2{})
+}
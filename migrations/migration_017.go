@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// usersAt017 holds the users columns migration017 reads, as they were when it
+// shipped.
+type usersAt017 struct {
+	ID             uint
+	Email          string
+	EmailCanonical string
+}
+
+func (usersAt017) TableName() string {
+	return "users"
+}
+
+// canonicalEmailAt017 applies the email rules as migration017 shipped them to a
+// folded email: Gmail dot folding and +tag stripping are independent.
+func canonicalEmailAt017(email string, rules emailRulesAt004) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if rules.PlusTags {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+	if rules.GmailDots && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// migration017 recomputes the canonical emails written by migrations 004 and
+// 005, which dropped the +tag of Gmail addresses whenever Gmail dot folding was
+// on. The service stopped doing that, so those addresses no longer found their
+// own accounts. The new values only tell more addresses apart, so the unique
+// index still holds.
+func migration017(tx *gorm.DB) error {
+	rules := emailRulesFromEnv()
+	var users []usersAt017
+	return tx.Select("id", "email", "email_canonical").FindInBatches(&users, 500, func(_ *gorm.DB, _ int) error {
+		for _, u := range users {
+			canonical := canonicalEmailAt017(foldAt005(u.Email), rules)
+			if canonical == u.EmailCanonical {
+				continue
+			}
+			if err := tx.Table("users").Where("id = ?", u.ID).UpdateColumn("email_canonical", canonical).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
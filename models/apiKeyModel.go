@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKey is a credential for the API. Only a hash of the key is stored; the
+// key itself is shown once, when it is created.
+type APIKey struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"type:varchar(100);not null"`
+	// Prefix is the start of the key, kept so keys can be told apart in lists.
+	Prefix string `gorm:"type:varchar(16);not null"`
+	// Hash is the hex SHA-256 of the key.
+	Hash string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Role string `gorm:"type:varchar(16);not null"`
+	// UserID links the key to the user an editor key may change.
+	UserID     *uint `gorm:"index"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
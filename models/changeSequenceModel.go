@@ -0,0 +1,9 @@
+package models
+
+// ChangeSequence is a named counter. Writes take the next value inside their
+// transaction; the row lock serializes them, so values become visible in the
+// order they were taken.
+type ChangeSequence struct {
+	Name  string `gorm:"primaryKey;type:varchar(32)"`
+	Value uint64 `gorm:"not null;default:0"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use password reset token. Only the hash of
+// the token sent by mail is stored.
+type PasswordResetToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginFailure counts recent failed logins for one account ("user:<id>", or
+// "login:<name>" for unknown names) or one client ("ip:<address>").
+type LoginFailure struct {
+	Key          string `gorm:"primaryKey;type:varchar(191)"`
+	Failures     int    `gorm:"not null;default:0"`
+	LastFailedAt time.Time
+}
+
+// RateLimit counts the hits of one key, e.g. "verify:ip:<address>", in the
+// fixed window that started at WindowStart.
+type RateLimit struct {
+	Key         string `gorm:"primaryKey;type:varchar(191)"`
+	Hits        int    `gorm:"not null;default:0"`
+	WindowStart time.Time
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey is the stored outcome of a request sent with an Idempotency-Key
+// header. Status is 0 while the first request is still running.
+type IdempotencyKey struct {
+	// Scope is the caller the key belongs to (see auth.Principal.Actor), or
+	// ip:<address> for anonymous callers, so callers never share keys.
+	Scope string `gorm:"primaryKey;type:varchar(255)"`
+	Key   string `gorm:"primaryKey;type:varchar(255)"`
+	// Fingerprint hashes the caller, method, URL, content type, If-Match,
+	// X-Challenge-ID and body, so a reused key with a different request can be
+	// told apart from a retry.
+	Fingerprint string `gorm:"type:varchar(64);not null"`
+	Status      int    `gorm:"not null;default:0"`
+	// Header holds the replayed response headers as JSON.
+	Header    string `gorm:"type:text"`
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
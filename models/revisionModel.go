@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// UserRevision actions.
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+	RevisionRevert   = "revert"
+	RevisionBaseline = "baseline"
+	RevisionVerify   = "verify_email"
+	RevisionModerate = "moderate_bio"
+)
+
+// UserRevision is one entry of a user's audit trail: who changed what, when and
+// in which request. Rows are only ever inserted.
+type UserRevision struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;index"`
+	// Version is the user's version after the change.
+	Version   uint   `gorm:"not null"`
+	Action    string `gorm:"type:varchar(16);not null"`
+	Actor     string `gorm:"type:varchar(128)"`
+	RequestID string `gorm:"type:varchar(128)"`
+	// ChangedFields lists the changed fields as ",email,bio," so history can be
+	// filtered by field with LIKE on every dialect.
+	ChangedFields string `gorm:"type:varchar(255)"`
+	// Changes is the JSON field-level diff, {"email": {"from": ..., "to": ...}}.
+	Changes string `gorm:"type:text"`
+	// Snapshot is the JSON of every editable field after the change; reverts
+	// restore it.
+	Snapshot string `gorm:"type:text"`
+	// RevertedTo is the version a revert restored.
+	RevertedTo *uint
+	CreatedAt  time.Time `gorm:"index"`
+}
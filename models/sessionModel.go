@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Reasons a session was revoked, stored in UserSession.RevokedReason.
+const (
+	SessionLogout          = "logout"
+	SessionRevoked         = "revoked"
+	SessionRefreshReuse    = "refresh_reuse"
+	SessionPasswordChanged = "password_changed"
+	SessionPasswordReset   = "password_reset"
+	SessionUserDeleted     = "user_deleted"
+)
+
+// UserSession is one login of a user on one device. Its refresh tokens are
+// rotated on every use; all of them belong to the session, so revoking it
+// logs the device out.
+type UserSession struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;index"`
+	Device        string `gorm:"type:varchar(100)"`
+	IP            string `gorm:"type:varchar(45)"`
+	UserAgent     string `gorm:"type:varchar(255)"`
+	CreatedAt     time.Time
+	LastSeenAt    time.Time
+	ExpiresAt     time.Time `gorm:"index"`
+	RevokedAt     *time.Time
+	RevokedReason string `gorm:"type:varchar(32)"`
+}
+
+// RefreshToken is one refresh token of a session. Only its hash is stored; a
+// token that was already exchanged (UsedAt set) being presented again means
+// it leaked, and the whole session is revoked.
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
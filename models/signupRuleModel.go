@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Signup rule kinds.
+const (
+	// RuleReservedUsername blocks one username, compared canonically.
+	RuleReservedUsername = "reserved_username"
+	// RuleUsernamePattern blocks usernames whose canonical form matches a regex.
+	RuleUsernamePattern = "username_pattern"
+	// RuleEmailPattern blocks emails whose canonical form matches a regex.
+	RuleEmailPattern = "email_pattern"
+	// RuleBlockedDomain blocks an email domain and its subdomains.
+	RuleBlockedDomain = "blocked_domain"
+	// RuleDomainCap limits the signups per email domain ("*" for any domain
+	// without its own cap) within SIGNUP_DOMAIN_CAP_WINDOW.
+	RuleDomainCap = "domain_cap"
+	// RuleDisposableDomain is not stored: it names rejections by the
+	// disposable domain list file.
+	RuleDisposableDomain = "disposable_domain"
+)
+
+// SignupRule is one rule checked before a user is created or changes its
+// username or email.
+type SignupRule struct {
+	ID    uint   `gorm:"primaryKey"`
+	Kind  string `gorm:"type:varchar(32);not null;uniqueIndex:idx_signup_rules_kind_value"`
+	Value string `gorm:"type:varchar(255);not null;uniqueIndex:idx_signup_rules_kind_value"`
+	// MaxSignups is the cap of a domain_cap rule.
+	MaxSignups int    `gorm:"not null;default:0"`
+	Note       string `gorm:"type:varchar(255)"`
+	CreatedAt  time.Time
+}
+
+// SignupRejection records one write refused by a signup rule.
+type SignupRejection struct {
+	ID uint `gorm:"primaryKey"`
+	// Rule is the kind of the rule, RuleID the stored rule if there is one.
+	Rule   string `gorm:"type:varchar(32);not null;index"`
+	RuleID *uint
+	Field  string `gorm:"type:varchar(32);not null"`
+	// UserID is the user being changed; empty for sign-ups.
+	UserID    *uint
+	Username  string    `gorm:"type:varchar(255)"`
+	Email     string    `gorm:"type:varchar(255)"`
+	ClientIP  string    `gorm:"type:varchar(45)"`
+	RequestID string    `gorm:"type:varchar(64)"`
+	CreatedAt time.Time `gorm:"index"`
+}
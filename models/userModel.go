@@ -1,6 +1,12 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
@@ -9,4 +15,50 @@ type User struct {
 	Bio         string `gorm:"type:text" json:"bio"`
 	Gender      string `gorm:"type:varchar(16)" json:"gender"`
 	Nationality string `gorm:"type:varchar(64)" json:"nationality"`
+	// Version is bumped on every update and backs the ETag used for optimistic locking.
+	Version uint `gorm:"not null;default:1" json:"version"`
+	// UsernameCanonical and EmailCanonical hold the identity package's canonical
+	// forms; their unique indexes make usernames and emails case-insensitive.
+	UsernameCanonical string `gorm:"type:varchar(64);uniqueIndex:idx_users_username_canonical" json:"-"`
+	EmailCanonical    string `gorm:"type:varchar(128);uniqueIndex:idx_users_email_canonical" json:"-"`
+	// ChangeSeq is the change sequence number of the user's latest create,
+	// update, delete or restore; the sync feed pages by it.
+	ChangeSeq uint64 `gorm:"not null;default:0;index" json:"-"`
+	// PasswordHash is the argon2id hash of the user's password, empty until
+	// one is set.
+	PasswordHash string `gorm:"type:varchar(255)" json:"-"`
+	// EmailVerified is set once the user opened the link mailed to Email; a
+	// new email starts unverified again.
+	EmailVerified   bool       `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"-"`
+	// ModerationStatus says whether Bio may be shown: approved, or pending
+	// review because the moderation checks flagged it, or rejected by an admin.
+	ModerationStatus string `gorm:"type:varchar(16);not null;default:approved;index" json:"moderation_status"`
+	// ModerationFlags lists the checks the bio failed, comma separated.
+	ModerationFlags string `gorm:"type:varchar(64)" json:"-"`
+}
+
+// Bio moderation statuses.
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+// SetCanonical fills the canonical identity columns from Username and Email.
+func (u *User) SetCanonical() {
+	u.UsernameCanonical = identity.Username(u.Username)
+	u.EmailCanonical = identity.Email(u.Email)
+}
+
+// BeforeCreate keeps the canonical columns in sync for every insert, including
+// the seeders. Updates go through column maps and set them explicitly.
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	u.SetCanonical()
+	return nil
+}
+
+// ETag identifies this revision of the user for conditional requests.
+func (u User) ETag() string {
+	return fmt.Sprintf(`"%d.%d"`, u.ID, u.Version)
 }
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// WebhookSubscription is an endpoint that receives user lifecycle events.
+type WebhookSubscription struct {
+	ID  uint   `gorm:"primaryKey"`
+	URL string `gorm:"type:varchar(2048);not null"`
+	// Secret signs every delivery (HMAC-SHA256).
+	Secret string `gorm:"type:varchar(128);not null"`
+	// Events is a comma separated list of event types, or "*" for all of them.
+	Events    string `gorm:"type:varchar(255);not null"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OutboxEvent is a user lifecycle event written in the same transaction as the
+// change it describes. The webhook dispatcher fans it out to the matching
+// subscriptions and sets DispatchedAt.
+type OutboxEvent struct {
+	ID     uint   `gorm:"primaryKey"`
+	Type   string `gorm:"type:varchar(64);not null"`
+	UserID uint   `gorm:"not null;index"`
+	// Payload is the JSON body delivered to subscribers.
+	Payload      string `gorm:"type:text;not null"`
+	CreatedAt    time.Time
+	DispatchedAt *time.Time `gorm:"index"`
+}
+
+// Webhook delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+	// DeliveryDropped deliveries were not sent because their subscription
+	// was deactivated; redelivering them sends them again.
+	DeliveryDropped = "dropped"
+)
+
+// WebhookDelivery is one event sent (or to be sent) to one subscription.
+type WebhookDelivery struct {
+	ID             uint      `gorm:"primaryKey"`
+	SubscriptionID uint      `gorm:"not null;index"`
+	EventID        uint      `gorm:"not null;index"`
+	Status         string    `gorm:"type:varchar(16);not null;index"`
+	Attempts       int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastStatusCode int
+	LastError      string `gorm:"type:text"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Event          OutboxEvent `gorm:"foreignKey:EventID"`
+}
@@ -0,0 +1,230 @@
+// Package moderation flags free text, such as a bio, that should be looked at
+// by a person before everyone can read it: words from the English and Persian
+// wordlists, links, phone numbers and long runs of one character.
+package moderation
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/textnorm"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Flags reported by Check, in the order they are checked. They are part of the
+// API contract and double as the names in MODERATION_CHECKS.
+const (
+	FlagWordlist      = "wordlist"
+	FlagLink          = "link"
+	FlagPhone         = "phone"
+	FlagRepeatedChars = "repeated_chars"
+)
+
+// AllChecks are the checks run by default.
+var AllChecks = []string{FlagWordlist, FlagLink, FlagPhone, FlagRepeatedChars}
+
+// Config is the moderation setup, read once from the environment:
+// MODERATION_CHECKS (comma separated flags, or "none"), MODERATION_WORDLISTS
+// (comma separated files, one word or phrase per line), MODERATION_MAX_REPEAT
+// and MODERATION_HIDE_UNAPPROVED.
+type Config struct {
+	Checks map[string]bool
+	// Words are the wordlist entries in the folded form Check compares.
+	Words []string
+	// MaxRepeat is the longest run of one character that is not flagged.
+	MaxRepeat int
+	// HideUnapproved hides the bios that are not approved from everyone but
+	// admins and the users themselves.
+	HideUnapproved bool
+}
+
+var (
+	configOnce sync.Once
+	config     Config
+)
+
+// Current returns the configuration loaded from the environment.
+func Current() Config {
+	configOnce.Do(func() {
+		config = Config{
+			Checks:         map[string]bool{},
+			MaxRepeat:      envInt("MODERATION_MAX_REPEAT", 5),
+			HideUnapproved: envBool("MODERATION_HIDE_UNAPPROVED"),
+		}
+		checks := strings.TrimSpace(os.Getenv("MODERATION_CHECKS"))
+		if checks == "" {
+			checks = strings.Join(AllChecks, ",")
+		}
+		for _, name := range strings.Split(checks, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch {
+			case name == "" || name == "none":
+			case contains(AllChecks, name):
+				config.Checks[name] = true
+			default:
+				log.Printf("Warning: ignoring unknown moderation check %q", name)
+			}
+		}
+		files := os.Getenv("MODERATION_WORDLISTS")
+		if files == "" {
+			files = "data/moderation/en.txt,data/moderation/fa.txt"
+		}
+		for _, file := range strings.Split(files, ",") {
+			if file = strings.TrimSpace(file); file == "" {
+				continue
+			}
+			words, err := readWordlist(file)
+			if err != nil {
+				log.Printf("Warning: moderation wordlist %s: %v", file, err)
+				continue
+			}
+			config.Words = append(config.Words, words...)
+		}
+	})
+	return config
+}
+
+// Check returns the flags text raises under the current configuration.
+func Check(text string) []string {
+	return Current().Check(text)
+}
+
+var (
+	linkPattern  = regexp.MustCompile(`(?:https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*\.(?:com|net|org|info|biz|io|co|me|ir|ru|xyz|top|site|online|link|click|app|shop|live)\b|\bt\.me/`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+)
+
+// Check returns the flags text raises under c. Words and phrases match whole
+// words, regardless of case and of the Arabic or Persian spelling; a phone
+// number is a run of at least 9 digits, separators allowed.
+func (c Config) Check(text string) []string {
+	folded := fold(text)
+	var flags []string
+	if c.Checks[FlagWordlist] && len(c.Words) > 0 {
+		padded := " " + strings.Join(words(folded), " ") + " "
+		for _, w := range c.Words {
+			if strings.Contains(padded, " "+w+" ") {
+				flags = append(flags, FlagWordlist)
+				break
+			}
+		}
+	}
+	if c.Checks[FlagLink] && linkPattern.MatchString(folded) {
+		flags = append(flags, FlagLink)
+	}
+	if c.Checks[FlagPhone] {
+		for _, m := range phonePattern.FindAllString(folded, -1) {
+			if countDigits(m) >= 9 {
+				flags = append(flags, FlagPhone)
+				break
+			}
+		}
+	}
+	if c.Checks[FlagRepeatedChars] && longestRun(folded) > c.MaxRepeat {
+		flags = append(flags, FlagRepeatedChars)
+	}
+	return flags
+}
+
+// fold applies NFKC, unifies Arabic and Persian letters and digits, drops
+// zero-width joiners and lowercases.
+func fold(s string) string {
+	return strings.ToLower(textnorm.Compact(norm.NFKC.String(s)))
+}
+
+// words splits folded text into words.
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// longestRun is the length of the longest run of one character, not counting
+// whitespace.
+func longestRun(s string) int {
+	longest, run := 0, 0
+	var prev rune
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			run, prev = 0, 0
+			continue
+		}
+		if r == prev {
+			run++
+		} else {
+			run, prev = 1, r
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// readWordlist reads one word or phrase per line, skipping blank lines and
+// lines starting with #, in the folded form Check compares.
+func readWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if w := strings.Join(words(fold(line)), " "); w != "" {
+			out = append(out, w)
+		}
+	}
+	return out, scanner.Err()
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: ignoring invalid %s=%q", key, v)
+		return fallback
+	}
+	return n
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
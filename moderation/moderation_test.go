@@ -0,0 +1,44 @@
+package moderation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	c := Config{
+		Checks:    map[string]bool{FlagWordlist: true, FlagLink: true, FlagPhone: true, FlagRepeatedChars: true},
+		Words:     []string{"casino", "free money", "شرطبندی"},
+		MaxRepeat: 5,
+	}
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"Backend developer from Tehran, born 1990.", nil},
+		{"Visit my CASINO tonight", []string{FlagWordlist}},
+		{"casinos are not the word casino", []string{FlagWordlist}},
+		{"casinoroyale fan", nil},
+		{"get FREE   money now", []string{FlagWordlist}},
+		{"سایت شرط‌بندی معتبر", []string{FlagWordlist}},
+		{"see https://example.org/x", []string{FlagLink}},
+		{"shop at deals.xyz", []string{FlagLink}},
+		{"join t.me/channel", []string{FlagLink}},
+		{"call +98 912 123 4567", []string{FlagPhone}},
+		{"تماس ۰۹۱۲۱۲۳۴۵۶۷", []string{FlagPhone}},
+		{"years 2019-2024", nil},
+		{"sooooo cool", nil},
+		{"soooooo cool!!!!!!", []string{FlagRepeatedChars}},
+		{"free money at www.win.com", []string{FlagWordlist, FlagLink}},
+	}
+	for _, tc := range cases {
+		if got := c.Check(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Check(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+
+	off := Config{Checks: map[string]bool{}, Words: c.Words, MaxRepeat: 5}
+	if got := off.Check("casino https://example.org"); got != nil {
+		t.Errorf("Check with no checks = %v, want none", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/amirkhgraphic/go-arcaptcha-service/initializers"
 	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/services"
 )
 
 func init() {
@@ -15,7 +16,7 @@ func init() {
 func main() {
 	sampleUsers := []models.User{
 		{Username: "alice", Email: "alice@example.com", Bio: "Product manager and demo user.", Gender: "female", Nationality: "US"},
-		{Username: "bob", Email: "bob@example.com", Bio: "Security engineer who loves Go.", Gender: "male", Nationality: "UK"},
+		{Username: "bob", Email: "bob@example.com", Bio: "Security engineer who loves Go.", Gender: "male", Nationality: "GB"},
 		{Username: "carol", Email: "carol@example.com", Bio: "QA specialist focusing on APIs.", Gender: "female", Nationality: "CA"},
 		{Username: "dave", Email: "dave@example.com", Bio: "Data analyst testing pagination.", Gender: "male", Nationality: "IR"},
 		{Username: "erin", Email: "erin@example.com", Bio: "Designer checking search/filter UX.", Gender: "female", Nationality: "IR"},
@@ -31,14 +32,21 @@ func main() {
 		{Username: "oscar", Email: "oscar@example.com", Bio: "Cloud architect.", Gender: "male", Nationality: "MX"},
 		{Username: "peggy", Email: "peggy@example.com", Bio: "Data scientist.", Gender: "female", Nationality: "AU"},
 		{Username: "quentin", Email: "quentin@example.com", Bio: "QA automation.", Gender: "male", Nationality: "CA"},
-		{Username: "ruth", Email: "ruth@example.com", Bio: "Product designer.", Gender: "female", Nationality: "UK"},
+		{Username: "ruth", Email: "ruth@example.com", Bio: "Product designer.", Gender: "female", Nationality: "GB"},
 		{Username: "sam", Email: "sam@example.com", Bio: "API integrator.", Gender: "male", Nationality: "ZA"},
 		{Username: "tina", Email: "tina@example.com", Bio: "Security analyst.", Gender: "female", Nationality: "IN"},
 	}
 
 	for _, u := range sampleUsers {
-		if err := initializers.DB.Where("email = ?", u.Email).FirstOrCreate(&u).Error; err != nil {
-			log.Fatalf("failed seeding user %s: %v", u.Email, err)
+		res := initializers.DB.Where("email = ?", u.Email).FirstOrCreate(&u)
+		if res.Error != nil {
+			log.Fatalf("failed seeding user %s: %v", u.Email, res.Error)
+		}
+		if res.RowsAffected > 0 {
+			err := services.RecordUserRevision(initializers.DB, models.RevisionCreate, models.User{}, u, services.RevisionContext{Actor: "seed"})
+			if err != nil {
+				log.Fatalf("failed recording revision for %s: %v", u.Email, err)
+			}
 		}
 	}
 
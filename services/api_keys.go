@@ -0,0 +1,92 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix starts every API key, which tells them apart from JWTs.
+const apiKeyPrefix = "ak_"
+
+// ErrInvalidAPIKey means the key is unknown, revoked or expired.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// IsAPIKey reports whether a bearer credential has the shape of an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// hashToken is the stored form of a random secret such as an API key or a
+// reset token. They are random, so a plain SHA-256 is enough to make a leaked
+// table useless.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key for role and returns it together with the key
+// itself, which is not kept anywhere.
+func CreateAPIKey(db *gorm.DB, name, role string, userID *uint, expiresAt *time.Time) (models.APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return models.APIKey{}, "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	record := models.APIKey{
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashToken(key),
+		Role:      role,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return models.APIKey{}, "", err
+	}
+	return record, key, nil
+}
+
+// AuthenticateAPIKey looks key up and records that it was used. last_used_at
+// is written at most once a minute per key so reads stay cheap.
+func AuthenticateAPIKey(db *gorm.DB, key string) (models.APIKey, error) {
+	var record models.APIKey
+	err := db.Where("hash = ?", hashToken(key)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return record, err
+	}
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !now.Before(*record.ExpiresAt)) {
+		return record, ErrInvalidAPIKey
+	}
+	err = db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", record.ID, now.Add(-time.Minute)).
+		UpdateColumn("last_used_at", now).Error
+	return record, err
+}
+
+// RevokeAPIKey stops key id from authenticating. The row is kept so audit
+// records naming it can still be traced; revoking twice keeps the first time.
+func RevokeAPIKey(db *gorm.DB, id uint) (models.APIKey, error) {
+	var record models.APIKey
+	if err := db.First(&record, id).Error; err != nil {
+		return record, err
+	}
+	if record.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&record).UpdateColumn("revoked_at", now).Error; err != nil {
+			return record, err
+		}
+		record.RevokedAt = &now
+	}
+	return record, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// auditedFields are the user fields revisions diff and snapshot.
+var auditedFields = []struct {
+	Name string
+	Get  func(models.User) string
+}{
+	{"username", func(u models.User) string { return u.Username }},
+	{"email", func(u models.User) string { return u.Email }},
+	{"bio", func(u models.User) string { return u.Bio }},
+	{"gender", func(u models.User) string { return u.Gender }},
+	{"nationality", func(u models.User) string { return u.Nationality }},
+	{"email_verified", func(u models.User) string { return strconv.FormatBool(u.EmailVerified) }},
+	{"moderation_status", func(u models.User) string { return u.ModerationStatus }},
+}
+
+// FieldChange is the before/after value of one field in a revision.
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RevisionContext says who made a change and in which request.
+type RevisionContext struct {
+	Actor      string
+	RequestID  string
+	RevertedTo *uint
+}
+
+// RecordUserRevision appends a revision for the change from before to after,
+// moves the user to the next change sequence number and writes the matching
+// webhook event to the outbox. Call it with the transaction
+// of the write so all of them commit (or roll back) together. before is the
+// zero User for creates.
+func RecordUserRevision(tx *gorm.DB, action string, before, after models.User, ctx RevisionContext) error {
+	changes := map[string]FieldChange{}
+	snapshot := map[string]string{}
+	var changed []string
+	for _, f := range auditedFields {
+		from, to := f.Get(before), f.Get(after)
+		snapshot[f.Name] = to
+		if from != to {
+			changes[f.Name] = FieldChange{From: from, To: to}
+			changed = append(changed, f.Name)
+		}
+	}
+	rawChanges, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	rawSnapshot, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	rev := models.UserRevision{
+		UserID:     after.ID,
+		Version:    after.Version,
+		Action:     action,
+		Actor:      ctx.Actor,
+		RequestID:  ctx.RequestID,
+		Changes:    string(rawChanges),
+		Snapshot:   string(rawSnapshot),
+		RevertedTo: ctx.RevertedTo,
+		CreatedAt:  time.Now(),
+	}
+	if len(changed) > 0 {
+		rev.ChangedFields = "," + strings.Join(changed, ",") + ","
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return err
+	}
+	eventType, ok := revisionEvents[action]
+	if !ok {
+		return nil
+	}
+	seq, err := NextChangeSeq(tx, UserChangeSequence)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&models.User{}).Unscoped().Where("id = ?", after.ID).UpdateColumn("change_seq", seq).Error
+	if err != nil {
+		return err
+	}
+	return enqueueUserEvent(tx, eventType, after, rev, changes)
+}
+
+// RevisionChanges decodes the field-level diff of rev.
+func RevisionChanges(rev models.UserRevision) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	_ = json.Unmarshal([]byte(rev.Changes), &changes)
+	return changes
+}
+
+// RevisionSnapshot decodes the editable fields stored with rev.
+func RevisionSnapshot(rev models.UserRevision) (map[string]string, error) {
+	snapshot := map[string]string{}
+	err := json.Unmarshal([]byte(rev.Snapshot), &snapshot)
+	return snapshot, err
+}
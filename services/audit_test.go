@@ -0,0 +1,121 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+func TestRecordUserRevision(t *testing.T) {
+	db := testDB(t, &models.User{}, &models.UserRevision{}, &models.OutboxEvent{}, &models.ChangeSequence{})
+	created := models.User{Username: "alice", Email: "alice@example.com", Gender: "female", Version: 1,
+		ModerationStatus: models.ModerationApproved}
+	created.ID = 7
+	if err := db.Create(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	updated := created
+	updated.Email, updated.Bio, updated.Gender, updated.Version = "alice@example.org", "hello", "", 2
+
+	steps := []struct {
+		action        string
+		before, after models.User
+		ctx           RevisionContext
+		changedFields string
+		changes       map[string]FieldChange
+		event         string
+	}{
+		{models.RevisionCreate, models.User{}, created, RevisionContext{Actor: "ip:127.0.0.1", RequestID: "req-1"},
+			",username,email,gender,moderation_status,",
+			map[string]FieldChange{"username": {"", "alice"}, "email": {"", "alice@example.com"}, "gender": {"", "female"},
+				"moderation_status": {"", models.ModerationApproved}},
+			EventUserCreated},
+		{models.RevisionUpdate, created, updated, RevisionContext{Actor: "ip:127.0.0.1"},
+			",email,bio,gender,",
+			map[string]FieldChange{"email": {"alice@example.com", "alice@example.org"}, "bio": {"", "hello"}, "gender": {"female", ""}},
+			EventUserUpdated},
+		// A delete changes no field.
+		{models.RevisionDelete, updated, updated, RevisionContext{}, "", map[string]FieldChange{}, EventUserDeleted},
+		// A baseline describes no change and publishes nothing.
+		{models.RevisionBaseline, updated, updated, RevisionContext{}, "", map[string]FieldChange{}, ""},
+	}
+	var lastEvent uint
+	var lastSeq uint64
+	for _, step := range steps {
+		if err := RecordUserRevision(db, step.action, step.before, step.after, step.ctx); err != nil {
+			t.Fatalf("%s: RecordUserRevision() error = %v", step.action, err)
+		}
+		var rev models.UserRevision
+		if err := db.Order("id desc").First(&rev).Error; err != nil {
+			t.Fatal(err)
+		}
+		if rev.UserID != 7 || rev.Version != step.after.Version || rev.Action != step.action ||
+			rev.Actor != step.ctx.Actor || rev.RequestID != step.ctx.RequestID {
+			t.Errorf("%s: revision = %+v", step.action, rev)
+		}
+		if rev.ChangedFields != step.changedFields {
+			t.Errorf("%s: ChangedFields = %q, want %q", step.action, rev.ChangedFields, step.changedFields)
+		}
+		changes := RevisionChanges(rev)
+		if len(changes) != len(step.changes) {
+			t.Errorf("%s: changes = %v, want %v", step.action, changes, step.changes)
+		}
+		for field, want := range step.changes {
+			if changes[field] != want {
+				t.Errorf("%s: change of %s = %+v, want %+v", step.action, field, changes[field], want)
+			}
+		}
+
+		// The matching event is written to the outbox with the revision.
+		var events []models.OutboxEvent
+		if err := db.Where("id > ?", lastEvent).Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case step.event == "" && len(events) != 0:
+			t.Errorf("%s: enqueued %d events, want none", step.action, len(events))
+		case step.event != "" && (len(events) != 1 || events[0].Type != step.event || events[0].UserID != 7):
+			t.Errorf("%s: enqueued %+v, want one %s event", step.action, events, step.event)
+		}
+		for _, e := range events {
+			lastEvent = e.ID
+		}
+
+		// Every published change moves the user up the sync feed.
+		var user models.User
+		if err := db.First(&user, 7).Error; err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case step.event == "" && user.ChangeSeq != lastSeq:
+			t.Errorf("%s: change_seq = %d, want %d", step.action, user.ChangeSeq, lastSeq)
+		case step.event != "" && user.ChangeSeq <= lastSeq:
+			t.Errorf("%s: change_seq = %d, want more than %d", step.action, user.ChangeSeq, lastSeq)
+		}
+		lastSeq = user.ChangeSeq
+
+		// The snapshot holds every editable field after the change.
+		snapshot, err := RevisionSnapshot(rev)
+		if err != nil {
+			t.Fatalf("%s: RevisionSnapshot() error = %v", step.action, err)
+		}
+		want := map[string]string{
+			"username":          step.after.Username,
+			"email":             step.after.Email,
+			"bio":               step.after.Bio,
+			"gender":            step.after.Gender,
+			"nationality":       step.after.Nationality,
+			"email_verified":    strconv.FormatBool(step.after.EmailVerified),
+			"moderation_status": step.after.ModerationStatus,
+		}
+		if len(snapshot) != len(want) {
+			t.Errorf("%s: snapshot = %v, want %v", step.action, snapshot, want)
+		}
+		for field, value := range want {
+			if got, ok := snapshot[field]; !ok || got != value {
+				t.Errorf("%s: snapshot[%s] = %q, want %q", step.action, field, got, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// UserChangeSequence names the counter behind users.change_seq.
+const UserChangeSequence = "users"
+
+// NextChangeSeq takes the next value of the named sequence in tx. The UPDATE
+// locks the counter row until tx ends, so a later value is never committed
+// before an earlier one and readers paging by it cannot miss a change.
+func NextChangeSeq(tx *gorm.DB, name string) (uint64, error) {
+	res := tx.Model(&models.ChangeSequence{}).Where("name = ?", name).UpdateColumn("value", gorm.Expr("value + 1"))
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		if err := tx.Create(&models.ChangeSequence{Name: name, Value: 1}).Error; err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+	var seq models.ChangeSequence
+	if err := tx.Where("name = ?", name).Take(&seq).Error; err != nil {
+		return 0, err
+	}
+	return seq.Value, nil
+}
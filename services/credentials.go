@@ -0,0 +1,192 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	"github.com/amirkhgraphic/go-arcaptcha-service/mailer"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidResetToken means a reset token is unknown, used or expired.
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// Mailer sends password reset (and other account) mail; main replaces the
+// default with the one configured by mailer.FromEnv.
+var Mailer mailer.Mailer = mailer.LogMailer{From: "no-reply@localhost"}
+
+// LoginGuard counts failed logins per account and per client. Once either has
+// failed Threshold times within Window, logins for it need a captcha.
+type LoginGuard struct {
+	Threshold int
+	Window    time.Duration
+}
+
+// NewLoginGuard reads LOGIN_CAPTCHA_AFTER (default 3) and
+// LOGIN_FAILURE_WINDOW (default 15m).
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		Threshold: envPositiveInt("LOGIN_CAPTCHA_AFTER", 3),
+		Window:    envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+	}
+}
+
+// AccountKey is the failure counter key of a user.
+func AccountKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// LoginNameKey is the failure counter key of a login name that matches no
+// user, so unknown names are throttled like real accounts.
+func LoginNameKey(name string) string {
+	return "login:" + name
+}
+
+// ClientKey is the failure counter key of a client address.
+func ClientKey(ip string) string {
+	return "ip:" + ip
+}
+
+// NeedsCaptcha reports whether any of keys has reached the threshold.
+func (g *LoginGuard) NeedsCaptcha(db *gorm.DB, keys ...string) (bool, error) {
+	var count int64
+	err := db.Model(&models.LoginFailure{}).Where(map[string]interface{}{"key": keys}).
+		Where("failures >= ? AND last_failed_at >= ?", g.Threshold, time.Now().Add(-g.Window)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RecordFailure counts a failed login against every key. A counter whose last
+// failure is older than Window starts over.
+func (g *LoginGuard) RecordFailure(db *gorm.DB, keys ...string) error {
+	now := time.Now()
+	cutoff := now.Add(-g.Window)
+	for _, key := range keys {
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "failures"}, Value: gorm.Expr("CASE WHEN login_failures.last_failed_at >= ? THEN login_failures.failures + 1 ELSE 1 END", cutoff)},
+				{Column: clause.Column{Name: "last_failed_at"}, Value: now},
+			},
+		}).Create(&models.LoginFailure{Key: key, Failures: 1, LastFailedAt: now}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear forgets the failures of keys, e.g. after a successful login.
+func (g *LoginGuard) Clear(db *gorm.DB, keys ...string) error {
+	return db.Where(map[string]interface{}{"key": keys}).Delete(&models.LoginFailure{}).Error
+}
+
+// Logins is set by main once the environment is loaded.
+var Logins = &LoginGuard{}
+
+// SetPassword hashes password and stores it for user id.
+func SetPassword(db *gorm.DB, userID uint, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("password_hash", hash).Error
+}
+
+// IssuePasswordReset creates a reset token for user id, valid for
+// PASSWORD_RESET_TTL (default 1h), and returns it; only its hash is stored.
+func IssuePasswordReset(db *gorm.DB, userID uint) (string, error) {
+	ttl := envDuration("PASSWORD_RESET_TTL", time.Hour)
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	record := models.PasswordResetToken{UserID: userID, TokenHash: hashToken(token), ExpiresAt: time.Now().Add(ttl)}
+	if err := db.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword sets a new password with a reset token. The token, and every
+// other outstanding token of the user, can not be used again, and every
+// session of the user is revoked. It returns the user id, or
+// ErrInvalidResetToken.
+func ResetPassword(db *gorm.DB, token, password string) (uint, error) {
+	var userID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		// Claiming the row by its used_at makes a concurrent second use lose.
+		res := tx.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", record.UserID).
+			UpdateColumn("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		userID = record.UserID
+		if err := SetPassword(tx, userID, password); err != nil {
+			return err
+		}
+		_, err = Sessions.RevokeAll(tx, userID, 0, models.SessionPasswordReset)
+		return err
+	})
+	return userID, err
+}
+
+// TokenIssuer signs the service's own access tokens after a login.
+type TokenIssuer struct {
+	Verifier *auth.JWTVerifier
+	TTL      time.Duration
+}
+
+// NewTokenIssuer signs with verifier's JWT_SECRET for AUTH_TOKEN_TTL (default
+// 15m); sessions are kept alive with refresh tokens instead.
+func NewTokenIssuer(verifier *auth.JWTVerifier) *TokenIssuer {
+	return &TokenIssuer{Verifier: verifier, TTL: envDuration("AUTH_TOKEN_TTL", 15*time.Minute)}
+}
+
+// Tokens is set by main once the JWT configuration is loaded.
+var Tokens = &TokenIssuer{}
+
+// Enabled reports whether tokens can be signed, i.e. JWT_SECRET is set.
+func (t *TokenIssuer) Enabled() bool {
+	return t.Verifier != nil && len(t.Verifier.Secret) > 0
+}
+
+// Issue returns an access token for user in session, with the self role linked
+// to that user, and its expiry. The token never outlives the session.
+// It fails with auth.ErrJWTDisabled without a JWT_SECRET.
+func (t *TokenIssuer) Issue(user models.User, session models.UserSession) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(t.TTL)
+	if session.ExpiresAt.Before(expires) {
+		expires = session.ExpiresAt
+	}
+	id, sid := user.ID, session.ID
+	token, err := t.Verifier.Sign(auth.Claims{
+		Subject:   "user:" + strconv.FormatUint(uint64(user.ID), 10),
+		Role:      auth.RoleSelf,
+		UserID:    &id,
+		SessionID: &sid,
+		IssuedAt:  auth.NumericDate(now),
+		ExpiresAt: auth.NumericDate(expires),
+	})
+	return token, expires, err
+}
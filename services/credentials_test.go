@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/auth"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+func TestLoginGuard(t *testing.T) {
+	db := testDB(t, &models.LoginFailure{})
+	g := &LoginGuard{Threshold: 3, Window: 15 * time.Minute}
+	account, client := AccountKey(1), ClientKey("192.0.2.1")
+
+	needs := func(keys ...string) bool {
+		t.Helper()
+		need, err := g.NeedsCaptcha(db, keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return need
+	}
+	fail := func(keys ...string) {
+		t.Helper()
+		if err := g.RecordFailure(db, keys...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failures := func(key string) int {
+		t.Helper()
+		var row models.LoginFailure
+		if err := db.First(&row, "key = ?", key).Error; err != nil {
+			t.Fatal(err)
+		}
+		return row.Failures
+	}
+	// age moves the last failure of key d into the past.
+	age := func(key string, d time.Duration) {
+		t.Helper()
+		err := db.Model(&models.LoginFailure{}).Where("key = ?", key).
+			Update("last_failed_at", time.Now().Add(-d)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fail(account, client)
+	fail(account, client)
+	if needs(account, client) {
+		t.Fatal("NeedsCaptcha after 2 failures = true, want false")
+	}
+	fail(account)
+	if !needs(account) || !needs(ClientKey("203.0.113.9"), account) {
+		t.Error("NeedsCaptcha(account) after 3 failures = false, want true")
+	}
+	if needs(client) {
+		t.Error("NeedsCaptcha(client) after 2 failures = true, want false")
+	}
+	if needs(AccountKey(2)) {
+		t.Error("NeedsCaptcha(other account) = true, want false")
+	}
+
+	// Failures older than the window no longer count, and the next one
+	// starts the counter over.
+	age(account, 16*time.Minute)
+	if needs(account) {
+		t.Error("NeedsCaptcha after the window = true, want false")
+	}
+	fail(account)
+	if got := failures(account); got != 1 {
+		t.Errorf("failures after the window = %d, want 1", got)
+	}
+	age(client, 14*time.Minute)
+	fail(client)
+	if got := failures(client); got != 3 {
+		t.Errorf("failures within the window = %d, want 3", got)
+	}
+	if !needs(client) {
+		t.Error("NeedsCaptcha(client) after 3 failures = false, want true")
+	}
+
+	if err := g.Clear(db, client); err != nil {
+		t.Fatal(err)
+	}
+	if needs(client) {
+		t.Error("NeedsCaptcha after Clear = true, want false")
+	}
+	if got := failures(account); got != 1 {
+		t.Errorf("Clear(client) touched the account: failures = %d, want 1", got)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	db := testDB(t, &models.User{}, &models.PasswordResetToken{}, &models.UserSession{}, &models.RefreshToken{})
+	user := models.User{Username: "alice", Email: "alice@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPassword(db, user.ID, "old password"); err != nil {
+		t.Fatal(err)
+	}
+	issue := func() string {
+		t.Helper()
+		token, err := IssuePasswordReset(db, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	verify := func(password string) bool {
+		t.Helper()
+		var u models.User
+		if err := db.First(&u, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		ok, _ := auth.VerifyPassword(u.PasswordHash, password)
+		return ok
+	}
+
+	session, err := Sessions.Start(db, user.ID, SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := issue(), issue()
+	if first == second {
+		t.Fatal("two reset tokens are equal")
+	}
+	var stored models.PasswordResetToken
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash == first {
+		t.Error("the reset token is stored in the clear")
+	}
+
+	if _, err := ResetPassword(db, "unknown", "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidResetToken", err)
+	}
+	id, err := ResetPassword(db, first, "new password")
+	if err != nil || id != user.ID {
+		t.Fatalf("ResetPassword = %d, %v, want %d, nil", id, err, user.ID)
+	}
+	if !verify("new password") || verify("old password") {
+		t.Error("the password was not replaced")
+	}
+	if active, _ := Sessions.Active(db, session.Session.ID); active {
+		t.Error("the session survived the reset")
+	}
+
+	// Neither the used token nor the other outstanding one works again.
+	for name, token := range map[string]string{"reused": first, "outstanding": second} {
+		if _, err := ResetPassword(db, token, "third password"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("%s token: err = %v, want ErrInvalidResetToken", name, err)
+		}
+	}
+	if !verify("new password") {
+		t.Error("a rejected token changed the password")
+	}
+
+	expired := issue()
+	if err := db.Model(&models.PasswordResetToken{}).Where("used_at IS NULL").
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResetPassword(db, expired, "third password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidResetToken", err)
+	}
+}
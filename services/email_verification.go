@@ -0,0 +1,123 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+// ErrInvalidVerificationToken means an email verification token was not
+// signed by this service, is malformed or has expired.
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// EmailVerifier signs the tokens of email verification links. A token names
+// the user and the canonical email it was sent to, so it stops working once
+// the user changes the email; nothing about it is stored.
+type EmailVerifier struct {
+	Secret []byte
+	TTL    time.Duration
+	// PerClient limits resend requests per client address; PerUser limits the
+	// mails actually sent to one user.
+	PerClient RateLimiter
+	PerUser   RateLimiter
+}
+
+// NewEmailVerifier signs with EMAIL_VERIFICATION_SECRET, or JWT_SECRET when
+// that is unset, and reads EMAIL_VERIFICATION_TTL (default 24h),
+// EMAIL_VERIFICATION_RESEND_LIMIT (default 5 per client and
+// EMAIL_VERIFICATION_RESEND_WINDOW, default 1h) and
+// EMAIL_VERIFICATION_RESEND_COOLDOWN (default 1m between mails to one user).
+// Without either secret it signs with a random one, so links break on restart.
+func NewEmailVerifier() *EmailVerifier {
+	secret := os.Getenv("EMAIL_VERIFICATION_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	v := &EmailVerifier{
+		Secret: []byte(secret),
+		TTL:    envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		PerClient: RateLimiter{
+			Limit:  envPositiveInt("EMAIL_VERIFICATION_RESEND_LIMIT", 5),
+			Window: envDuration("EMAIL_VERIFICATION_RESEND_WINDOW", time.Hour),
+		},
+		PerUser: RateLimiter{Limit: 1, Window: envDuration("EMAIL_VERIFICATION_RESEND_COOLDOWN", time.Minute)},
+	}
+	if len(v.Secret) == 0 {
+		log.Printf("Warning: EMAIL_VERIFICATION_SECRET and JWT_SECRET are empty, verification links will not survive a restart")
+		v.Secret = make([]byte, 32)
+		if _, err := rand.Read(v.Secret); err != nil {
+			panic(err)
+		}
+	}
+	return v
+}
+
+// EmailVerification is set by main once .env is loaded.
+var EmailVerification = &EmailVerifier{}
+
+// Token returns a verification token for the current email of user.
+func (v *EmailVerifier) Token(user models.User) string {
+	expires := time.Now().Add(v.TTL).Truncate(time.Second)
+	payload := strings.Join([]string{
+		strconv.FormatUint(uint64(user.ID), 10),
+		strconv.FormatInt(expires.Unix(), 10),
+		user.EmailCanonical,
+	}, ":")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(v.sign(encoded))
+}
+
+// Parse checks token and returns the user id and the canonical email it was
+// issued for, or ErrInvalidVerificationToken.
+func (v *EmailVerifier) Parse(token string) (uint, string, error) {
+	encoded, rawSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(rawSig)
+	if err != nil || !hmac.Equal(sig, v.sign(encoded)) {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	parts := strings.SplitN(string(payload), ":", 3)
+	if len(parts) != 3 {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(expires, 0)) {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	return uint(id), parts[2], nil
+}
+
+func (v *EmailVerifier) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write([]byte("email-verification:" + encoded))
+	return mac.Sum(nil)
+}
+
+// VerificationClientKey is the resend rate limit key of a client address.
+func VerificationClientKey(ip string) string {
+	return "verify:ip:" + ip
+}
+
+// VerificationUserKey is the resend rate limit key of a user.
+func VerificationUserKey(userID uint) string {
+	return "verify:user:" + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	v := &EmailVerifier{Secret: []byte("secret"), TTL: time.Hour}
+	user := models.User{EmailCanonical: "alice@example.com"}
+	user.ID = 7
+
+	token := v.Token(user)
+	id, email, err := v.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse(Token()) failed: %v", err)
+	}
+	if id != 7 || email != "alice@example.com" {
+		t.Errorf("Parse(Token()) = %d, %q, want 7, %q", id, email, "alice@example.com")
+	}
+
+	encoded, sig, _ := strings.Cut(token, ".")
+	other := &EmailVerifier{Secret: []byte("other"), TTL: time.Hour}
+	expired := &EmailVerifier{Secret: []byte("secret"), TTL: -time.Minute}
+	cases := map[string]string{
+		"empty":        "",
+		"no signature": encoded,
+		"bad payload":  "x" + encoded + "." + sig,
+		"other secret": other.Token(user),
+		"expired":      expired.Token(user),
+	}
+	for name, token := range cases {
+		if _, _, err := v.Parse(token); err != ErrInvalidVerificationToken {
+			t.Errorf("%s: Parse() error = %v, want ErrInvalidVerificationToken", name, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIdempotencyMismatch means the key was already used for a different request.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+	// ErrIdempotencyInProgress means the first request with the key has not finished yet.
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// IdempotencyStore keeps the first response to every write sent with an
+// Idempotency-Key for TTL, so retries get the same answer instead of running
+// the write (and the captcha check) again.
+type IdempotencyStore struct {
+	TTL time.Duration
+	// LockTimeout is how long an unfinished request holds its key. A process
+	// that died mid-request leaves a pending row behind; after LockTimeout a
+	// retry may take it over.
+	LockTimeout time.Duration
+}
+
+// NewIdempotencyStore reads the replay window from IDEMPOTENCY_TTL (a Go
+// duration, default 24h).
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{TTL: envDuration("IDEMPOTENCY_TTL", 24*time.Hour), LockTimeout: time.Minute}
+}
+
+// Idempotency is set by main once the environment is loaded.
+var Idempotency = &IdempotencyStore{}
+
+// Begin claims key within scope for a request with the given fingerprint. It returns the
+// stored record when the request is a retry of a finished one, nil when the
+// caller should run the request (and then Complete or Release the key), or one
+// of ErrIdempotencyMismatch and ErrIdempotencyInProgress.
+func (s *IdempotencyStore) Begin(db *gorm.DB, scope, key, fingerprint string) (*models.IdempotencyKey, error) {
+	now := time.Now()
+	if err := db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+	err := db.Where(byKey(scope, key)).Where("status = 0 AND created_at < ?", now.Add(-s.LockTimeout)).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.IdempotencyKey{Scope: scope, Key: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(s.TTL)}
+	err = db.Create(&record).Error
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, err
+	}
+
+	var existing models.IdempotencyKey
+	if err := db.Where(byKey(scope, key)).Take(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	if existing.Status == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+	return &existing, nil
+}
+
+// Complete stores the response for a key claimed with Begin.
+func (s *IdempotencyStore) Complete(db *gorm.DB, scope, key string, status int, header string, body []byte) error {
+	return db.Model(&models.IdempotencyKey{}).Where(byKey(scope, key)).Updates(map[string]interface{}{
+		"status": status,
+		"header": header,
+		"body":   body,
+	}).Error
+}
+
+// Release frees a claimed key without storing a response, so the request can be
+// retried with it.
+func (s *IdempotencyStore) Release(db *gorm.DB, scope, key string) error {
+	return db.Where(byKey(scope, key)).Where("status = 0").Delete(&models.IdempotencyKey{}).Error
+}
+
+// byKey matches one key of a scope; the map form lets gorm quote the column
+// name, which is a keyword in SQL.
+func byKey(scope, key string) map[string]interface{} {
+	return map[string]interface{}{"scope": scope, "key": key}
+}
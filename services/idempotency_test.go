@@ -0,0 +1,99 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB opens a fresh SQLite database with the given tables. It lives in a
+// file, as every pooled connection to :memory: would get its own database, and
+// logs nothing, as some tests expect failing statements.
+func testDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	db := testDB(t, &models.IdempotencyKey{})
+	s := &IdempotencyStore{TTL: time.Hour, LockTimeout: time.Minute}
+
+	// age moves the key's timestamps into the past.
+	age := func(scope, key, column string, d time.Duration) func() {
+		return func() {
+			err := db.Model(&models.IdempotencyKey{}).Where(byKey(scope, key)).
+				Update(column, time.Now().Add(-d)).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	steps := []struct {
+		name        string
+		setup       func()
+		scope       string
+		fingerprint string
+		// wantStatus is the replayed status; 0 means Begin claims the key.
+		wantStatus int
+		wantErr    error
+		after      func()
+	}{
+		{name: "first request claims", scope: "api_key:1", fingerprint: "a"},
+		{name: "retry while running", scope: "api_key:1", fingerprint: "a", wantErr: ErrIdempotencyInProgress},
+		{name: "other request while running", scope: "api_key:1", fingerprint: "b", wantErr: ErrIdempotencyMismatch},
+		{name: "other caller has its own keys", scope: "api_key:2", fingerprint: "b",
+			after: func() {
+				if err := s.Release(db, "api_key:2", "k"); err != nil {
+					t.Fatal(err)
+				}
+			}},
+		{name: "released key is claimed again", scope: "api_key:2", fingerprint: "c",
+			after: func() {
+				if err := s.Complete(db, "api_key:1", "k", 201, `{"ETag":["\"1.1\""]}`, []byte(`{"data":{}}`)); err != nil {
+					t.Fatal(err)
+				}
+			}},
+		{name: "retry replays", scope: "api_key:1", fingerprint: "a", wantStatus: 201},
+		{name: "other request after completion", scope: "api_key:1", fingerprint: "b", wantErr: ErrIdempotencyMismatch},
+		{name: "release keeps a completed key", scope: "api_key:1", fingerprint: "a", wantStatus: 201,
+			setup: func() {
+				if err := s.Release(db, "api_key:1", "k"); err != nil {
+					t.Fatal(err)
+				}
+			}},
+		{name: "expired key is claimed again", setup: age("api_key:1", "k", "expires_at", time.Second),
+			scope: "api_key:1", fingerprint: "b"},
+		{name: "abandoned key is taken over", setup: age("api_key:2", "k", "created_at", 2*time.Minute),
+			scope: "api_key:2", fingerprint: "d"},
+	}
+	for _, step := range steps {
+		if step.setup != nil {
+			step.setup()
+		}
+		record, err := s.Begin(db, step.scope, "k", step.fingerprint)
+		switch {
+		case err != step.wantErr:
+			t.Fatalf("%s: Begin() error = %v, want %v", step.name, err, step.wantErr)
+		case step.wantStatus == 0 && record != nil:
+			t.Fatalf("%s: Begin() replayed status %d, want a claim", step.name, record.Status)
+		case step.wantStatus != 0 && (record == nil || record.Status != step.wantStatus || string(record.Body) != `{"data":{}}`):
+			t.Fatalf("%s: Begin() = %+v, want the stored %d response", step.name, record, step.wantStatus)
+		}
+		if step.after != nil {
+			step.after()
+		}
+	}
+}
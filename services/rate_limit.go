@@ -0,0 +1,41 @@
+package services
+
+import (
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimiter allows Limit hits per key in fixed windows of Window. Counters
+// live in the database, so every instance of the service shares them.
+type RateLimiter struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Hit counts a hit for key and reports whether it is within the limit. When it
+// is not, it also returns how long until the window starts over.
+func (l *RateLimiter) Hit(db *gorm.DB, key string) (bool, time.Duration, error) {
+	now := time.Now()
+	cutoff := now.Add(-l.Window)
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "hits"}, Value: gorm.Expr("CASE WHEN rate_limits.window_start > ? THEN rate_limits.hits + 1 ELSE 1 END", cutoff)},
+			{Column: clause.Column{Name: "window_start"}, Value: gorm.Expr("CASE WHEN rate_limits.window_start > ? THEN rate_limits.window_start ELSE ? END", cutoff, now)},
+		},
+	}).Create(&models.RateLimit{Key: key, Hits: 1, WindowStart: now}).Error
+	if err != nil {
+		return false, 0, err
+	}
+	var counter models.RateLimit
+	if err := db.Where("key = ?", key).Take(&counter).Error; err != nil {
+		return false, 0, err
+	}
+	if counter.Hits <= l.Limit {
+		return true, 0, nil
+	}
+	return false, counter.WindowStart.Add(l.Window).Sub(now), nil
+}
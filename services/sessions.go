@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// refreshTokenPrefix starts every refresh token.
+const refreshTokenPrefix = "rt_"
+
+// sessionRetention is how long ended sessions are kept, so a leaked refresh
+// token of a revoked session is still recognised for a while before the
+// sweeper deletes it.
+const sessionRetention = 7 * 24 * time.Hour
+
+// Errors returned by SessionManager.Refresh.
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is unknown, expired or its session has ended")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session has been revoked")
+)
+
+// SessionMeta describes the device a session was started or refreshed from.
+type SessionMeta struct {
+	Device    string
+	IP        string
+	UserAgent string
+}
+
+// RefreshGrant is a session together with its newest refresh token, which is
+// only known at the moment it is issued.
+type RefreshGrant struct {
+	Session   models.UserSession
+	Token     string
+	ExpiresAt time.Time
+}
+
+// SessionManager keeps the login sessions of users and rotates their refresh
+// tokens. A session lives at most TTL; each refresh token is good for one use
+// within RefreshTTL, so an idle session ends after RefreshTTL.
+type SessionManager struct {
+	TTL           time.Duration
+	RefreshTTL    time.Duration
+	SweepInterval time.Duration
+}
+
+// NewSessionManager reads SESSION_TTL (default 720h), REFRESH_TOKEN_TTL
+// (default 336h) and SESSION_SWEEP_INTERVAL (default 10m).
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		TTL:           envDuration("SESSION_TTL", 30*24*time.Hour),
+		RefreshTTL:    envDuration("REFRESH_TOKEN_TTL", 14*24*time.Hour),
+		SweepInterval: envDuration("SESSION_SWEEP_INTERVAL", 10*time.Minute),
+	}
+}
+
+// Sessions is a shared singleton; main replaces it once .env is loaded.
+var Sessions = NewSessionManager()
+
+// Start opens a session for user id and issues its first refresh token.
+func (m *SessionManager) Start(db *gorm.DB, userID uint, meta SessionMeta) (RefreshGrant, error) {
+	var grant RefreshGrant
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.UserSession{
+			UserID:     userID,
+			Device:     truncate(meta.Device, 100),
+			IP:         truncate(meta.IP, 45),
+			UserAgent:  truncate(meta.UserAgent, 255),
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(m.TTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		grant, err = m.issueRefreshToken(tx, session)
+		return err
+	})
+	return grant, err
+}
+
+// Refresh exchanges a refresh token for a new one. Presenting a token that
+// was already exchanged revokes its session, since either the client or an
+// attacker holds a stolen copy; it then fails with ErrRefreshTokenReused.
+func (m *SessionManager) Refresh(db *gorm.DB, token string, meta SessionMeta) (RefreshGrant, error) {
+	var grant RefreshGrant
+	reused := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.RefreshToken
+		err := tx.Where("token_hash = ?", hashToken(token)).First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		var session models.UserSession
+		err = tx.First(&session, record.SessionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+		if record.UsedAt != nil {
+			reused = true
+			_, err := revokeSessions(tx.Where("id = ?", session.ID), models.SessionRefreshReuse)
+			return err
+		}
+		if !now.Before(record.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Claiming the token by its used_at makes the loser of two concurrent
+		// refreshes count as a reuse, like any other second use.
+		res := tx.Model(&models.RefreshToken{}).Where("id = ? AND used_at IS NULL", record.ID).UpdateColumn("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = true
+			_, err := revokeSessions(tx.Where("id = ?", session.ID), models.SessionRefreshReuse)
+			return err
+		}
+
+		session.LastSeenAt = now
+		session.IP = truncate(meta.IP, 45)
+		session.UserAgent = truncate(meta.UserAgent, 255)
+		err = tx.Model(&session).UpdateColumns(map[string]interface{}{
+			"last_seen_at": session.LastSeenAt,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+		}).Error
+		if err != nil {
+			return err
+		}
+		grant, err = m.issueRefreshToken(tx, session)
+		return err
+	})
+	if err == nil && reused {
+		return RefreshGrant{}, ErrRefreshTokenReused
+	}
+	return grant, err
+}
+
+// issueRefreshToken stores a new refresh token for session. It expires after
+// RefreshTTL, but never after the session itself.
+func (m *SessionManager) issueRefreshToken(tx *gorm.DB, session models.UserSession) (RefreshGrant, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return RefreshGrant{}, err
+	}
+	token := refreshTokenPrefix + hex.EncodeToString(b)
+	expires := time.Now().Add(m.RefreshTTL)
+	if session.ExpiresAt.Before(expires) {
+		expires = session.ExpiresAt
+	}
+	record := models.RefreshToken{SessionID: session.ID, TokenHash: hashToken(token), ExpiresAt: expires}
+	if err := tx.Create(&record).Error; err != nil {
+		return RefreshGrant{}, err
+	}
+	return RefreshGrant{Session: session, Token: token, ExpiresAt: expires}, nil
+}
+
+// Active reports whether session id is neither revoked nor expired. Access
+// tokens issued for a session are only accepted while it is.
+func (m *SessionManager) Active(db *gorm.DB, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// List returns the active sessions of user id, most recently used first.
+func (m *SessionManager) List(db *gorm.DB, userID uint) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke ends session id of user id. It fails with gorm.ErrRecordNotFound when
+// the user has no such active session.
+func (m *SessionManager) Revoke(db *gorm.DB, userID, id uint, reason string) error {
+	n, err := revokeSessions(db.Where("id = ? AND user_id = ? AND expires_at > ?", id, userID, time.Now()), reason)
+	if err == nil && n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+// RevokeAll ends every active session of user id except keep (0 keeps none)
+// and returns how many were ended.
+func (m *SessionManager) RevokeAll(db *gorm.DB, userID, keep uint, reason string) (int64, error) {
+	return revokeSessions(db.Where("user_id = ? AND id <> ?", userID, keep), reason)
+}
+
+// revokeSessions ends the not yet revoked sessions selected by scope.
+func revokeSessions(scope *gorm.DB, reason string) (int64, error) {
+	res := scope.Model(&models.UserSession{}).Where("revoked_at IS NULL").
+		UpdateColumns(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason})
+	return res.RowsAffected, res.Error
+}
+
+// Run sweeps ended sessions every SweepInterval until ctx is done.
+func (m *SessionManager) Run(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(m.SweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Sweep(db); err != nil {
+			log.Printf("sessions: sweeping: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes sessions that expired or were revoked more than
+// sessionRetention ago, with their refresh tokens, and the expired refresh
+// tokens of the remaining sessions.
+func (m *SessionManager) Sweep(db *gorm.DB) error {
+	cutoff := time.Now().Add(-sessionRetention)
+	return db.Transaction(func(tx *gorm.DB) error {
+		ended := tx.Model(&models.UserSession{}).Select("id").
+			Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff)
+		if err := tx.Where("session_id IN (?)", ended).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.UserSession{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("expires_at < ?", cutoff).Delete(&models.RefreshToken{}).Error
+	})
+}
+
+// truncate cuts s to at most n bytes, on a rune boundary, so client supplied
+// metadata fits its column.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
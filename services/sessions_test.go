@@ -0,0 +1,237 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+func sessionTestDB(t *testing.T) *gorm.DB {
+	return testDB(t, &models.UserSession{}, &models.RefreshToken{})
+}
+
+// loadSession reads session id back, revoked or not.
+func loadSession(t *testing.T, db *gorm.DB, id uint) models.UserSession {
+	t.Helper()
+	var s models.UserSession
+	if err := db.First(&s, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSessionRefresh(t *testing.T) {
+	db := sessionTestDB(t)
+	m := &SessionManager{TTL: time.Hour, RefreshTTL: 10 * time.Minute}
+	meta := SessionMeta{Device: "Pixel 8", IP: "192.0.2.1", UserAgent: "test"}
+
+	first, err := m.Start(db, 1, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first.Token, refreshTokenPrefix) || first.Session.ID == 0 || first.Session.Device != "Pixel 8" {
+		t.Fatalf("Start() = %+v", first)
+	}
+	if d := time.Until(first.ExpiresAt); d <= 9*time.Minute || d > 10*time.Minute {
+		t.Errorf("refresh token expires in %v, want RefreshTTL", d)
+	}
+
+	second, err := m.Refresh(db, first.Token, SessionMeta{IP: "192.0.2.2", UserAgent: "moved"})
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if second.Session.ID != first.Session.ID || second.Token == first.Token {
+		t.Errorf("Refresh() = session %d token %q, want session %d and a new token", second.Session.ID, second.Token, first.Session.ID)
+	}
+	if s := loadSession(t, db, first.Session.ID); s.IP != "192.0.2.2" || s.UserAgent != "moved" || s.Device != "Pixel 8" {
+		t.Errorf("refreshed session = %+v", s)
+	}
+	third, err := m.Refresh(db, second.Token, meta)
+	if err != nil {
+		t.Fatalf("second Refresh() error = %v", err)
+	}
+
+	// Presenting an exchanged token again ends the session, and with it the
+	// newest token.
+	if _, err := m.Refresh(db, first.Token, meta); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	s := loadSession(t, db, first.Session.ID)
+	if s.RevokedAt == nil || s.RevokedReason != models.SessionRefreshReuse {
+		t.Errorf("session after reuse = %+v, want revoked for %s", s, models.SessionRefreshReuse)
+	}
+	if active, _ := m.Active(db, first.Session.ID); active {
+		t.Error("Active() after reuse = true")
+	}
+	if _, err := m.Refresh(db, third.Token, meta); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("newest token after reuse: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := m.Refresh(db, "rt_unknown", meta); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestSessionRefreshExpired(t *testing.T) {
+	db := sessionTestDB(t)
+	m := &SessionManager{TTL: time.Hour, RefreshTTL: 2 * time.Hour}
+	grant, err := m.Start(db, 1, SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The refresh token never outlives its session.
+	if !grant.ExpiresAt.Equal(grant.Session.ExpiresAt) {
+		t.Errorf("refresh token expires %v, want the session's %v", grant.ExpiresAt, grant.Session.ExpiresAt)
+	}
+
+	err = db.Model(&models.RefreshToken{}).Where("session_id = ?", grant.Session.ID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Refresh(db, grant.Token, SessionMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	// An expired token is no reuse: the session stays.
+	if s := loadSession(t, db, grant.Session.ID); s.RevokedAt != nil {
+		t.Errorf("session revoked after an expired token: %+v", s)
+	}
+
+	other, err := m.Start(db, 1, SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&models.UserSession{}).Where("id = ?", other.Session.ID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Refresh(db, other.Token, SessionMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired session: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestSessionRefreshLostClaim(t *testing.T) {
+	db := sessionTestDB(t)
+	m := &SessionManager{TTL: time.Hour, RefreshTTL: time.Hour}
+	grant, err := m.Start(db, 1, SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent refresh claims the token right after this one read it.
+	raced := false
+	err = db.Callback().Query().After("gorm:query").Register("test:race", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*models.RefreshToken); ok && !raced {
+			raced = true
+			tx.Session(&gorm.Session{NewDB: true}).Model(&models.RefreshToken{}).
+				Where("session_id = ?", grant.Session.ID).UpdateColumn("used_at", time.Now())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Refresh(db, grant.Token, SessionMeta{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("losing refresh: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if s := loadSession(t, db, grant.Session.ID); s.RevokedAt == nil || s.RevokedReason != models.SessionRefreshReuse {
+		t.Errorf("session after a lost claim = %+v, want revoked for %s", s, models.SessionRefreshReuse)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+	db := sessionTestDB(t)
+	m := &SessionManager{TTL: time.Hour, RefreshTTL: time.Hour}
+	var ids []uint
+	for _, user := range []uint{1, 1, 1, 2} {
+		grant, err := m.Start(db, user, SessionMeta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, grant.Session.ID)
+	}
+
+	if err := m.Revoke(db, 2, ids[0], models.SessionRevoked); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Revoke(other user) error = %v, want ErrRecordNotFound", err)
+	}
+	if err := m.Revoke(db, 1, ids[0], models.SessionLogout); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke(db, 1, ids[0], models.SessionLogout); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Revoke(revoked) error = %v, want ErrRecordNotFound", err)
+	}
+	n, err := m.RevokeAll(db, 1, ids[1], models.SessionPasswordChanged)
+	if err != nil || n != 1 {
+		t.Errorf("RevokeAll() = %d, %v, want 1, nil", n, err)
+	}
+	if s := loadSession(t, db, ids[0]); s.RevokedReason != models.SessionLogout {
+		t.Errorf("RevokeAll() changed the reason of a revoked session to %q", s.RevokedReason)
+	}
+	for i, want := range []bool{false, true, false, true} {
+		if active, err := m.Active(db, ids[i]); err != nil || active != want {
+			t.Errorf("Active(session %d) = %v, %v, want %v", i, active, err, want)
+		}
+	}
+	if list, _ := m.List(db, 1); len(list) != 1 || list[0].ID != ids[1] {
+		t.Errorf("List() = %+v, want only session %d", list, ids[1])
+	}
+}
+
+func TestSessionSweep(t *testing.T) {
+	db := sessionTestDB(t)
+	m := &SessionManager{TTL: time.Hour, RefreshTTL: time.Hour}
+	start := func() RefreshGrant {
+		t.Helper()
+		grant, err := m.Start(db, 1, SessionMeta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return grant
+	}
+	set := func(model interface{}, id uint, column string, ago time.Duration) {
+		t.Helper()
+		if err := db.Model(model).Where("id = ?", id).Update(column, time.Now().Add(-ago)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokenID := func(session uint) uint {
+		t.Helper()
+		var token models.RefreshToken
+		if err := db.Where("session_id = ?", session).First(&token).Error; err != nil {
+			t.Fatal(err)
+		}
+		return token.ID
+	}
+
+	live, recentlyEnded, longExpired, longRevoked := start(), start(), start(), start()
+	set(&models.UserSession{}, recentlyEnded.Session.ID, "revoked_at", time.Hour)
+	set(&models.UserSession{}, longExpired.Session.ID, "expires_at", sessionRetention+time.Hour)
+	set(&models.UserSession{}, longRevoked.Session.ID, "revoked_at", sessionRetention+time.Hour)
+	// An old token of a live session goes too; its session stays.
+	oldToken, err := m.issueRefreshToken(db, live.Session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var old models.RefreshToken
+	db.Where("token_hash = ?", hashToken(oldToken.Token)).First(&old)
+	set(&models.RefreshToken{}, old.ID, "expires_at", sessionRetention+time.Hour)
+
+	if err := m.Sweep(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var sessions []uint
+	db.Model(&models.UserSession{}).Order("id").Pluck("id", &sessions)
+	if want := []uint{live.Session.ID, recentlyEnded.Session.ID}; len(sessions) != 2 || sessions[0] != want[0] || sessions[1] != want[1] {
+		t.Errorf("sessions after Sweep = %v, want %v", sessions, want)
+	}
+	var tokens []uint
+	db.Model(&models.RefreshToken{}).Order("id").Pluck("id", &tokens)
+	if want := []uint{tokenID(live.Session.ID), tokenID(recentlyEnded.Session.ID)}; len(tokens) != 2 || tokens[0] != want[0] || tokens[1] != want[1] {
+		t.Errorf("refresh tokens after Sweep = %v, want %v", tokens, want)
+	}
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+	"github.com/amirkhgraphic/go-arcaptcha-service/identity"
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"gorm.io/gorm"
+)
+
+// AnyDomain is the value of a domain_cap rule that applies to every domain
+// without a cap of its own.
+const AnyDomain = "*"
+
+// SignupGuard checks usernames and emails against the signup rules stored in
+// signup_rules and against a file of disposable email domains, which is
+// reloaded whenever it changes.
+type SignupGuard struct {
+	// DisposableFile lists one domain per line; blank lines and lines starting
+	// with # are ignored. A missing file is an empty list.
+	DisposableFile string
+	// ReloadInterval is how often the file is checked for changes.
+	ReloadInterval time.Duration
+	// CapWindow is the window domain_cap rules count signups in.
+	CapWindow time.Duration
+	// Retention is how long rejections are kept.
+	Retention time.Duration
+
+	mu         sync.RWMutex
+	disposable map[string]struct{}
+	modTime    time.Time
+	size       int64
+	loadedAt   time.Time
+	patterns   sync.Map
+}
+
+// NewSignupGuard reads DISPOSABLE_EMAIL_DOMAINS_FILE (default
+// data/disposable_domains.txt), DISPOSABLE_EMAIL_DOMAINS_RELOAD (default 1m),
+// SIGNUP_DOMAIN_CAP_WINDOW (default 24h) and SIGNUP_REJECTION_RETENTION
+// (default 720h), and loads the disposable domains.
+func NewSignupGuard() *SignupGuard {
+	file := os.Getenv("DISPOSABLE_EMAIL_DOMAINS_FILE")
+	if file == "" {
+		file = "data/disposable_domains.txt"
+	}
+	g := &SignupGuard{
+		DisposableFile: file,
+		ReloadInterval: envDuration("DISPOSABLE_EMAIL_DOMAINS_RELOAD", time.Minute),
+		CapWindow:      envDuration("SIGNUP_DOMAIN_CAP_WINDOW", 24*time.Hour),
+		Retention:      envDuration("SIGNUP_REJECTION_RETENTION", 30*24*time.Hour),
+	}
+	if err := g.Reload(); err != nil {
+		log.Printf("signup rules: loading %s: %v", file, err)
+	}
+	return g
+}
+
+// Signups is set by main once the environment is loaded.
+var Signups = &SignupGuard{}
+
+// SignupAttempt is a username and email about to be written. Empty fields are
+// not checked, so updates only pass what they change. Signup turns on the
+// per-domain caps, which only count new users.
+type SignupAttempt struct {
+	Username string
+	Email    string
+	Signup   bool
+}
+
+// SignupViolation is one field refused by a rule. RuleID is empty for the
+// disposable domain list.
+type SignupViolation struct {
+	Rule   string
+	RuleID *uint
+	Error  validation.FieldError
+}
+
+// Check returns the rules attempt breaks, at most one per field.
+func (g *SignupGuard) Check(db *gorm.DB, attempt SignupAttempt) ([]SignupViolation, error) {
+	var rules []models.SignupRule
+	if err := db.Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var out []SignupViolation
+	if attempt.Username != "" {
+		if v, ok := g.checkUsername(rules, identity.Username(attempt.Username)); ok {
+			out = append(out, v)
+		}
+	}
+	if attempt.Email != "" {
+		v, ok, err := g.checkEmail(db, rules, identity.Email(attempt.Email), attempt.Signup)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func (g *SignupGuard) checkUsername(rules []models.SignupRule, username string) (SignupViolation, bool) {
+	for _, r := range rules {
+		if r.Kind == models.RuleReservedUsername && r.Value == username {
+			return violation(r, "username", validation.CodeReserved, nil), true
+		}
+	}
+	for _, r := range rules {
+		if r.Kind == models.RuleUsernamePattern && g.matches(r.Value, username) {
+			return violation(r, "username", validation.CodeBlocked, nil), true
+		}
+	}
+	return SignupViolation{}, false
+}
+
+func (g *SignupGuard) checkEmail(db *gorm.DB, rules []models.SignupRule, email string, signup bool) (SignupViolation, bool, error) {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, r := range rules {
+		if r.Kind == models.RuleBlockedDomain && domainMatches(domain, r.Value) {
+			return violation(r, "email", validation.CodeBlocked, nil), true, nil
+		}
+	}
+	if g.IsDisposable(domain) {
+		return SignupViolation{
+			Rule:  models.RuleDisposableDomain,
+			Error: validation.NewFieldError("email", validation.CodeDisposable, nil),
+		}, true, nil
+	}
+	for _, r := range rules {
+		if r.Kind == models.RuleEmailPattern && g.matches(r.Value, email) {
+			return violation(r, "email", validation.CodeBlocked, nil), true, nil
+		}
+	}
+	if !signup {
+		return SignupViolation{}, false, nil
+	}
+
+	var capRule *models.SignupRule
+	for i, r := range rules {
+		if r.Kind != models.RuleDomainCap {
+			continue
+		}
+		if r.Value == domain {
+			capRule = &rules[i]
+			break
+		}
+		if r.Value == AnyDomain && capRule == nil {
+			capRule = &rules[i]
+		}
+	}
+	if capRule == nil {
+		return SignupViolation{}, false, nil
+	}
+	// The count runs before the user is created, outside its transaction, so
+	// sign-ups racing each other can each see room under the cap and overshoot
+	// it by as many as run at once. The cap is meant to slow bulk sign-ups down,
+	// not to be exact, so that is accepted rather than locking every sign-up.
+	var count int64
+	err := db.Unscoped().Model(&models.User{}).
+		Where(`email_canonical LIKE ? ESCAPE '\' AND created_at > ?`, "%@"+escapeLike(domain), time.Now().Add(-g.CapWindow)).
+		Count(&count).Error
+	if err != nil {
+		return SignupViolation{}, false, err
+	}
+	if count >= int64(capRule.MaxSignups) {
+		return violation(*capRule, "email", validation.CodeDomainLimit, i18n.Params{"max": capRule.MaxSignups}), true, nil
+	}
+	return SignupViolation{}, false, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func violation(r models.SignupRule, field, code string, params i18n.Params) SignupViolation {
+	id := r.ID
+	return SignupViolation{Rule: r.Kind, RuleID: &id, Error: validation.NewFieldError(field, code, params)}
+}
+
+// matches reports whether pattern matches s. Patterns are checked when a rule
+// is created; one that does not compile anyway never matches.
+func (g *SignupGuard) matches(pattern, s string) bool {
+	if re, ok := g.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp).MatchString(s)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("signup rules: ignoring pattern %q: %v", pattern, err)
+		return false
+	}
+	g.patterns.Store(pattern, re)
+	return re.MatchString(s)
+}
+
+// domainMatches reports whether domain is rule or one of its subdomains.
+func domainMatches(domain, rule string) bool {
+	return domain == rule || strings.HasSuffix(domain, "."+rule)
+}
+
+// NormalizeDomain is the stored form of a domain in a rule or the disposable
+// list: lowercase, without a leading "@".
+func NormalizeDomain(s string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "@")
+}
+
+// IsDisposable reports whether domain, or a domain it is under, is on the
+// disposable list.
+func (g *SignupGuard) IsDisposable(domain string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for d := domain; d != ""; {
+		if _, ok := g.disposable[d]; ok {
+			return true
+		}
+		dot := strings.IndexByte(d, '.')
+		if dot < 0 {
+			break
+		}
+		d = d[dot+1:]
+	}
+	return false
+}
+
+// DisposableList describes the loaded disposable domain list.
+type DisposableList struct {
+	File       string
+	Domains    int
+	ModifiedAt *time.Time
+	LoadedAt   time.Time
+}
+
+// Disposable describes the list as last loaded.
+func (g *SignupGuard) Disposable() DisposableList {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := DisposableList{File: g.DisposableFile, Domains: len(g.disposable), LoadedAt: g.loadedAt}
+	if !g.modTime.IsZero() {
+		mod := g.modTime
+		out.ModifiedAt = &mod
+	}
+	return out
+}
+
+// Reload reads the disposable domain file again.
+func (g *SignupGuard) Reload() error {
+	return g.reload(true)
+}
+
+// reload reads the file, unless force is false and its size and modification
+// time are unchanged since the last load.
+func (g *SignupGuard) reload(force bool) error {
+	info, err := os.Stat(g.DisposableFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if force || g.disposable == nil || !g.modTime.IsZero() {
+			g.disposable, g.modTime, g.size, g.loadedAt = map[string]struct{}{}, time.Time{}, 0, time.Now()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	g.mu.RLock()
+	unchanged := g.disposable != nil && info.ModTime().Equal(g.modTime) && info.Size() == g.size
+	g.mu.RUnlock()
+	if unchanged && !force {
+		return nil
+	}
+
+	f, err := os.Open(g.DisposableFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := NormalizeDomain(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.disposable, g.modTime, g.size, g.loadedAt = domains, info.ModTime(), info.Size(), time.Now()
+	g.mu.Unlock()
+	log.Printf("signup rules: loaded %d disposable domains from %s", len(domains), g.DisposableFile)
+	return nil
+}
+
+// Run reloads the disposable domain file when it changes and deletes
+// rejections older than Retention, every ReloadInterval until ctx is done.
+func (g *SignupGuard) Run(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(g.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := g.reload(false); err != nil {
+			log.Printf("signup rules: reloading %s: %v", g.DisposableFile, err)
+		}
+		err := db.Where("created_at < ?", time.Now().Add(-g.Retention)).Delete(&models.SignupRejection{}).Error
+		if err != nil {
+			log.Printf("signup rules: sweeping rejections: %v", err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/validation"
+	"gorm.io/gorm"
+)
+
+// signupGuard returns a guard whose disposable list holds domains.
+func signupGuard(t *testing.T, domains ...string) *SignupGuard {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "disposable.txt")
+	content := "# disposable domains\n\n" + strings.Join(domains, "\n") + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	g := &SignupGuard{DisposableFile: file, CapWindow: time.Hour}
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// createUsers creates n users with emails at domain, created ago.
+func createUsers(t *testing.T, db *gorm.DB, domain string, n int, ago time.Duration) {
+	t.Helper()
+	var count int64
+	db.Unscoped().Model(&models.User{}).Count(&count)
+	for i := 0; i < n; i++ {
+		count++
+		u := models.User{Username: fmt.Sprintf("user%d", count), Email: fmt.Sprintf("user%d@%s", count, domain)}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Model(&u).UpdateColumn("created_at", time.Now().Add(-ago)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSignupGuardCheck(t *testing.T) {
+	db := testDB(t, &models.User{}, &models.SignupRule{})
+	g := signupGuard(t, "Mailinator.com", "@trash.example")
+	rules := []models.SignupRule{
+		{Kind: models.RuleReservedUsername, Value: "admin"},
+		{Kind: models.RuleUsernamePattern, Value: `^support`},
+		{Kind: models.RuleUsernamePattern, Value: `(`},
+		{Kind: models.RuleBlockedDomain, Value: "blocked.example"},
+		{Kind: models.RuleEmailPattern, Value: `^spam`},
+		{Kind: models.RuleDomainCap, Value: AnyDomain, MaxSignups: 3},
+		{Kind: models.RuleDomainCap, Value: "capped.example", MaxSignups: 1},
+		{Kind: models.RuleDomainCap, Value: "under_score.example", MaxSignups: 1},
+	}
+	if err := db.Create(&rules).Error; err != nil {
+		t.Fatal(err)
+	}
+	createUsers(t, db, "capped.example", 1, time.Minute)
+	createUsers(t, db, "busy.example", 3, time.Minute)
+	createUsers(t, db, "quiet.example", 3, 2*time.Hour)
+	createUsers(t, db, "underxscore.example", 1, time.Minute)
+
+	tests := []struct {
+		name    string
+		attempt SignupAttempt
+		// want lists the violations as "rule/field/code".
+		want []string
+	}{
+		{"allowed", SignupAttempt{Username: "alice", Email: "alice@example.com", Signup: true}, nil},
+		{"reserved username", SignupAttempt{Username: "Admin"}, []string{"reserved_username/username/reserved"}},
+		{"username pattern", SignupAttempt{Username: "support_team"}, []string{"username_pattern/username/blocked"}},
+		{"pattern not at the start", SignupAttempt{Username: "our_support"}, nil},
+		{"blocked domain", SignupAttempt{Email: "a@blocked.example"}, []string{"blocked_domain/email/blocked"}},
+		{"blocked subdomain", SignupAttempt{Email: "a@mx.Blocked.example"}, []string{"blocked_domain/email/blocked"}},
+		{"lookalike of a blocked domain", SignupAttempt{Email: "a@notblocked.example"}, nil},
+		{"disposable domain", SignupAttempt{Email: "a@mailinator.com"}, []string{"disposable_domain/email/disposable"}},
+		{"disposable subdomain", SignupAttempt{Email: "a@x.y.MAILINATOR.com"}, []string{"disposable_domain/email/disposable"}},
+		{"disposable entry with @", SignupAttempt{Email: "a@trash.example"}, []string{"disposable_domain/email/disposable"}},
+		{"lookalike of a disposable domain", SignupAttempt{Email: "a@notmailinator.com"}, nil},
+		{"email pattern", SignupAttempt{Email: "spammer@example.com"}, []string{"email_pattern/email/blocked"}},
+		{"own domain cap", SignupAttempt{Email: "b@capped.example", Signup: true}, []string{"domain_cap/email/domain_limit"}},
+		{"default domain cap", SignupAttempt{Email: "b@busy.example", Signup: true}, []string{"domain_cap/email/domain_limit"}},
+		{"signups outside the window", SignupAttempt{Email: "b@quiet.example", Signup: true}, nil},
+		{"wildcards in a capped domain", SignupAttempt{Email: "b@under_score.example", Signup: true}, nil},
+		{"caps only count sign-ups", SignupAttempt{Email: "b@capped.example"}, nil},
+		{"one violation per field", SignupAttempt{Username: "admin", Email: "spam@blocked.example", Signup: true},
+			[]string{"reserved_username/username/reserved", "blocked_domain/email/blocked"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := g.Check(db, tc.attempt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Rule+"/"+v.Error.Field+"/"+v.Error.Code)
+				if (v.RuleID == nil) != (v.Rule == models.RuleDisposableDomain) {
+					t.Errorf("%s: RuleID = %v", v.Rule, v.RuleID)
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("Check() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	violations, _ := g.Check(db, SignupAttempt{Email: "c@capped.example", Signup: true})
+	if len(violations) != 1 || violations[0].Error.Params["max"] != 1 || *violations[0].RuleID != rules[6].ID {
+		t.Errorf("domain cap violation = %+v, want the capped.example rule with max 1", violations)
+	}
+	if violations[0].Error.Code != validation.CodeDomainLimit {
+		t.Errorf("code = %q", violations[0].Error.Code)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"example.com":   "example.com",
+		"a_b.example":   `a\_b.example`,
+		"100%.example":  `100\%.example`,
+		`back\slash.io`: `back\\slash.io`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDomainMatches(t *testing.T) {
+	tests := []struct {
+		domain, rule string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"mail.example.com", "example.com", true},
+		{"a.b.example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", "mail.example.com", false},
+		{"example.com.evil", "example.com", false},
+	}
+	for _, tc := range tests {
+		if got := domainMatches(tc.domain, tc.rule); got != tc.want {
+			t.Errorf("domainMatches(%q, %q) = %v, want %v", tc.domain, tc.rule, got, tc.want)
+		}
+	}
+}
+
+func TestSignupGuardReload(t *testing.T) {
+	g := signupGuard(t, "one.example")
+	if !g.IsDisposable("one.example") || g.IsDisposable("two.example") || g.IsDisposable("example") {
+		t.Fatal("unexpected disposable list")
+	}
+	if d := g.Disposable(); d.Domains != 1 || d.ModifiedAt == nil {
+		t.Errorf("Disposable() = %+v", d)
+	}
+
+	// A changed file is read again.
+	if err := os.WriteFile(g.DisposableFile, []byte("two.example\nthree.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(g.DisposableFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if g.IsDisposable("one.example") || !g.IsDisposable("mx.three.example") {
+		t.Error("the changed file was not reloaded")
+	}
+
+	// A missing file is an empty list.
+	if err := os.Remove(g.DisposableFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if d := g.Disposable(); d.Domains != 0 || d.ModifiedAt != nil {
+		t.Errorf("Disposable() without a file = %+v", d)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// ErrTooManySubscribers is returned by Subscribe when the broker is full.
+var ErrTooManySubscribers = errors.New("too many event stream subscribers")
+
+// UserEventSubscription receives live events on C. C is closed when the
+// subscriber falls more than the buffer behind; the client is expected to
+// reconnect and catch up from the event log.
+type UserEventSubscription struct {
+	C chan models.OutboxEvent
+}
+
+// UserEventBroker tails the outbox (the persisted event log) and fans new
+// events out to the live stream subscribers. Sends never block: a subscriber
+// whose buffer is full is dropped, so one slow client cannot hold up the rest.
+//
+// The tail follows ids, which assumes events become visible in id order. That
+// holds for SQLite's single writer; on Postgres an event committed out of order
+// can be skipped live, but is still served to clients resuming from the log.
+type UserEventBroker struct {
+	MaxSubscribers int
+	BufferSize     int
+	PollInterval   time.Duration
+
+	mu   sync.Mutex
+	subs map[*UserEventSubscription]struct{}
+}
+
+// NewUserEventBroker reads SSE_MAX_SUBSCRIBERS (default 1000).
+func NewUserEventBroker() *UserEventBroker {
+	return &UserEventBroker{
+		MaxSubscribers: envPositiveInt("SSE_MAX_SUBSCRIBERS", 1000),
+		BufferSize:     64,
+		PollInterval:   time.Second,
+		subs:           map[*UserEventSubscription]struct{}{},
+	}
+}
+
+// UserEvents is set by main once the environment is loaded; main also starts
+// its Run loop.
+var UserEvents = &UserEventBroker{}
+
+// Subscribe registers a live subscriber.
+func (b *UserEventBroker) Subscribe() (*UserEventSubscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subs) >= b.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	sub := &UserEventSubscription{C: make(chan models.OutboxEvent, b.BufferSize)}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe removes a subscriber; it is safe to call after it was dropped.
+func (b *UserEventBroker) Unsubscribe(sub *UserEventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.C)
+	}
+}
+
+// Run tails the outbox from its current end until ctx is done, then closes
+// every subscription.
+func (b *UserEventBroker) Run(ctx context.Context, db *gorm.DB) {
+	var lastID uint
+	if err := db.Model(&models.OutboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		log.Printf("user events: reading log position: %v", err)
+	}
+
+	ticker := time.NewTicker(b.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.closeAll()
+			return
+		case <-ticker.C:
+		}
+		for {
+			events, err := UserEventsSince(db, lastID, nil, 500)
+			if err != nil {
+				log.Printf("user events: tailing log: %v", err)
+				break
+			}
+			if len(events) == 0 {
+				break
+			}
+			b.publish(events)
+			lastID = events[len(events)-1].ID
+		}
+	}
+}
+
+func (b *UserEventBroker) publish(events []models.OutboxEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		for _, event := range events {
+			select {
+			case sub.C <- event:
+				continue
+			default:
+			}
+			delete(b.subs, sub)
+			close(sub.C)
+			break
+		}
+	}
+}
+
+func (b *UserEventBroker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.C)
+	}
+}
+
+// UserEventsSince reads up to limit logged events after afterID, oldest first,
+// optionally restricted to the given types.
+func UserEventsSince(db *gorm.DB, afterID uint, types []string, limit int) ([]models.OutboxEvent, error) {
+	tx := db.Where("id > ?", afterID)
+	if len(types) > 0 {
+		tx = tx.Where("type IN ?", types)
+	}
+	var events []models.OutboxEvent
+	err := tx.Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
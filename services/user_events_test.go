@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+)
+
+func TestUserEventBroker(t *testing.T) {
+	b := &UserEventBroker{MaxSubscribers: 2, BufferSize: 2, PollInterval: time.Second, subs: map[*UserEventSubscription]struct{}{}}
+	fast, err := b.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, err := b.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe(); err != ErrTooManySubscribers {
+		t.Fatalf("third Subscribe() error = %v, want ErrTooManySubscribers", err)
+	}
+
+	b.publish([]models.OutboxEvent{{ID: 1}, {ID: 2}})
+	for _, want := range []uint{1, 2} {
+		if event := <-fast.C; event.ID != want {
+			t.Fatalf("fast subscriber got #%d, want #%d", event.ID, want)
+		}
+	}
+	// The slow subscriber's buffer is still full, so it is dropped instead of
+	// holding up the fast one.
+	b.publish([]models.OutboxEvent{{ID: 3}})
+	if event := <-fast.C; event.ID != 3 {
+		t.Fatalf("fast subscriber got #%d, want #3", event.ID)
+	}
+	var got []uint
+	for event := range slow.C {
+		got = append(got, event.ID)
+	}
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("dropped subscriber got %v, want [1 2] and a closed channel", got)
+	}
+
+	// A dropped subscriber frees its slot, and unsubscribing it again is safe.
+	b.Unsubscribe(slow)
+	if _, err := b.Subscribe(); err != nil {
+		t.Errorf("Subscribe() after a drop: %v", err)
+	}
+	b.Unsubscribe(fast)
+	if _, ok := <-fast.C; ok {
+		t.Error("Unsubscribe() left the channel open")
+	}
+}
+
+func TestUserEventsSince(t *testing.T) {
+	db := testDB(t, &models.OutboxEvent{})
+	for i, typ := range []string{EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserUpdated, EventUserCreated} {
+		if err := db.Create(&models.OutboxEvent{Type: typ, UserID: uint(i + 1), Payload: "{}"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		after uint
+		types []string
+		limit int
+		want  string
+	}{
+		{0, nil, 10, "[1 2 3 4 5]"},
+		{2, nil, 10, "[3 4 5]"},
+		{0, nil, 2, "[1 2]"},
+		{5, nil, 10, "[]"},
+		{0, []string{EventUserUpdated}, 10, "[2 4]"},
+		{2, []string{EventUserCreated, EventUserDeleted}, 10, "[3 5]"},
+		{0, []string{EventUserCreated, EventUserDeleted}, 2, "[1 3]"},
+	}
+	for _, tc := range cases {
+		events, err := UserEventsSince(db, tc.after, tc.types, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]uint, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+		}
+		if fmt.Sprint(ids) != tc.want {
+			t.Errorf("UserEventsSince(%d, %v, %d) = %v, want %s", tc.after, tc.types, tc.limit, ids, tc.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/amirkhgraphic/go-arcaptcha-service/textnorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchMatch carries the relevance data for one user that matched a search.
+type SearchMatch struct {
+	ID      uint
+	Rank    float64
+	Snippet string
+}
+
+// UserSearch is the dialect-specific full-text index over username, email and bio.
+// SQLite uses an FTS5 external-content table kept in sync by triggers; Postgres
+// uses a generated tsvector column with a GIN index.
+type UserSearch interface {
+	// Migrate creates the index structures and indexes rows that already exist.
+	Migrate(db *gorm.DB) error
+	// Filter restricts tx (a query on users) to rows matching the search terms.
+	Filter(tx *gorm.DB, terms []string) *gorm.DB
+	// ExcludeHiddenBios narrows a filtered query to the rows that match without
+	// an unapproved bio: their bio is empty or approved, the row is user self
+	// (when not nil), or the terms also match username and email alone.
+	ExcludeHiddenBios(tx *gorm.DB, terms []string, self *uint) *gorm.DB
+	// OrderByRank orders a filtered query by relevance, best match first.
+	OrderByRank(tx *gorm.DB, terms []string) *gorm.DB
+	// Matches returns rank and highlighted snippet for the given matching ids.
+	// The snippet only quotes the given columns (SearchColumns when nil).
+	Matches(db *gorm.DB, terms []string, ids []uint, columns []string) (map[uint]SearchMatch, error)
+}
+
+// SearchColumns are the indexed columns, in the order snippets prefer them.
+var SearchColumns = []string{"username", "email", "bio"}
+
+// Snippets are HTML: the quoted user text is escaped, and matches are wrapped
+// in <mark>. The database marks matches with private-use characters, which are
+// swapped for the tags only after escaping, so user text can never produce
+// markup of its own.
+const (
+	snippetOpen  = "\ue000"
+	snippetClose = "\ue001"
+)
+
+var snippetMarkup = strings.NewReplacer(snippetOpen, "<mark>", snippetClose, "</mark>")
+
+// highlight turns a snippet marked with snippetOpen/snippetClose into HTML.
+func highlight(raw string) string {
+	return snippetMarkup.Replace(html.EscapeString(raw))
+}
+
+// searchColumns keeps the known columns of columns, in SearchColumns order.
+func searchColumns(columns []string) []string {
+	if columns == nil {
+		return SearchColumns
+	}
+	var out []string
+	for _, col := range SearchColumns {
+		for _, want := range columns {
+			if col == want {
+				out = append(out, col)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// excludeHiddenBios keeps the rows of tx whose bio is visible or that satisfy
+// nameMatch, a match on username and email only.
+func excludeHiddenBios(tx *gorm.DB, nameMatch clause.Expr, self *uint) *gorm.DB {
+	visible := tx.Session(&gorm.Session{NewDB: true}).
+		Where("users.bio = '' OR users.moderation_status = ?", models.ModerationApproved)
+	if self != nil {
+		visible = visible.Or("users.id = ?", *self)
+	}
+	return tx.Where(visible.Or(nameMatch))
+}
+
+// UserSearchFor picks the backend matching the connection's dialect.
+func UserSearchFor(db *gorm.DB) UserSearch {
+	if db.Dialector.Name() == "postgres" {
+		return postgresUserSearch{}
+	}
+	return sqliteUserSearch{}
+}
+
+// SearchTerms splits free text into the words used for matching. Arabic/Persian
+// variants are folded first, as they are on write. Anything that is not a letter
+// or digit separates words (a zero-width non-joiner included, matching how the
+// index tokenizes), so the result is safe to embed in FTS5 and tsquery syntax.
+func SearchTerms(raw string) []string {
+	return strings.FieldsFunc(strings.ToLower(textnorm.Normalize(raw)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type sqliteUserSearch struct{}
+
+func (sqliteUserSearch) Migrate(db *gorm.DB) error {
+	stmts := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+			username, email, bio,
+			content='users', content_rowid='id',
+			tokenize='unicode61 remove_diacritics 2'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS users_fts_ai AFTER INSERT ON users BEGIN
+			INSERT INTO users_fts(rowid, username, email, bio) VALUES (new.id, new.username, new.email, new.bio);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS users_fts_ad AFTER DELETE ON users BEGIN
+			INSERT INTO users_fts(users_fts, rowid, username, email, bio) VALUES ('delete', old.id, old.username, old.email, old.bio);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS users_fts_au AFTER UPDATE ON users BEGIN
+			INSERT INTO users_fts(users_fts, rowid, username, email, bio) VALUES ('delete', old.id, old.username, old.email, old.bio);
+			INSERT INTO users_fts(rowid, username, email, bio) VALUES (new.id, new.username, new.email, new.bio);
+		END`,
+		// Index the rows that were written before the triggers existed.
+		`INSERT INTO users_fts(users_fts) VALUES ('rebuild')`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match builds an FTS5 query where every term is a quoted prefix match, so "ali"
+// still finds "alice" as the old LIKE search did.
+func (sqliteUserSearch) match(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `"` + t + `"*`
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s sqliteUserSearch) Filter(tx *gorm.DB, terms []string) *gorm.DB {
+	return tx.Where("users.id IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)", s.match(terms))
+}
+
+func (s sqliteUserSearch) ExcludeHiddenBios(tx *gorm.DB, terms []string, self *uint) *gorm.DB {
+	return excludeHiddenBios(tx, gorm.Expr(
+		"users.id IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?)",
+		"{username email} : ("+s.match(terms)+")",
+	), self)
+}
+
+func (s sqliteUserSearch) OrderByRank(tx *gorm.DB, terms []string) *gorm.DB {
+	// bm25 is lower-is-better; username and email hits outweigh bio hits.
+	return tx.Joins("JOIN (SELECT rowid AS fts_id, bm25(users_fts, 10.0, 10.0, 1.0) AS fts_rank FROM users_fts WHERE users_fts MATCH ?) AS fts ON fts.fts_id = users.id", s.match(terms)).
+		Order("fts.fts_rank asc, users.id desc")
+}
+
+// Matches snippets every column on its own, as snippet() over all columns
+// may pick one the caller cannot see, and keeps the first allowed column
+// with a match.
+func (s sqliteUserSearch) Matches(db *gorm.DB, terms []string, ids []uint, columns []string) (map[uint]SearchMatch, error) {
+	var rows []struct {
+		ID       uint
+		Rank     float64
+		Username string
+		Email    string
+		Bio      string
+	}
+	err := db.Raw(
+		`SELECT rowid AS id, -bm25(users_fts, 10.0, 10.0, 1.0) AS rank,
+			snippet(users_fts, 0, ?, ?, '…', 12) AS username,
+			snippet(users_fts, 1, ?, ?, '…', 12) AS email,
+			snippet(users_fts, 2, ?, ?, '…', 12) AS bio
+		FROM users_fts WHERE users_fts MATCH ? AND rowid IN ?`,
+		snippetOpen, snippetClose, snippetOpen, snippetClose, snippetOpen, snippetClose, s.match(terms), ids,
+	).Scan(&rows).Error
+	allowed := searchColumns(columns)
+	out := make(map[uint]SearchMatch, len(rows))
+	for _, r := range rows {
+		m := SearchMatch{ID: r.ID, Rank: r.Rank}
+		snippets := map[string]string{"username": r.Username, "email": r.Email, "bio": r.Bio}
+		for _, col := range allowed {
+			if strings.Contains(snippets[col], snippetOpen) {
+				m.Snippet = highlight(snippets[col])
+				break
+			}
+		}
+		out[r.ID] = m
+	}
+	return out, err
+}
+
+type postgresUserSearch struct{}
+
+func (postgresUserSearch) Migrate(db *gorm.DB) error {
+	stmts := []string{
+		// A stored generated column is computed for existing rows when it is added.
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(username, '')), 'A') ||
+			setweight(to_tsvector('simple', translate(coalesce(email, ''), '@.', '  ')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(bio, '')), 'B')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector)`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (postgresUserSearch) query(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+func (s postgresUserSearch) Filter(tx *gorm.DB, terms []string) *gorm.DB {
+	return tx.Where("users.search_vector @@ to_tsquery('simple', ?)", s.query(terms))
+}
+
+func (s postgresUserSearch) ExcludeHiddenBios(tx *gorm.DB, terms []string, self *uint) *gorm.DB {
+	return excludeHiddenBios(tx, gorm.Expr(
+		`(to_tsvector('simple', coalesce(users.username, '')) ||
+			to_tsvector('simple', translate(coalesce(users.email, ''), '@.', '  '))) @@ to_tsquery('simple', ?)`,
+		s.query(terms),
+	), self)
+}
+
+func (s postgresUserSearch) OrderByRank(tx *gorm.DB, terms []string) *gorm.DB {
+	return tx.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "ts_rank(users.search_vector, to_tsquery('simple', ?)) DESC, users.id DESC",
+		Vars:               []interface{}{s.query(terms)},
+		WithoutParentheses: true,
+	}})
+}
+
+func (s postgresUserSearch) Matches(db *gorm.DB, terms []string, ids []uint, columns []string) (map[uint]SearchMatch, error) {
+	var rows []SearchMatch
+	q := s.query(terms)
+	// The column names come from SearchColumns, never from the request.
+	text := "''"
+	if allowed := searchColumns(columns); len(allowed) > 0 {
+		text = "concat_ws(' ', " + strings.Join(allowed, ", ") + ")"
+	}
+	err := db.Raw(
+		`SELECT id, ts_rank(search_vector, to_tsquery('simple', ?)) AS rank,
+			ts_headline('simple', `+text+`, to_tsquery('simple', ?),
+				'StartSel=' || ? || ', StopSel=' || ? || ', MaxWords=20, MinWords=5') AS snippet
+		FROM users WHERE id IN ?`,
+		q, q, snippetOpen, snippetClose, ids,
+	).Scan(&rows).Error
+	out := make(map[uint]SearchMatch, len(rows))
+	for _, r := range rows {
+		if strings.Contains(r.Snippet, snippetOpen) {
+			r.Snippet = highlight(r.Snippet)
+		} else {
+			r.Snippet = ""
+		}
+		out[r.ID] = r
+	}
+	return out, err
+}
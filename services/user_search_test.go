@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExcludeHiddenBios(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := sqliteUserSearch{}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	users := []models.User{
+		{Username: "alice", Email: "alice@example.com", Bio: "secret plans", ModerationStatus: models.ModerationPending},
+		{Username: "bob", Email: "bob@example.com", Bio: "secret plans", ModerationStatus: models.ModerationApproved},
+		{Username: "secretary", Email: "carol@example.com", Bio: "secret plans", ModerationStatus: models.ModerationPending},
+		{Username: "dave", Email: "dave@example.com", Bio: "secret plans", ModerationStatus: models.ModerationRejected},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	dave := users[3].ID
+
+	cases := []struct {
+		name  string
+		terms []string
+		self  *uint
+		want  []string
+	}{
+		// alice and dave only match in their hidden bios.
+		{"bio only", []string{"plans"}, nil, []string{"bob"}},
+		{"bio or username", []string{"secret"}, nil, []string{"bob", "secretary"}},
+		{"own bio", []string{"plans"}, &dave, []string{"bob", "dave"}},
+		{"username", []string{"alice"}, nil, []string{"alice"}},
+		// A term that matches only the hidden bio still drops the row.
+		{"username and bio", []string{"alice", "plans"}, nil, nil},
+	}
+	for _, tc := range cases {
+		var got []string
+		tx := search.ExcludeHiddenBios(search.Filter(db.Model(&models.User{}), tc.terms), tc.terms, tc.self)
+		if err := tx.Order("users.id").Pluck("username", &got).Error; err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+}
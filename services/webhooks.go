@@ -0,0 +1,409 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+// User lifecycle event types.
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// EventTypes lists every event type subscriptions can ask for.
+var EventTypes = []string{EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserRestored}
+
+// revisionEvents maps revision actions to the event they publish. Baselines
+// describe no change and publish nothing.
+var revisionEvents = map[string]string{
+	models.RevisionCreate:   EventUserCreated,
+	models.RevisionUpdate:   EventUserUpdated,
+	models.RevisionRevert:   EventUserUpdated,
+	models.RevisionDelete:   EventUserDeleted,
+	models.RevisionRestore:  EventUserRestored,
+	models.RevisionVerify:   EventUserUpdated,
+	models.RevisionModerate: EventUserUpdated,
+}
+
+const (
+	// WebhookSignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256>" where
+	// the HMAC is computed with the subscription secret over "<t>.<body>".
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookEventIDHeader   = "X-Webhook-Event-ID"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookEvent is the JSON body of a delivery.
+type webhookEvent struct {
+	Type       string           `json:"type"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	Data       webhookEventData `json:"data"`
+}
+
+type webhookEventData struct {
+	User      webhookUser            `json:"user"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+type webhookUser struct {
+	ID               uint      `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	Bio              string    `json:"bio"`
+	ModerationStatus string    `json:"moderation_status"`
+	Gender           string    `json:"gender"`
+	Nationality      string    `json:"nationality"`
+	Version          uint      `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// enqueueUserEvent writes the event for a revision to the outbox, in tx.
+func enqueueUserEvent(tx *gorm.DB, eventType string, user models.User, rev models.UserRevision, changes map[string]FieldChange) error {
+	body, err := json.Marshal(webhookEvent{
+		Type:       eventType,
+		OccurredAt: rev.CreatedAt,
+		Data: webhookEventData{
+			User: webhookUser{
+				ID:               user.ID,
+				Username:         user.Username,
+				Email:            user.Email,
+				EmailVerified:    user.EmailVerified,
+				Bio:              user.Bio,
+				ModerationStatus: user.ModerationStatus,
+				Gender:           user.Gender,
+				Nationality:      user.Nationality,
+				Version:          user.Version,
+				CreatedAt:        user.CreatedAt,
+				UpdatedAt:        user.UpdatedAt,
+			},
+			Changes:   changes,
+			Actor:     rev.Actor,
+			RequestID: rev.RequestID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		Type:      eventType,
+		UserID:    user.ID,
+		Payload:   string(body),
+		CreatedAt: rev.CreatedAt,
+	}).Error
+}
+
+// WithoutBio returns an outbox event payload with the user's bio and the bio
+// change blanked, for readers bios are hidden from.
+func WithoutBio(payload string) (string, error) {
+	var event webhookEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return "", err
+	}
+	event.Data.User.Bio = ""
+	if _, ok := event.Data.Changes["bio"]; ok {
+		event.Data.Changes["bio"] = FieldChange{}
+	}
+	raw, err := json.Marshal(event)
+	return string(raw), err
+}
+
+// SubscriptionWants reports whether a subscription's event list includes eventType.
+func SubscriptionWants(events, eventType string) bool {
+	for _, e := range strings.Split(events, ",") {
+		if e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookSecret returns a random signing secret.
+func NewWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// SignWebhook returns the signature header value for body sent at t.
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher moves events from the outbox to the subscriptions and
+// delivers them with exponential backoff. A delivery that still fails after
+// MaxAttempts is marked dead and waits for a manual redelivery.
+type WebhookDispatcher struct {
+	Client       *http.Client
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	BatchSize    int
+}
+
+// NewWebhookDispatcher reads WEBHOOK_MAX_ATTEMPTS (default 8),
+// WEBHOOK_RETRY_BASE (default 30s) and WEBHOOK_TIMEOUT (default 10s).
+func NewWebhookDispatcher() *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Client:       &http.Client{Timeout: envDuration("WEBHOOK_TIMEOUT", 10*time.Second)},
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  envPositiveInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		BaseDelay:    envDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+		MaxDelay:     6 * time.Hour,
+		BatchSize:    100,
+	}
+}
+
+// Webhooks is set by main once the environment is loaded; main also starts
+// its Run loop.
+var Webhooks = &WebhookDispatcher{}
+
+// Run dispatches and delivers until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.DispatchOutbox(db); err != nil {
+			log.Printf("webhooks: dispatching outbox: %v", err)
+		}
+		if err := d.DeliverDue(ctx, db); err != nil {
+			log.Printf("webhooks: delivering: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOutbox creates a pending delivery per matching active subscription
+// for every undispatched event. Each event is claimed and fanned out in one
+// transaction, so it is dispatched exactly once even with several instances.
+func (d *WebhookDispatcher) DispatchOutbox(db *gorm.DB) error {
+	var events []models.OutboxEvent
+	if err := db.Where("dispatched_at IS NULL").Order("id").Limit(d.BatchSize).Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	var subs []models.WebhookSubscription
+	if err := db.Where("active = ?", true).Find(&subs).Error; err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			res := tx.Model(&models.OutboxEvent{}).Where("id = ? AND dispatched_at IS NULL", event.ID).Update("dispatched_at", now)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			for _, sub := range subs {
+				if !SubscriptionWants(sub.Events, event.Type) {
+					continue
+				}
+				delivery := models.WebhookDelivery{
+					SubscriptionID: sub.ID,
+					EventID:        event.ID,
+					Status:         models.DeliveryPending,
+					NextAttemptAt:  now,
+				}
+				if err := tx.Create(&delivery).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("event #%d: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due.
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context, db *gorm.DB) error {
+	var due []models.WebhookDelivery
+	err := db.Preload("Event").
+		Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").Limit(d.BatchSize).Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := d.attempt(ctx, db, delivery); err != nil {
+			return fmt.Errorf("delivery #%d: %w", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// attempt sends one delivery and records the outcome. The delivery is leased
+// first by pushing its next attempt past the request timeout, so another
+// instance polling at the same time skips it.
+func (d *WebhookDispatcher) attempt(ctx context.Context, db *gorm.DB, delivery models.WebhookDelivery) error {
+	now := time.Now()
+	res := db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, models.DeliveryPending, now).
+		Update("next_attempt_at", now.Add(d.Client.Timeout+time.Minute))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+
+	var sub models.WebhookSubscription
+	if err := db.First(&sub, delivery.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The subscription was deleted after the delivery was queued for it;
+			// drop the delivery the way deleting the subscription does.
+			return db.Delete(&models.WebhookDelivery{}, delivery.ID).Error
+		}
+		return err
+	}
+	if !sub.Active {
+		// Deliveries queued before the subscription was deactivated are not
+		// sent; they stay in the log until redelivered.
+		return db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":     models.DeliveryDropped,
+			"last_error": "subscription is inactive",
+		}).Error
+	}
+
+	statusCode, sendErr := d.send(ctx, sub, delivery)
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"last_status_code": statusCode,
+		"last_error":       "",
+	}
+	switch {
+	case sendErr == nil:
+		now := time.Now()
+		updates["status"] = models.DeliveryDelivered
+		updates["delivered_at"] = &now
+	case attempts >= d.MaxAttempts:
+		updates["status"] = models.DeliveryDead
+		updates["last_error"] = sendErr.Error()
+	default:
+		updates["next_attempt_at"] = time.Now().Add(d.backoff(attempts))
+		updates["last_error"] = sendErr.Error()
+	}
+	return db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error
+}
+
+// send posts the event to the subscription. Any 2xx answer counts as delivered.
+func (d *WebhookDispatcher) send(ctx context.Context, sub models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Event.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-arcaptcha-service-webhooks/1")
+	req.Header.Set(WebhookEventHeader, delivery.Event.Type)
+	req.Header.Set(WebhookEventIDHeader, strconv.FormatUint(uint64(delivery.EventID), 10))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, time.Now(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the delay before the attempt after the given number of failures:
+// BaseDelay doubled per failure, capped at MaxDelay.
+func (d *WebhookDispatcher) backoff(failures int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < failures && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// Redeliver puts a delivery back in the queue with a fresh attempt budget.
+func (d *WebhookDispatcher) Redeliver(db *gorm.DB, id uint) error {
+	res := db.Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"delivered_at":    nil,
+		"last_error":      "",
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: ignoring invalid %s=%q", key, v)
+		return fallback
+	}
+	return d
+}
+
+func envPositiveInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: ignoring invalid %s=%q", key, v)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/models"
+	"gorm.io/gorm"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	at := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got := SignWebhook("whsec_test", at, body); got != want {
+		t.Errorf("SignWebhook() = %s, want %s", got, want)
+	}
+
+	// The timestamp is signed too, so a captured body cannot be replayed later.
+	if SignWebhook("whsec_test", at.Add(time.Second), body) == want {
+		t.Error("SignWebhook() ignores the timestamp")
+	}
+	if SignWebhook("whsec_other", at, body) == want {
+		t.Error("SignWebhook() ignores the secret")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	d := &WebhookDispatcher{BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+	cases := map[int]time.Duration{
+		1:    30 * time.Second,
+		2:    time.Minute,
+		3:    2 * time.Minute,
+		10:   256 * time.Minute,
+		11:   6 * time.Hour,
+		1000: 6 * time.Hour,
+	}
+	for failures, want := range cases {
+		if got := d.backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+// webhookEndpoint is an httptest server that answers with the queued status
+// codes, 200 once they run out, and records what it received.
+type webhookEndpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+	// onRequest runs while the request is being answered.
+	onRequest func()
+}
+
+func newWebhookEndpoint(t *testing.T) *webhookEndpoint {
+	e := &webhookEndpoint{}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		e.requests = append(e.requests, r)
+		e.bodies = append(e.bodies, string(body))
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		onRequest := e.onRequest
+		e.mu.Unlock()
+		if onRequest != nil {
+			onRequest()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *webhookEndpoint) received() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+func webhookTestDB(t *testing.T) *gorm.DB {
+	return testDB(t, &models.OutboxEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{})
+}
+
+func loadDelivery(t *testing.T, db *gorm.DB, id uint) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+// makeDue moves a delivery's next attempt into the past.
+func makeDue(t *testing.T, db *gorm.DB, id uint) {
+	t.Helper()
+	if err := db.Model(&models.WebhookDelivery{}).Where("id = ?", id).Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatchOutbox(t *testing.T) {
+	db := webhookTestDB(t)
+	subs := []models.WebhookSubscription{
+		{URL: "http://a.example", Secret: "a", Events: "*", Active: true},
+		{URL: "http://b.example", Secret: "b", Events: EventUserDeleted + "," + EventUserCreated, Active: true},
+		{URL: "http://c.example", Secret: "c", Events: EventUserDeleted, Active: true},
+		{URL: "http://d.example", Secret: "d", Events: "*", Active: true},
+	}
+	if err := db.Create(&subs).Error; err != nil {
+		t.Fatal(err)
+	}
+	// gorm skips false zero values on create, so deactivate d afterwards.
+	if err := db.Model(&subs[3]).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{EventUserCreated, EventUserUpdated} {
+		if err := db.Create(&models.OutboxEvent{Type: typ, UserID: 1, Payload: "{}"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &WebhookDispatcher{BatchSize: 10}
+	for i := 0; i < 2; i++ {
+		// The second run finds every event dispatched and adds nothing.
+		if err := d.DispatchOutbox(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := db.Order("event_id, subscription_id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, delivery := range deliveries {
+		got = append(got, strconv.Itoa(int(delivery.EventID))+"->"+strconv.Itoa(int(delivery.SubscriptionID)))
+		if delivery.Status != models.DeliveryPending {
+			t.Errorf("delivery #%d status = %s, want pending", delivery.ID, delivery.Status)
+		}
+	}
+	if strings.Join(got, " ") != "1->1 1->2 2->1" {
+		t.Errorf("deliveries (event->subscription) = %v, want [1->1 1->2 2->1]", got)
+	}
+	var undispatched int64
+	db.Model(&models.OutboxEvent{}).Where("dispatched_at IS NULL").Count(&undispatched)
+	if undispatched != 0 {
+		t.Errorf("%d events left undispatched", undispatched)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	db := webhookTestDB(t)
+	endpoint := newWebhookEndpoint(t)
+	endpoint.statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+	sub := models.WebhookSubscription{URL: endpoint.URL, Secret: "whsec_test", Events: "*", Active: true}
+	if err := db.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	event := models.OutboxEvent{Type: EventUserCreated, UserID: 1, Payload: `{"type":"user.created"}`}
+	if err := db.Create(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	d := &WebhookDispatcher{
+		Client:      &http.Client{Timeout: 5 * time.Second},
+		MaxAttempts: 2,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		BatchSize:   10,
+	}
+	if err := d.DispatchOutbox(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// While a request is in flight the delivery is leased past the timeout, so
+	// other instances polling at the same time skip it.
+	var leased time.Time
+	endpoint.onRequest = func() {
+		var delivery models.WebhookDelivery
+		db.First(&delivery)
+		leased = delivery.NextAttemptAt
+	}
+	start := time.Now()
+	if err := d.DeliverDue(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if !leased.After(start.Add(d.Client.Timeout)) {
+		t.Errorf("next attempt during the request = %v, want past the %v timeout", leased, d.Client.Timeout)
+	}
+
+	delivery := loadDelivery(t, db, 1)
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != 500 || delivery.LastError == "" {
+		t.Errorf("after a failure: %+v", delivery)
+	}
+	if wait := time.Until(delivery.NextAttemptAt); wait < 50*time.Second || wait > d.BaseDelay {
+		t.Errorf("retry in %v, want the %v base delay", wait, d.BaseDelay)
+	}
+
+	// The request carries the event and a signature over its timestamp and body.
+	req, body := endpoint.requests[0], endpoint.bodies[0]
+	if body != event.Payload || req.Header.Get(WebhookEventHeader) != EventUserCreated ||
+		req.Header.Get(WebhookEventIDHeader) != "1" || req.Header.Get(WebhookDeliveryHeader) != "1" {
+		t.Errorf("request = %v %s", req.Header, body)
+	}
+	sig := req.Header.Get(WebhookSignatureHeader)
+	ts, _, _ := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+	sec, _ := strconv.ParseInt(ts, 10, 64)
+	if want := SignWebhook(sub.Secret, time.Unix(sec, 0), []byte(body)); sig != want {
+		t.Errorf("signature = %s, want %s", sig, want)
+	}
+
+	// Not due yet: nothing is sent.
+	endpoint.onRequest = nil
+	if err := d.DeliverDue(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if n := endpoint.received(); n != 1 {
+		t.Fatalf("%d requests before the retry was due, want 1", n)
+	}
+
+	// A stale copy of a delivery another instance has leased is skipped.
+	stale := delivery
+	stale.NextAttemptAt = time.Now().Add(-time.Second)
+	if err := d.attempt(ctx, db, stale); err != nil {
+		t.Fatal(err)
+	}
+	if n := endpoint.received(); n != 1 {
+		t.Errorf("%d requests for a leased delivery, want 1", n)
+	}
+
+	// The second failure uses up MaxAttempts and dead-letters the delivery.
+	makeDue(t, db, 1)
+	if err := d.DeliverDue(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	delivery = loadDelivery(t, db, 1)
+	if delivery.Status != models.DeliveryDead || delivery.Attempts != 2 || delivery.LastStatusCode != 502 {
+		t.Errorf("after MaxAttempts failures: %+v", delivery)
+	}
+	makeDue(t, db, 1)
+	if err := d.DeliverDue(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if n := endpoint.received(); n != 2 {
+		t.Errorf("%d requests after the delivery died, want 2", n)
+	}
+
+	// Redelivering gives it a fresh attempt budget, and the endpoint now accepts it.
+	if err := d.Redeliver(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeliverDue(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	delivery = loadDelivery(t, db, 1)
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil ||
+		delivery.LastStatusCode != 200 || delivery.LastError != "" {
+		t.Errorf("after redelivery: %+v", delivery)
+	}
+	if err := d.Redeliver(db, 99); err != gorm.ErrRecordNotFound {
+		t.Errorf("Redeliver(unknown) error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestWebhookDeliveryWithoutSubscription(t *testing.T) {
+	db := webhookTestDB(t)
+	endpoint := newWebhookEndpoint(t)
+	subs := []models.WebhookSubscription{
+		{URL: endpoint.URL, Secret: "deleted", Events: "*", Active: true},
+		{URL: endpoint.URL, Secret: "inactive", Events: "*", Active: true},
+	}
+	if err := db.Create(&subs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.OutboxEvent{Type: EventUserCreated, UserID: 1, Payload: "{}"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	d := &WebhookDispatcher{Client: &http.Client{Timeout: time.Second}, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, BatchSize: 10}
+	if err := d.DispatchOutbox(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both subscriptions change with their deliveries still queued.
+	if err := db.Delete(&subs[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&subs[1]).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeliverDue(context.Background(), db); err != nil {
+		t.Fatalf("DeliverDue() error = %v, want the deliveries dropped", err)
+	}
+	if n := endpoint.received(); n != 0 {
+		t.Errorf("%d requests without an active subscription, want 0", n)
+	}
+
+	// The delivery of the deleted subscription is gone; the inactive one's is
+	// kept as dropped.
+	var deliveries []models.WebhookDelivery
+	if err := db.Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].SubscriptionID != subs[1].ID {
+		t.Fatalf("deliveries = %+v, want only the inactive subscription's", deliveries)
+	}
+	dropped := deliveries[0]
+	if dropped.Status != models.DeliveryDropped || dropped.Attempts != 0 || dropped.LastError == "" {
+		t.Errorf("delivery of an inactive subscription = %+v, want dropped", dropped)
+	}
+
+	// Redelivering after the subscription is back sends it, with the drop
+	// reason cleared.
+	if err := db.Model(&subs[1]).Update("active", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Redeliver(db, dropped.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadDelivery(t, db, dropped.ID); got.Status != models.DeliveryPending || got.LastError != "" {
+		t.Errorf("after Redeliver: %+v", got)
+	}
+	if err := d.DeliverDue(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadDelivery(t, db, dropped.ID); got.Status != models.DeliveryDelivered || endpoint.received() != 1 {
+		t.Errorf("after redelivery: %+v, %d requests", got, endpoint.received())
+	}
+}
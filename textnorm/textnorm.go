@@ -0,0 +1,43 @@
+// Package textnorm folds the Arabic and Persian spellings of the same text into
+// one form, so that exact filters and search terms match regardless of the
+// keyboard layout the text was typed on.
+package textnorm
+
+import "strings"
+
+// letters maps the Arabic code points that Persian keyboards and older input
+// methods produce onto their Persian counterparts, and every Persian or
+// Arabic-Indic digit onto ASCII. Tatweel (kashida) only stretches a word and is
+// dropped.
+var letters = strings.NewReplacer(
+	"\u064a", "\u06cc", // ARABIC YEH -> FARSI YEH
+	"\u0649", "\u06cc", // ALEF MAKSURA -> FARSI YEH
+	"\u0643", "\u06a9", // ARABIC KAF -> KEHEH
+	"\u0640", "", // TATWEEL
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+	"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+	"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+)
+
+// joiners are the invisible formatting characters that change how a word is
+// rendered but not what it says.
+var joiners = strings.NewReplacer(
+	"\u200c", "", // ZERO WIDTH NON-JOINER
+	"\u200d", "", // ZERO WIDTH JOINER
+	"\u200e", "", // LEFT-TO-RIGHT MARK
+	"\u200f", "", // RIGHT-TO-LEFT MARK
+)
+
+// Normalize unifies letter variants and digits. Zero-width non-joiners are kept,
+// as they are correct Persian orthography in prose such as a bio.
+func Normalize(s string) string {
+	return letters.Replace(s)
+}
+
+// Compact normalizes s and also removes zero-width joiners and direction marks.
+// It is meant for identifiers (usernames, emails) and for exact-match filter
+// values, where invisible characters should never make two values differ.
+func Compact(s string) string {
+	return joiners.Replace(letters.Replace(s))
+}
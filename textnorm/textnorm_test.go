@@ -0,0 +1,48 @@
+package textnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"alice", "alice"},
+		// Arabic yeh and kaf, and alef maksura, become their Persian forms.
+		{"عل\u064a", "عل\u06cc"},
+		{"موس\u0649", "موس\u06cc"},
+		{"\u0643تاب", "\u06a9تاب"},
+		// Persian and Arabic-Indic digits become ASCII.
+		{"۱۲۳۴۵۶۷۸۹۰", "1234567890"},
+		{"٠١٢٣٤٥٦٧٨٩", "0123456789"},
+		// Tatweel is dropped.
+		{"س\u0640\u0640لام", "سلام"},
+		// Zero-width non-joiners are kept in prose.
+		{"م\u06cc\u200cروم", "م\u06cc\u200cروم"},
+		{"\u200fabc\u200e", "\u200fabc\u200e"},
+	}
+	for _, tc := range cases {
+		if got := Normalize(tc.in); got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"عل\u064a۱۲۳", "عل\u06cc123"},
+		// Joiners and direction marks are removed from identifiers.
+		{"م\u06cc\u200cروم", "م\u06ccروم"},
+		{"a\u200db", "ab"},
+		{"\u200fabc\u200e", "abc"},
+		{"\u0643\u0640\u200c\u064a", "\u06a9\u06cc"},
+	}
+	for _, tc := range cases {
+		if got := Compact(tc.in); got != tc.want {
+			t.Errorf("Compact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
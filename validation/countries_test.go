@@ -0,0 +1,22 @@
+package validation
+
+import "testing"
+
+func TestIsCountryCode(t *testing.T) {
+	cases := map[string]bool{
+		"IR":  true,
+		"DE":  true,
+		"GB":  true,
+		"SS":  true,
+		"XK":  false, // user-assigned, not official
+		"UK":  false, // reserved, GB is the code
+		"ir":  false,
+		"IRN": false,
+		"":    false,
+	}
+	for code, want := range cases {
+		if got := IsCountryCode(code); got != want {
+			t.Errorf("IsCountryCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
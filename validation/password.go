@@ -0,0 +1,27 @@
+package validation
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+)
+
+// ValidatePassword checks a new password, reported under field. It must be
+// within the configured length and may not be the username or email.
+func ValidatePassword(field, password, username, email string) Errors {
+	r := CurrentRules()
+	var errs Errors
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n == 0:
+		errs = append(errs, NewFieldError(field, CodeRequired, nil))
+	case n < r.PasswordMin:
+		errs = append(errs, NewFieldError(field, CodeTooShort, i18n.Params{"min": r.PasswordMin}))
+	case n > r.PasswordMax:
+		errs = append(errs, NewFieldError(field, CodeTooLong, i18n.Params{"max": r.PasswordMax}))
+	case strings.EqualFold(password, username) || strings.EqualFold(password, email):
+		errs = append(errs, NewFieldError(field, CodeNotAllowed, nil))
+	}
+	return errs
+}
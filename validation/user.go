@@ -0,0 +1,242 @@
+package validation
+
+import (
+	"log"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+)
+
+// Error codes reported in FieldError.Code. They are part of the API contract.
+const (
+	CodeRequired       = "required"
+	CodeTooShort       = "too_short"
+	CodeTooLong        = "too_long"
+	CodeInvalidFormat  = "invalid_format"
+	CodeNotAllowed     = "not_allowed"
+	CodeInvalidCountry = "invalid_country"
+	CodeReserved       = "reserved"
+	CodeBlocked        = "blocked"
+	CodeDisposable     = "disposable"
+	CodeDomainLimit    = "domain_limit"
+)
+
+// FieldError describes why one field was rejected. Message is rendered from the
+// i18n catalog (validation.<code>) using Params, which are also returned so
+// clients can build their own text.
+type FieldError struct {
+	Field   string      `json:"field"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Params  i18n.Params `json:"params,omitempty"`
+}
+
+// NewFieldError builds a FieldError with its message in the default language.
+func NewFieldError(field, code string, params i18n.Params) FieldError {
+	return FieldError{Field: field, Code: code, Params: params}.Localized(i18n.Default)
+}
+
+// Localized returns fe with Message rendered in lang, preferring a
+// validation.<field>.<code> message over the generic validation.<code> one.
+func (fe FieldError) Localized(lang string) FieldError {
+	key := "validation." + fe.Field + "." + fe.Code
+	if !i18n.Has(key) {
+		key = "validation." + fe.Code
+	}
+	params := i18n.Params{"field": fe.Field}
+	if label := "field." + fe.Field; i18n.Has(label) {
+		params["field"] = i18n.Translate(lang, label, nil)
+	}
+	for name, value := range fe.Params {
+		params[name] = value
+	}
+	fe.Message = i18n.Translate(lang, key, params)
+	return fe
+}
+
+// Localized renders every message in lang.
+func (e Errors) Localized(lang string) Errors {
+	out := make(Errors, len(e))
+	for i, fe := range e {
+		out[i] = fe.Localized(lang)
+	}
+	return out
+}
+
+// Errors is the list of field errors for one payload.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// User is the input checked by ValidateUser.
+type User struct {
+	Username    string
+	Email       string
+	Bio         string
+	Gender      string
+	Nationality string
+}
+
+// Rules are the configurable user constraints, read once from the environment:
+// USER_GENDERS (comma separated), USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH,
+// USERNAME_PATTERN, BIO_MAX_LENGTH and PASSWORD_MIN_LENGTH.
+type Rules struct {
+	Genders         []string
+	UsernameMin     int
+	UsernameMax     int
+	UsernamePattern *regexp.Regexp
+	BioMax          int
+	EmailMax        int
+	PasswordMin     int
+	PasswordMax     int
+}
+
+var (
+	rulesOnce sync.Once
+	rules     Rules
+)
+
+// CurrentRules returns the rules loaded from the environment.
+func CurrentRules() Rules {
+	rulesOnce.Do(func() {
+		rules = Rules{
+			Genders:         strings.Split(envOr("USER_GENDERS", "female,male,other"), ","),
+			UsernameMin:     envInt("USERNAME_MIN_LENGTH", 3),
+			UsernameMax:     envInt("USERNAME_MAX_LENGTH", 32),
+			UsernamePattern: envPattern("USERNAME_PATTERN", `^[\p{L}\p{N}_.-]+$`),
+			BioMax:          envInt("BIO_MAX_LENGTH", 500),
+			EmailMax:        128,
+			PasswordMin:     envInt("PASSWORD_MIN_LENGTH", 8),
+			PasswordMax:     128,
+		}
+		for i, g := range rules.Genders {
+			rules.Genders[i] = strings.ToLower(strings.TrimSpace(g))
+		}
+	})
+	return rules
+}
+
+// ValidateUser checks u against the current rules. When fields is non-empty only
+// those fields (by JSON name) are checked, so an update is not blocked by
+// untouched legacy values. It returns nil when everything is valid.
+func ValidateUser(u User, fields ...string) Errors {
+	r := CurrentRules()
+	check := func(field string) bool {
+		if len(fields) == 0 {
+			return true
+		}
+		for _, f := range fields {
+			if f == field {
+				return true
+			}
+		}
+		return false
+	}
+
+	var errs Errors
+	add := func(field, code string, params i18n.Params) {
+		errs = append(errs, NewFieldError(field, code, params))
+	}
+
+	if check("username") {
+		n := utf8.RuneCountInString(u.Username)
+		switch {
+		case n == 0:
+			add("username", CodeRequired, nil)
+		case n < r.UsernameMin:
+			add("username", CodeTooShort, i18n.Params{"min": r.UsernameMin})
+		case n > r.UsernameMax:
+			add("username", CodeTooLong, i18n.Params{"max": r.UsernameMax})
+		case !r.UsernamePattern.MatchString(u.Username):
+			add("username", CodeInvalidFormat, nil)
+		}
+	}
+
+	if check("email") {
+		switch {
+		case u.Email == "":
+			add("email", CodeRequired, nil)
+		case len(u.Email) > r.EmailMax:
+			add("email", CodeTooLong, i18n.Params{"max": r.EmailMax})
+		case !isEmail(u.Email):
+			add("email", CodeInvalidFormat, nil)
+		}
+	}
+
+	if check("bio") && utf8.RuneCountInString(u.Bio) > r.BioMax {
+		add("bio", CodeTooLong, i18n.Params{"max": r.BioMax})
+	}
+
+	if check("gender") && u.Gender != "" && !contains(r.Genders, u.Gender) {
+		add("gender", CodeNotAllowed, i18n.Params{"allowed": strings.Join(r.Genders, ", ")})
+	}
+
+	if check("nationality") && u.Nationality != "" && !IsCountryCode(u.Nationality) {
+		add("nationality", CodeInvalidCountry, nil)
+	}
+
+	return errs
+}
+
+// isEmail accepts a bare addr-spec with a dotted domain, rejecting display names
+// and the other RFC 5322 forms net/mail would otherwise allow.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return false
+	}
+	at := strings.LastIndex(s, "@")
+	return at > 0 && strings.Contains(s[at+1:], ".")
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func envOr(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: ignoring invalid %s=%q", key, v)
+		return fallback
+	}
+	return n
+}
+
+func envPattern(key, fallback string) *regexp.Regexp {
+	if v := os.Getenv(key); v != "" {
+		re, err := regexp.Compile(v)
+		if err == nil {
+			return re
+		}
+		log.Printf("Warning: ignoring invalid %s: %v", key, err)
+	}
+	return regexp.MustCompile(fallback)
+}
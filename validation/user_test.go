@@ -0,0 +1,114 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/amirkhgraphic/go-arcaptcha-service/i18n"
+)
+
+func TestValidateUser(t *testing.T) {
+	valid := User{Username: "alice", Email: "alice@example.com", Bio: "hi", Gender: "female", Nationality: "IR"}
+	with := func(fn func(u *User)) User {
+		u := valid
+		fn(&u)
+		return u
+	}
+
+	cases := []struct {
+		name   string
+		user   User
+		fields []string
+		want   string
+	}{
+		{"valid", valid, nil, "[]"},
+		{"optional fields empty", User{Username: "alice", Email: "alice@example.com"}, nil, "[]"},
+		{"persian username", with(func(u *User) { u.Username = "علی_۱۳۷۰" }), nil, "[]"},
+
+		{"username missing", with(func(u *User) { u.Username = "" }), nil, "[username:required]"},
+		{"username too short", with(func(u *User) { u.Username = "al" }), nil, "[username:too_short]"},
+		{"username length in runes", with(func(u *User) { u.Username = "علی" }), nil, "[]"},
+		{"username too long", with(func(u *User) { u.Username = strings.Repeat("a", 33) }), nil, "[username:too_long]"},
+		{"username with space", with(func(u *User) { u.Username = "al ice" }), nil, "[username:invalid_format]"},
+
+		{"email missing", with(func(u *User) { u.Email = "" }), nil, "[email:required]"},
+		{"email too long", with(func(u *User) { u.Email = strings.Repeat("a", 117) + "@example.com" }), nil, "[email:too_long]"},
+		{"email without domain dot", with(func(u *User) { u.Email = "alice@localhost" }), nil, "[email:invalid_format]"},
+		{"email with display name", with(func(u *User) { u.Email = "Alice <alice@example.com>" }), nil, "[email:invalid_format]"},
+		{"email without at", with(func(u *User) { u.Email = "alice.example.com" }), nil, "[email:invalid_format]"},
+
+		{"bio too long", with(func(u *User) { u.Bio = strings.Repeat("ب", 501) }), nil, "[bio:too_long]"},
+		{"bio at the limit", with(func(u *User) { u.Bio = strings.Repeat("ب", 500) }), nil, "[]"},
+		{"unknown gender", with(func(u *User) { u.Gender = "robot" }), nil, "[gender:not_allowed]"},
+		{"gender is case-sensitive", with(func(u *User) { u.Gender = "Female" }), nil, "[gender:not_allowed]"},
+		{"unassigned country", with(func(u *User) { u.Nationality = "XX" }), nil, "[nationality:invalid_country]"},
+		{"lowercase country", with(func(u *User) { u.Nationality = "ir" }), nil, "[nationality:invalid_country]"},
+
+		{"every field at once", User{Username: "a", Email: "x", Gender: "robot", Nationality: "IRN"}, nil,
+			"[username:too_short email:invalid_format gender:not_allowed nationality:invalid_country]"},
+		// An update only checks the fields it touches.
+		{"only the given fields", User{Username: "a", Email: "x", Gender: "robot"}, []string{"gender"}, "[gender:not_allowed]"},
+		{"untouched fields are skipped", User{Username: "a"}, []string{"bio"}, "[]"},
+	}
+	for _, tc := range cases {
+		errs := ValidateUser(tc.user, tc.fields...)
+		got := make([]string, len(errs))
+		for i, fe := range errs {
+			got[i] = fe.Field + ":" + fe.Code
+		}
+		if fmt.Sprint(got) != tc.want {
+			t.Errorf("%s: ValidateUser() = %v, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidateUserMessages(t *testing.T) {
+	errs := ValidateUser(User{Username: "al", Email: "alice@example.com", Gender: "robot"})
+	want := []string{
+		"username must be at least 3 characters",
+		"gender must be one of: female, male, other",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("ValidateUser() = %v, want %d errors", errs, len(want))
+	}
+	for i, fe := range errs {
+		if fe.Message != want[i] {
+			t.Errorf("%s: message = %q, want %q", fe.Field, fe.Message, want[i])
+		}
+	}
+	if got := errs.Error(); got != "username: "+want[0]+"; gender: "+want[1] {
+		t.Errorf("Errors.Error() = %q", got)
+	}
+}
+
+func TestFieldErrorLocalized(t *testing.T) {
+	cases := []struct {
+		fe   FieldError
+		lang string
+		want string
+	}{
+		{NewFieldError("username", CodeTooShort, i18n.Params{"min": 3}), i18n.English, "username must be at least 3 characters"},
+		// The field label is translated along with the message.
+		{NewFieldError("username", CodeTooShort, i18n.Params{"min": 3}), i18n.Persian, "نام کاربری باید دست‌کم 3 نویسه باشد"},
+		{NewFieldError("nationality", CodeRequired, nil), i18n.Persian, "ملیت الزامی است"},
+		// A field-specific message wins over the generic one for its code.
+		{NewFieldError("email", CodeInvalidFormat, nil), i18n.English, "email must be a valid address like name@example.com"},
+		{NewFieldError("gender", CodeInvalidFormat, nil), i18n.English, "gender is invalid"},
+		// Fields without a label keep their JSON name.
+		{NewFieldError("nickname", CodeRequired, nil), i18n.Persian, "nickname الزامی است"},
+	}
+	for _, tc := range cases {
+		if got := tc.fe.Localized(tc.lang).Message; got != tc.want {
+			t.Errorf("%s/%s in %s = %q, want %q", tc.fe.Field, tc.fe.Code, tc.lang, got, tc.want)
+		}
+	}
+
+	errs := Errors{NewFieldError("bio", CodeTooLong, i18n.Params{"max": 500})}
+	if got := errs.Localized(i18n.Persian)[0].Message; got != "بیوگرافی باید حداکثر 500 نویسه باشد" {
+		t.Errorf("Errors.Localized() = %q", got)
+	}
+	if errs[0].Message != "bio must be at most 500 characters" {
+		t.Errorf("Errors.Localized() changed the receiver: %q", errs[0].Message)
+	}
+}